@@ -87,6 +87,23 @@ type Client struct {
 	// set on the Request.
 	Jar CookieJar
 
+	// RedirectHeaders sets the headers of the request for a redirect
+	// the Client follows, such as Referer. It is called after the
+	// Client copies the initial request's headers, including
+	// HeaderOrderKey and PHeaderOrderKey, to the new request, less
+	// credentials for other hosts, and before CheckRedirect. req.Response
+	// is the redirect, and via holds the requests made already, oldest
+	// first.
+	//
+	// If RedirectHeaders is nil, the Client uses DefaultRedirectHeaders.
+	// BrowserRedirectHeaders rewrites the headers as browsers do.
+	RedirectHeaders func(req *Request, via []*Request)
+
+	// CookieMerge decides how the cookies from Jar are combined with
+	// those the Request sets itself. By default the Jar's cookies go
+	// after the Request's, in one Cookie header.
+	CookieMerge CookieMerge
+
 	// Timeout specifies a time limit for requests made by this
 	// Client. The timeout includes connection time, any
 	// redirects, and reading the response body. The timer remains
@@ -167,10 +184,15 @@ func refererForURL(lastReq, newReq *url.URL) string {
 
 // didTimeout is non-nil only if err != nil.
 func (c *Client) send(req *Request, deadline time.Time) (resp *Response, didTimeout func() bool, err error) {
+	rjar, _ := c.Jar.(RequestCookieJar)
 	if c.Jar != nil {
-		for _, cookie := range c.Jar.Cookies(req.URL) {
-			req.AddCookie(cookie)
+		var cookies []*Cookie
+		if rjar != nil {
+			cookies = rjar.RequestCookies(req)
+		} else {
+			cookies = c.Jar.Cookies(req.URL)
 		}
+		c.CookieMerge.mergeCookies(req, cookies)
 	}
 	resp, didTimeout, err = send(req, c.transport(), deadline)
 	if err != nil {
@@ -178,7 +200,11 @@ func (c *Client) send(req *Request, deadline time.Time) (resp *Response, didTime
 	}
 	if c.Jar != nil {
 		if rc := resp.Cookies(); len(rc) > 0 {
-			c.Jar.SetCookies(req.URL, rc)
+			if rjar != nil {
+				rjar.SetRequestCookies(req, rc)
+			} else {
+				c.Jar.SetCookies(req.URL, rc)
+			}
 		}
 	}
 	return resp, nil, nil
@@ -492,6 +518,16 @@ func (c *Client) checkRedirect(req *Request, via []*Request) error {
 	return fn(req, via)
 }
 
+// redirectHeaders calls either the user's RedirectHeaders function, or
+// the default.
+func (c *Client) redirectHeaders(req *Request, via []*Request) {
+	fn := c.RedirectHeaders
+	if fn == nil {
+		fn = DefaultRedirectHeaders
+	}
+	fn(req, via)
+}
+
 // redirectBehavior describes what should happen when the
 // client encounters a 3xx status code from the server
 func redirectBehavior(reqMethod string, resp *Response, ireq *Request) (redirectMethod string, shouldRedirect, includeBody bool) {
@@ -659,6 +695,8 @@ func (c *Client) do(req *Request) (retres *Response, reterr error) {
 				Host:     host,
 				Cancel:   ireq.Cancel,
 				ctx:      ireq.ctx,
+
+				PreserveHeaderCase: ireq.PreserveHeaderCase,
 			}
 			if includeBody && ireq.GetBody != nil {
 				req.Body, err = ireq.GetBody()
@@ -675,11 +713,9 @@ func (c *Client) do(req *Request) (retres *Response, reterr error) {
 			// their CheckRedirect func.
 			copyHeaders(req)
 
-			// Add the Referer header from the most recent
-			// request URL to the new one, if it's not https->http:
-			if ref := refererForURL(reqs[len(reqs)-1].URL, req.URL); ref != "" {
-				req.Header.Set("Referer", ref)
-			}
+			// Set the headers that depend on the redirect, by
+			// default the Referer from the most recent request URL.
+			c.redirectHeaders(req, reqs)
 			err = c.checkRedirect(req, reqs)
 
 			// Sentinel error to let users select the
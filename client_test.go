@@ -731,6 +731,244 @@ Cookies("http://firsthost.fake/nosetcookie")
 	}
 }
 
+func TestRequestCookieJarCalls(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		SetCookie(w, &Cookie{Name: "name", Value: "val"})
+	}))
+	defer ts.Close()
+	jar := new(RecordingRequestJar)
+	c := ts.Client()
+	c.Jar = jar
+	top, _ := url.Parse("https://top.fake/")
+	req, _ := NewRequest("POST", ts.URL, nil)
+	req = req.WithContext(WithCookieSite(req.Context(), CookieSite{TopLevel: top}))
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	got := jar.log.String()
+	want := `RequestCookies("POST", "https://top.fake/")
+SetRequestCookies("POST", "https://top.fake/", [name=val])
+`
+	if got != want {
+		t.Errorf("Got Jar calls:\n%s\nWant:\n%s", got, want)
+	}
+}
+
+// RecordingRequestJar is a RecordingJar that is also a
+// RequestCookieJar, logging the method and CookieSite of requests.
+type RecordingRequestJar struct {
+	RecordingJar
+}
+
+func (j *RecordingRequestJar) RequestCookies(req *Request) []*Cookie {
+	site, _ := CookieSiteFromContext(req.Context())
+	j.logf("RequestCookies(%q, %q)\n", req.Method, site.TopLevel)
+	return nil
+}
+
+func (j *RecordingRequestJar) SetRequestCookies(req *Request, cookies []*Cookie) {
+	site, _ := CookieSiteFromContext(req.Context())
+	j.logf("SetRequestCookies(%q, %q, %v)\n", req.Method, site.TopLevel, cookies)
+}
+
+func TestRedirectHeaderOrder(t *testing.T) {
+	defer afterTest(t)
+	got := make(chan []string, 1)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/" {
+			Redirect(w, r, "/next", StatusFound)
+			return
+		}
+		var names []string
+		for _, h := range r.RawHeaders {
+			if name := strings.ToLower(h.Name); name != "host" {
+				names = append(names, name)
+			}
+		}
+		got <- names
+	}))
+	defer ts.Close()
+
+	order := []string{"user-agent", "accept", "accept-encoding", "cookie"}
+	porder := []string{":method", ":authority", ":scheme", ":path"}
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req.Header = Header{
+		"accept":          {"*/*"},
+		"accept-encoding": {"gzip"},
+		"user-agent":      {"ua"},
+		"cookie":          {"a=1"},
+		HeaderOrderKey:    order,
+		PHeaderOrderKey:   porder,
+	}
+	c := ts.Client()
+	c.CheckRedirect = func(req *Request, via []*Request) error {
+		if got := req.Header[PHeaderOrderKey]; !reflect.DeepEqual(got, porder) {
+			t.Errorf("redirect PHeaderOrderKey = %q; want %q", got, porder)
+		}
+		want := []string{"user-agent", "accept", "referer", "accept-encoding", "cookie"}
+		if got := req.Header[HeaderOrderKey]; !reflect.DeepEqual(got, want) {
+			t.Errorf("redirect HeaderOrderKey = %q; want %q", got, want)
+		}
+		return nil
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	want := []string{"user-agent", "accept", "referer", "accept-encoding", "cookie"}
+	if names := <-got; !reflect.DeepEqual(names, want) {
+		t.Errorf("redirected request headers = %q; want %q", names, want)
+	}
+	if got := req.Header[HeaderOrderKey]; !reflect.DeepEqual(got, []string{"user-agent", "accept", "accept-encoding", "cookie"}) {
+		t.Errorf("initial request's HeaderOrderKey changed to %q", got)
+	}
+}
+
+func TestBrowserRedirectHeaders(t *testing.T) {
+	defer afterTest(t)
+	type seen struct {
+		method string
+		header Header
+	}
+	got := make(chan seen, 1)
+	handler := HandlerFunc(func(w ResponseWriter, r *Request) {
+		switch r.URL.Path {
+		case "/303":
+			Redirect(w, r, "/next", StatusSeeOther)
+		case "/307":
+			Redirect(w, r, r.URL.Query().Get("to"), StatusTemporaryRedirect)
+		default:
+			io.Copy(io.Discard, r.Body)
+			got <- seen{r.Method, r.Header}
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	other := httptest.NewServer(handler)
+	defer other.Close()
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1) + "/next"
+
+	c := ts.Client()
+	c.RedirectHeaders = BrowserRedirectHeaders
+	post := func(path string) seen {
+		req, _ := NewRequest("POST", ts.URL+path, strings.NewReader("a=1"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Origin", ts.URL)
+		req.Header.Set("Referer", ts.URL+"/form?x=1")
+		req.Header.Set("Sec-Fetch-Site", "same-origin")
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return <-got
+	}
+
+	s := post("/303")
+	if s.method != "GET" {
+		t.Errorf("303: method = %q; want GET", s.method)
+	}
+	for _, name := range []string{"Content-Type", "Content-Length", "Origin"} {
+		if v := s.header.Get(name); v != "" {
+			t.Errorf("303: %s = %q; want none", name, v)
+		}
+	}
+	if got, want := s.header.Get("Referer"), ts.URL+"/form?x=1"; got != want {
+		t.Errorf("303: Referer = %q; want %q", got, want)
+	}
+	if got := s.header.Get("Sec-Fetch-Site"); got != "same-origin" {
+		t.Errorf("303: Sec-Fetch-Site = %q; want same-origin", got)
+	}
+
+	s = post("/307?to=" + url.QueryEscape(otherURL))
+	if s.method != "POST" {
+		t.Errorf("307: method = %q; want POST", s.method)
+	}
+	if got := s.header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+		t.Errorf("307: Content-Type = %q", got)
+	}
+	if got := s.header.Get("Origin"); got != ts.URL {
+		t.Errorf("307: Origin = %q; want %q", got, ts.URL)
+	}
+	if got, want := s.header.Get("Referer"), ts.URL+"/"; got != want {
+		t.Errorf("307: Referer = %q; want %q", got, want)
+	}
+	if got := s.header.Get("Sec-Fetch-Site"); got != "cross-site" {
+		t.Errorf("307: Sec-Fetch-Site = %q; want cross-site", got)
+	}
+
+	// A second hop leaves an origin other than the request's, which
+	// taints it.
+	thirdURL := other.URL + "/next"
+	s = post("/307?to=" + url.QueryEscape(strings.Replace(otherURL, "/next", "/307?to="+url.QueryEscape(thirdURL), 1)))
+	if s.method != "POST" {
+		t.Errorf("307 twice: method = %q; want POST", s.method)
+	}
+	if got := s.header.Get("Origin"); got != "null" {
+		t.Errorf("307 twice: Origin = %q; want null", got)
+	}
+	if got, want := s.header.Get("Referer"), ts.URL+"/"; got != want {
+		t.Errorf("307 twice: Referer = %q; want %q", got, want)
+	}
+}
+
+// fixedJar always returns the same cookies.
+type fixedJar []*Cookie
+
+func (fixedJar) SetCookies(u *url.URL, cookies []*Cookie) {}
+
+func (j fixedJar) Cookies(u *url.URL) []*Cookie { return j }
+
+func TestClientCookieMerge(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Got", strings.Join(r.Header["Cookie"], " | "))
+	}))
+	defer ts.Close()
+
+	jar := fixedJar{
+		{Name: "deep", Value: "1", Path: "/a/b"},
+		{Name: "dup", Value: "jar", Path: "/"},
+		{Name: "root", Value: "2", Path: "/"},
+	}
+	own := Header{
+		"Cookie": {"dup=own; mine=1"},
+		"cookie": {"lower=1"},
+	}
+	tests := []struct {
+		merge CookieMerge
+		want  string
+	}{
+		{CookieMerge{}, "dup=own; mine=1; lower=1; deep=1; dup=jar; root=2"},
+		{CookieMerge{Dedup: true}, "dup=own; mine=1; lower=1; deep=1; root=2"},
+		{CookieMerge{Order: CookieOrderJarFirst}, "deep=1; dup=jar; root=2; dup=own; mine=1; lower=1"},
+		{CookieMerge{Order: CookieOrderJarFirst, Dedup: true}, "deep=1; dup=jar; root=2; mine=1; lower=1"},
+		{CookieMerge{Order: CookieOrderBrowser}, "deep=1; dup=own; mine=1; lower=1; dup=jar; root=2"},
+	}
+	for _, tt := range tests {
+		c := ts.Client()
+		c.Jar = jar
+		c.CookieMerge = tt.merge
+		req, _ := NewRequest("GET", ts.URL, nil)
+		req.Header = own.Clone()
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if got := res.Header.Get("Got"); got != tt.want {
+			t.Errorf("%+v: Cookie = %q; want %q", tt.merge, got, tt.want)
+		}
+		if _, ok := req.Header["cookie"]; ok {
+			t.Errorf("%+v: request kept its lowercase Cookie header: %v", tt.merge, req.Header)
+		}
+	}
+}
+
 // RecordingJar keeps a log of calls made to it, without
 // tracking any cookies.
 type RecordingJar struct {
@@ -0,0 +1,276 @@
+// Package clienthello captures and parses the TLS ClientHello sent by
+// clients, and computes their JA3 and JA4 fingerprints.
+//
+// A Listener records the ClientHello of every connection it accepts,
+// before crypto/tls consumes it. To make it available to handlers,
+// wrap the server's listener and set its ConnContext:
+//
+//	ts := httptest.NewUnstartedServer(handler)
+//	l := clienthello.NewListener(ts.Listener)
+//	ts.Listener = l
+//	ts.Config.ConnContext = l.ConnContext
+//	ts.StartTLS()
+//
+// Handlers then call FromContext with the request's context.
+package clienthello
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	recordTypeHandshake          = 22
+	typeClientHello              = 1
+	recordHeaderLen              = 5
+	maxClientHelloLen            = 1 << 16
+	extensionServerName          = 0x0000
+	extensionSupportedGroups     = 0x000a
+	extensionECPointFormats      = 0x000b
+	extensionSignatureAlgorithms = 0x000d
+	extensionALPN                = 0x0010
+	extensionSupportedVersions   = 0x002b
+)
+
+// A ClientHello is a parsed TLS ClientHello message.
+type ClientHello struct {
+	// Version is the legacy_version field of the message. TLS 1.3
+	// clients send 0x0303 and list their versions in
+	// SupportedVersions instead.
+	Version uint16
+
+	// CipherSuites are the offered cipher suites, in order.
+	CipherSuites []uint16
+
+	// Extensions are the types of the extensions, in order.
+	Extensions []uint16
+
+	// ServerName is the host name from the server_name extension.
+	ServerName string
+
+	// Curves are the named groups from the supported_groups
+	// extension, in order.
+	Curves []uint16
+
+	// PointFormats are the values of the ec_point_formats extension.
+	PointFormats []uint8
+
+	// SignatureAlgorithms are the values of the
+	// signature_algorithms extension, in order.
+	SignatureAlgorithms []uint16
+
+	// ALPN are the protocols of the application_layer_protocol_negotiation
+	// extension, in order.
+	ALPN []string
+
+	// SupportedVersions are the values of the supported_versions
+	// extension, in order.
+	SupportedVersions []uint16
+
+	// Raw is the handshake message, starting with its type byte.
+	Raw []byte
+}
+
+// ErrNotClientHello is returned by Parse when the data isn't a TLS
+// handshake record carrying a ClientHello.
+var ErrNotClientHello = errors.New("clienthello: not a TLS ClientHello")
+
+// Parse parses a ClientHello from the TLS records in data. The
+// message may be fragmented over several handshake records.
+func Parse(data []byte) (*ClientHello, error) {
+	msg, _, err := handshakeMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, errors.New("clienthello: truncated ClientHello")
+	}
+	return ParseMessage(msg)
+}
+
+// handshakeMessage reassembles the first handshake message from the
+// TLS records in data. It returns a nil message and the number of
+// bytes still needed if data ends before the message does.
+func handshakeMessage(data []byte) (msg []byte, need int, err error) {
+	var body []byte
+	for {
+		if len(data) < recordHeaderLen {
+			return nil, recordHeaderLen - len(data), nil
+		}
+		if data[0] != recordTypeHandshake || data[1] != 3 {
+			return nil, 0, ErrNotClientHello
+		}
+		n := int(data[3])<<8 | int(data[4])
+		if len(data) < recordHeaderLen+n {
+			return nil, recordHeaderLen + n - len(data), nil
+		}
+		body = append(body, data[recordHeaderLen:recordHeaderLen+n]...)
+		data = data[recordHeaderLen+n:]
+
+		if len(body) < 4 {
+			continue
+		}
+		if body[0] != typeClientHello {
+			return nil, 0, ErrNotClientHello
+		}
+		msgLen := 4 + (int(body[1])<<16 | int(body[2])<<8 | int(body[3]))
+		if msgLen > maxClientHelloLen {
+			return nil, 0, fmt.Errorf("clienthello: ClientHello too large (%d bytes)", msgLen)
+		}
+		if len(body) >= msgLen {
+			return body[:msgLen], 0, nil
+		}
+	}
+}
+
+// ParseMessage parses a ClientHello handshake message, starting with
+// its type byte, without the record layer.
+func ParseMessage(msg []byte) (*ClientHello, error) {
+	s := reader(msg)
+	var typ uint8
+	var body reader
+	if !s.readUint8(&typ) || typ != typeClientHello || !s.readUint24Prefixed(&body) {
+		return nil, ErrNotClientHello
+	}
+
+	ch := &ClientHello{Raw: msg}
+	var sessionID, ciphers, compression reader
+	if !body.readUint16(&ch.Version) ||
+		!body.skip(32) || // random
+		!body.readUint8Prefixed(&sessionID) ||
+		!body.readUint16Prefixed(&ciphers) ||
+		!body.readUint8Prefixed(&compression) {
+		return nil, errors.New("clienthello: malformed ClientHello")
+	}
+	if !ciphers.readUint16List(&ch.CipherSuites) {
+		return nil, errors.New("clienthello: malformed cipher suites")
+	}
+	if len(body) == 0 {
+		// No extensions.
+		return ch, nil
+	}
+
+	var exts reader
+	if !body.readUint16Prefixed(&exts) || len(body) != 0 {
+		return nil, errors.New("clienthello: malformed extensions")
+	}
+	for len(exts) > 0 {
+		var typ uint16
+		var data reader
+		if !exts.readUint16(&typ) || !exts.readUint16Prefixed(&data) {
+			return nil, errors.New("clienthello: malformed extensions")
+		}
+		ch.Extensions = append(ch.Extensions, typ)
+		if err := ch.parseExtension(typ, data); err != nil {
+			return nil, err
+		}
+	}
+	return ch, nil
+}
+
+func (ch *ClientHello) parseExtension(typ uint16, data reader) error {
+	ok := true
+	switch typ {
+	case extensionServerName:
+		var list reader
+		ok = data.readUint16Prefixed(&list)
+		for ok && len(list) > 0 {
+			var nameType uint8
+			var name reader
+			ok = list.readUint8(&nameType) && list.readUint16Prefixed(&name)
+			if ok && nameType == 0 && ch.ServerName == "" {
+				ch.ServerName = string(name)
+			}
+		}
+	case extensionSupportedGroups:
+		var list reader
+		ok = data.readUint16Prefixed(&list) && list.readUint16List(&ch.Curves)
+	case extensionECPointFormats:
+		var list reader
+		if ok = data.readUint8Prefixed(&list); ok {
+			ch.PointFormats = append([]uint8{}, list...)
+		}
+	case extensionSignatureAlgorithms:
+		var list reader
+		ok = data.readUint16Prefixed(&list) && list.readUint16List(&ch.SignatureAlgorithms)
+	case extensionALPN:
+		var list reader
+		ok = data.readUint16Prefixed(&list)
+		for ok && len(list) > 0 {
+			var proto reader
+			if ok = list.readUint8Prefixed(&proto); ok {
+				ch.ALPN = append(ch.ALPN, string(proto))
+			}
+		}
+	case extensionSupportedVersions:
+		var list reader
+		ok = data.readUint8Prefixed(&list) && list.readUint16List(&ch.SupportedVersions)
+	}
+	if !ok {
+		return fmt.Errorf("clienthello: malformed extension %#04x", typ)
+	}
+	return nil
+}
+
+// reader consumes big-endian values from a byte slice.
+type reader []byte
+
+func (r *reader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *reader) readUint8(v *uint8) bool {
+	if len(*r) < 1 {
+		return false
+	}
+	*v = (*r)[0]
+	*r = (*r)[1:]
+	return true
+}
+
+func (r *reader) readUint16(v *uint16) bool {
+	if len(*r) < 2 {
+		return false
+	}
+	*v = uint16((*r)[0])<<8 | uint16((*r)[1])
+	*r = (*r)[2:]
+	return true
+}
+
+func (r *reader) readPrefixed(lenLen int, out *reader) bool {
+	if len(*r) < lenLen {
+		return false
+	}
+	var n int
+	for _, b := range (*r)[:lenLen] {
+		n = n<<8 | int(b)
+	}
+	*r = (*r)[lenLen:]
+	if len(*r) < n {
+		return false
+	}
+	*out = (*r)[:n]
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *reader) readUint8Prefixed(out *reader) bool  { return r.readPrefixed(1, out) }
+func (r *reader) readUint16Prefixed(out *reader) bool { return r.readPrefixed(2, out) }
+func (r *reader) readUint24Prefixed(out *reader) bool { return r.readPrefixed(3, out) }
+
+// readUint16List reads the rest of r as a list of uint16 values.
+func (r *reader) readUint16List(out *[]uint16) bool {
+	if len(*r)%2 != 0 {
+		return false
+	}
+	for len(*r) > 0 {
+		var v uint16
+		r.readUint16(&v)
+		*out = append(*out, v)
+	}
+	return true
+}
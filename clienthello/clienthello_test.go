@@ -0,0 +1,145 @@
+package clienthello
+
+import (
+	"crypto/tls"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestConnCapturesClientHello(t *testing.T) {
+	cc, sc := net.Pipe()
+	defer cc.Close()
+	go tls.Client(cc, &tls.Config{
+		ServerName: "example.com",
+		NextProtos: []string{"h2", "http/1.1"},
+		MinVersion: tls.VersionTLS12,
+	}).Handshake()
+
+	conn := &Conn{Conn: sc, l: new(Listener)}
+	defer conn.Close()
+	if _, ok := conn.ClientHello(); ok {
+		t.Fatal("ClientHello available before reading")
+	}
+	// Reading returns the ClientHello's record unchanged.
+	buf := make([]byte, 5)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf[0] != recordTypeHandshake {
+		t.Errorf("first byte read = %d; want %d", buf[0], recordTypeHandshake)
+	}
+
+	ch, ok := conn.ClientHello()
+	if !ok {
+		t.Fatalf("no ClientHello; err = %v", conn.Err())
+	}
+	if ch.ServerName != "example.com" {
+		t.Errorf("ServerName = %q; want example.com", ch.ServerName)
+	}
+	if want := []string{"h2", "http/1.1"}; !reflect.DeepEqual(ch.ALPN, want) {
+		t.Errorf("ALPN = %q; want %q", ch.ALPN, want)
+	}
+	if ch.Version != tls.VersionTLS12 {
+		t.Errorf("Version = %#04x; want %#04x", ch.Version, tls.VersionTLS12)
+	}
+	if len(ch.CipherSuites) == 0 || len(ch.Curves) == 0 || len(ch.SignatureAlgorithms) == 0 || len(ch.SupportedVersions) == 0 {
+		t.Errorf("missing fields in %+v", ch)
+	}
+	if got := ch.JA4()[:4]; got != "t13d" {
+		t.Errorf("JA4 starts with %q; want t13d", got)
+	}
+}
+
+func TestConnNotTLS(t *testing.T) {
+	cc, sc := net.Pipe()
+	defer cc.Close()
+	go cc.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+
+	conn := &Conn{Conn: sc, l: new(Listener)}
+	defer conn.Close()
+	buf := make([]byte, 3)
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "GET" {
+		t.Fatalf("Read = %q, %v; want GET", buf[:n], err)
+	}
+	if _, ok := conn.ClientHello(); ok {
+		t.Error("got a ClientHello from a plaintext connection")
+	}
+	if err := conn.Err(); err != ErrNotClientHello {
+		t.Errorf("Err = %v; want %v", err, ErrNotClientHello)
+	}
+}
+
+func TestParseFragmented(t *testing.T) {
+	msg := []byte{typeClientHello, 0, 0, 41, 3, 3}
+	msg = append(msg, make([]byte, 32)...) // random
+	msg = append(msg, 0)                   // session ID
+	msg = append(msg, 0, 2, 0x13, 0x01)    // cipher suites
+	msg = append(msg, 1, 0)                // compression methods
+
+	// Split the message over two records.
+	data := append([]byte{recordTypeHandshake, 3, 1, 0, 10}, msg[:10]...)
+	data = append(data, recordTypeHandshake, 3, 1, 0, byte(len(msg)-10))
+	data = append(data, msg[10:]...)
+
+	ch, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint16{0x1301}; !reflect.DeepEqual(ch.CipherSuites, want) {
+		t.Errorf("CipherSuites = %#04x; want %#04x", ch.CipherSuites, want)
+	}
+	if _, err := Parse(data[:len(data)-1]); err == nil {
+		t.Error("Parse of truncated data succeeded")
+	}
+	if _, err := Parse([]byte("GET / HTTP/1.1\r\n")); err != ErrNotClientHello {
+		t.Errorf("Parse of HTTP request = %v; want %v", err, ErrNotClientHello)
+	}
+}
+
+// chrome is the ClientHello of the JA4 specification's example.
+var chrome = &ClientHello{
+	Version: 0x0303,
+	CipherSuites: []uint16{
+		0x9a9a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030,
+		0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035,
+	},
+	Extensions: []uint16{
+		0xdada, 0x0000, 0x0017, 0xff01, 0x000a, 0x000b, 0x0023, 0x0010,
+		0x0005, 0x000d, 0x0012, 0x0033, 0x002d, 0x002b, 0x001b, 0x4469,
+		0x0015,
+	},
+	ServerName:   "example.com",
+	Curves:       []uint16{0x4a4a, 0x001d, 0x0017, 0x0018},
+	PointFormats: []uint8{0},
+	SignatureAlgorithms: []uint16{
+		0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601,
+	},
+	ALPN:              []string{"h2", "http/1.1"},
+	SupportedVersions: []uint16{0x3a3a, 0x0304, 0x0303},
+}
+
+func TestJA4(t *testing.T) {
+	if got, want := chrome.JA4(), "t13d1516h2_8daaf6152771_e5627efa2ab1"; got != want {
+		t.Errorf("JA4 = %q; want %q", got, want)
+	}
+
+	ch := &ClientHello{Version: 0x0303, ALPN: []string{"\xab"}}
+	if got, want := ch.JA4(), "t12i0000ab_000000000000_000000000000"; got != want {
+		t.Errorf("JA4 = %q; want %q", got, want)
+	}
+}
+
+func TestJA3(t *testing.T) {
+	want := "771," +
+		"4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53," +
+		"0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513-21," +
+		"29-23-24," +
+		"0"
+	if got := chrome.JA3(); got != want {
+		t.Errorf("JA3 =\n%q; want\n%q", got, want)
+	}
+	if got := chrome.JA3Hash(); len(got) != 32 {
+		t.Errorf("JA3Hash = %q; want 32 hex digits", got)
+	}
+}
@@ -0,0 +1,173 @@
+package clienthello
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// isGREASE reports whether v is one of the GREASE values of RFC 8701,
+// which fingerprints ignore.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE(vs []uint16) []uint16 {
+	out := make([]uint16, 0, len(vs))
+	for _, v := range vs {
+		if !isGREASE(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// JA3 returns the JA3 string of ch:
+//
+//	SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats
+//
+// with the values of each list in decimal, separated by "-", and
+// GREASE values left out.
+func (ch *ClientHello) JA3() string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(int(ch.Version)))
+	for _, list := range [][]uint16{ch.CipherSuites, ch.Extensions, ch.Curves} {
+		b.WriteByte(',')
+		for i, v := range withoutGREASE(list) {
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteString(strconv.Itoa(int(v)))
+		}
+	}
+	b.WriteByte(',')
+	for i, v := range ch.PointFormats {
+		if i > 0 {
+			b.WriteByte('-')
+		}
+		b.WriteString(strconv.Itoa(int(v)))
+	}
+	return b.String()
+}
+
+// JA3Hash returns the MD5 hash of the JA3 string of ch, in hex, which
+// is how JA3 fingerprints are usually given.
+func (ch *ClientHello) JA3Hash() string {
+	sum := md5.Sum([]byte(ch.JA3()))
+	return hex.EncodeToString(sum[:])
+}
+
+// JA4 returns the JA4 fingerprint of ch, such as
+// "t13d1516h2_8daaf6152771_e5627efa2ab1". The connection is assumed to
+// be over TCP.
+func (ch *ClientHello) JA4() string {
+	ciphers := withoutGREASE(ch.CipherSuites)
+	exts := withoutGREASE(ch.Extensions)
+
+	sni := "i"
+	for _, e := range exts {
+		if e == extensionServerName {
+			sni = "d"
+		}
+	}
+	a := fmt.Sprintf("t%s%s%02d%02d%s", ch.ja4Version(), sni, min99(len(ciphers)), min99(len(exts)), ch.ja4ALPN())
+
+	// The hashed parts use sorted lists, so that they don't change
+	// with the randomized extension order of recent browsers. The
+	// server_name and ALPN extensions are already accounted for in
+	// the first part.
+	sortedCiphers := append([]uint16{}, ciphers...)
+	sort.Slice(sortedCiphers, func(i, j int) bool { return sortedCiphers[i] < sortedCiphers[j] })
+	var sortedExts []uint16
+	for _, e := range exts {
+		if e != extensionServerName && e != extensionALPN {
+			sortedExts = append(sortedExts, e)
+		}
+	}
+	sort.Slice(sortedExts, func(i, j int) bool { return sortedExts[i] < sortedExts[j] })
+
+	c := hexList(sortedExts)
+	if sigs := withoutGREASE(ch.SignatureAlgorithms); len(sigs) > 0 {
+		c += "_" + hexList(sigs)
+	}
+	if len(sortedExts) == 0 {
+		c = ""
+	}
+	return a + "_" + ja4Hash(hexList(sortedCiphers)) + "_" + ja4Hash(c)
+}
+
+// ja4Version returns the two characters of JA4 for the highest TLS
+// version offered by ch.
+func (ch *ClientHello) ja4Version() string {
+	v := ch.Version
+	for _, sv := range withoutGREASE(ch.SupportedVersions) {
+		if sv > v {
+			v = sv
+		}
+	}
+	switch v {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	}
+	return "00"
+}
+
+// ja4ALPN returns the two characters of JA4 for the first ALPN
+// protocol of ch: its first and last characters, or those of its hex
+// encoding if they aren't alphanumeric.
+func (ch *ClientHello) ja4ALPN() string {
+	if len(ch.ALPN) == 0 || ch.ALPN[0] == "" {
+		return "00"
+	}
+	p := ch.ALPN[0]
+	first, last := p[0], p[len(p)-1]
+	if !isAlnum(first) || !isAlnum(last) {
+		h := hex.EncodeToString([]byte(p))
+		return h[:1] + h[len(h)-1:]
+	}
+	return string([]byte{first, last})
+}
+
+func isAlnum(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func min99(n int) int {
+	if n > 99 {
+		return 99
+	}
+	return n
+}
+
+// hexList formats vs as comma-separated 4-digit lowercase hex.
+func hexList(vs []uint16) string {
+	parts := make([]string, len(vs))
+	for i, v := range vs {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ja4Hash returns the first 12 hex digits of the SHA-256 hash of s, or
+// zeros if s is empty.
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
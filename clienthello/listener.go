@@ -0,0 +1,158 @@
+package clienthello
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// A Listener wraps a net.Listener and records the ClientHello of each
+// accepted connection. It must sit below the TLS layer.
+type Listener struct {
+	net.Listener
+
+	// conns maps remote addresses to open *Conns, so that
+	// ConnContext can find a Conn behind a *tls.Conn.
+	conns sync.Map
+}
+
+// NewListener returns a Listener accepting connections from l.
+func NewListener(l net.Listener) *Listener {
+	return &Listener{Listener: l}
+}
+
+// Accept waits for and returns the next connection, as a *Conn.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	conn := &Conn{Conn: c, l: l}
+	l.conns.Store(c.RemoteAddr().String(), conn)
+	return conn, nil
+}
+
+// ConnContext returns a copy of ctx carrying the Conn that c was
+// accepted as. c may be the Conn itself or a connection wrapping it
+// that reports the same remote address, such as a *tls.Conn. It has
+// the signature of http.Server.ConnContext.
+func (l *Listener) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	conn, ok := c.(*Conn)
+	if !ok {
+		v, found := l.conns.Load(c.RemoteAddr().String())
+		if !found {
+			return ctx
+		}
+		conn = v.(*Conn)
+	}
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+type connContextKey struct{}
+
+// FromContext returns the ClientHello of the connection a server
+// request arrived on, given the request's context. It reports false
+// if the connection wasn't accepted by a Listener whose ConnContext
+// the server uses, or didn't start with a ClientHello.
+func FromContext(ctx context.Context) (*ClientHello, bool) {
+	conn, ok := ctx.Value(connContextKey{}).(*Conn)
+	if !ok {
+		return nil, false
+	}
+	return conn.ClientHello()
+}
+
+// A Conn is a connection accepted by a Listener. The first time it is
+// read from, it reads the ClientHello, and then returns it to the
+// reader unchanged. ClientHellos spread over more than about 16 KiB
+// of records aren't captured.
+type Conn struct {
+	net.Conn
+	l *Listener
+
+	once sync.Once
+	buf  []byte // read while capturing, not yet returned by Read
+
+	mu    sync.Mutex
+	hello *ClientHello
+	err   error
+}
+
+// ClientHello returns the ClientHello sent on c. It reports false if
+// it hasn't been read yet, or the connection didn't start with one.
+func (c *Conn) ClientHello() (*ClientHello, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hello, c.hello != nil
+}
+
+// Err returns the error that prevented capturing the ClientHello, if
+// any. A connection that isn't TLS gets ErrNotClientHello.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.once.Do(c.capture)
+	if len(c.buf) > 0 {
+		n := copy(p, c.buf)
+		c.buf = c.buf[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+// maxCaptureLen is the most capture reads looking for a ClientHello:
+// a 16 KiB message plus the headers of up to 64 records carrying it.
+// It stops clients from having unbounded data buffered, for example
+// by sending zero-length records.
+const maxCaptureLen = 1<<14 + 64*recordHeaderLen
+
+var errCaptureTooLarge = errors.New("clienthello: ClientHello records exceed 16 KiB")
+
+// capture reads the records holding the ClientHello into c.buf and
+// parses it. Read errors are left for Read to report.
+func (c *Conn) capture() {
+	var hello *ClientHello
+	var err error
+	for {
+		msg, need, herr := handshakeMessage(c.buf)
+		if herr != nil {
+			err = herr
+			break
+		}
+		if msg != nil {
+			hello, err = ParseMessage(msg)
+			break
+		}
+		if len(c.buf)+need > maxCaptureLen {
+			err = errCaptureTooLarge
+			break
+		}
+		start := len(c.buf)
+		c.buf = append(c.buf, make([]byte, need)...)
+		n, rerr := io.ReadFull(c.Conn, c.buf[start:])
+		c.buf = c.buf[:start+n]
+		if rerr != nil {
+			err = rerr
+			break
+		}
+	}
+
+	c.mu.Lock()
+	c.hello, c.err = hello, err
+	c.mu.Unlock()
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	key := c.RemoteAddr().String()
+	if v, ok := c.l.conns.Load(key); ok && v == c {
+		c.l.conns.Delete(key)
+	}
+	return c.Conn.Close()
+}
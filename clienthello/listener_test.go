@@ -0,0 +1,77 @@
+package clienthello
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	http "github.com/useflyent/fhttp"
+	"github.com/useflyent/fhttp/httptest"
+)
+
+func TestListenerServer(t *testing.T) {
+	for _, h2 := range []bool{false, true} {
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ch, ok := FromContext(r.Context())
+			if !ok {
+				http.Error(w, "no ClientHello", http.StatusInternalServerError)
+				return
+			}
+			io.WriteString(w, ch.JA4())
+		}))
+		l := NewListener(ts.Listener)
+		ts.Listener = l
+		ts.Config.ConnContext = l.ConnContext
+		ts.EnableHTTP2 = h2
+		ts.StartTLS()
+
+		res, err := ts.Client().Get(ts.URL)
+		if err != nil {
+			ts.Close()
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		ts.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("h2=%v: status %d: %s", h2, res.StatusCode, body)
+			continue
+		}
+		if res.ProtoMajor != 1 && !h2 || res.ProtoMajor != 2 && h2 {
+			t.Errorf("h2=%v: got %s response", h2, res.Proto)
+		}
+		// The test server is reached by IP address, so no SNI.
+		if got := string(body); len(got) < 4 || got[:4] != "t13i" {
+			t.Errorf("h2=%v: JA4 = %q; want t13i prefix", h2, got)
+		}
+	}
+}
+
+func TestConnCaptureLimit(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	conn := &Conn{Conn: c1, l: NewListener(nil)}
+
+	// Zero-length handshake records never complete a ClientHello.
+	records := bytes.Repeat([]byte{recordTypeHandshake, 3, 1, 0, 0}, maxCaptureLen/recordHeaderLen+10)
+	go func() {
+		c2.Write(records)
+		c2.Close()
+	}()
+
+	buf := make([]byte, 1024)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if err := conn.Err(); err != errCaptureTooLarge {
+		t.Errorf("Err() = %v; want %v", err, errCaptureTooLarge)
+	}
+	if _, ok := conn.ClientHello(); ok {
+		t.Error("ClientHello captured from zero-length records")
+	}
+	if len(conn.buf) > maxCaptureLen {
+		t.Errorf("buffered %d bytes; want at most %d", len(conn.buf), maxCaptureLen)
+	}
+}
@@ -247,6 +247,7 @@ func mostlyCopy(r *Response) *Response {
 	c := *r
 	c.Body = nil
 	c.TransferEncoding = nil
+	c.RawHeaders = nil // wire names and pseudo-headers differ by protocol
 	c.TLS = nil
 	c.Request = nil
 	return &c
@@ -33,6 +33,12 @@ type Cookie struct {
 	Secure   bool
 	HttpOnly bool
 	SameSite SameSite
+
+	// Partitioned marks a cookie kept apart for each top-level site
+	// (CHIPS). Priority is Chrome's eviction priority.
+	Partitioned bool
+	Priority    CookiePriority
+
 	Raw      string
 	Unparsed []string // Raw text of unparsed attribute-value pairs
 }
@@ -52,6 +58,17 @@ const (
 	SameSiteNoneMode
 )
 
+// CookiePriority is the Priority attribute of a cookie, which decides
+// which cookies Chrome evicts first when a domain has too many. The
+// zero value means the attribute is absent, which is Medium priority.
+type CookiePriority int
+
+const (
+	CookiePriorityLow CookiePriority = iota + 1
+	CookiePriorityMedium
+	CookiePriorityHigh
+)
+
 // ReadSetCookies parses all "Set-Cookie" Values from
 // the header h and returns the successfully parsed Cookies.
 func ReadSetCookies(h Header) []*Cookie {
@@ -116,6 +133,19 @@ func ReadSetCookies(h Header) []*Cookie {
 			case "secure":
 				c.Secure = true
 				continue
+			case "partitioned":
+				c.Partitioned = true
+				continue
+			case "priority":
+				switch strings.ToLower(val) {
+				case "low":
+					c.Priority = CookiePriorityLow
+				case "medium":
+					c.Priority = CookiePriorityMedium
+				case "high":
+					c.Priority = CookiePriorityHigh
+				}
+				continue
 			case "httponly":
 				c.HttpOnly = true
 				continue
@@ -228,6 +258,17 @@ func (c *Cookie) String() string {
 	case SameSiteStrictMode:
 		b.WriteString("; SameSite=Strict")
 	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	switch c.Priority {
+	case CookiePriorityLow:
+		b.WriteString("; Priority=Low")
+	case CookiePriorityMedium:
+		b.WriteString("; Priority=Medium")
+	case CookiePriorityHigh:
+		b.WriteString("; Priority=High")
+	}
 	return b.String()
 }
 
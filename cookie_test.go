@@ -81,6 +81,14 @@ var writeSetCookiesTests = []struct {
 		&Cookie{Name: "cookie-15", Value: "samesite-none", SameSite: SameSiteNoneMode},
 		"cookie-15=samesite-none; SameSite=None",
 	},
+	{
+		&Cookie{Name: "__Host-cookie-16", Value: "partitioned", Path: "/", Secure: true, Partitioned: true},
+		"__Host-cookie-16=partitioned; Path=/; Secure; Partitioned",
+	},
+	{
+		&Cookie{Name: "cookie-17", Value: "priority-high", Priority: CookiePriorityHigh},
+		"cookie-17=priority-high; Priority=High",
+	},
 	// The "special" cookies have Values containing commas or spaces which
 	// are disallowed by RFC 6265 but are common in the wild.
 	{
@@ -318,6 +326,25 @@ var readSetCookiesTests = []struct {
 			Raw:      "samesitenone=foo; SameSite=None",
 		}},
 	},
+	{
+		Header{"Set-Cookie": {"chips=foo; Secure; Partitioned; Priority=low"}},
+		[]*Cookie{{
+			Name:        "chips",
+			Value:       "foo",
+			Secure:      true,
+			Partitioned: true,
+			Priority:    CookiePriorityLow,
+			Raw:         "chips=foo; Secure; Partitioned; Priority=low",
+		}},
+	},
+	{
+		Header{"Set-Cookie": {"priorityinvalid=foo; Priority=urgent"}},
+		[]*Cookie{{
+			Name:  "priorityinvalid",
+			Value: "foo",
+			Raw:   "priorityinvalid=foo; Priority=urgent",
+		}},
+	},
 	// Make sure we can properly read back the Set-Cookie headers we create
 	// for Values containing spaces or commas:
 	{
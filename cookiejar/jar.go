@@ -8,6 +8,7 @@ package cookiejar
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net"
 	"net/url"
 	"sort"
@@ -55,18 +56,64 @@ type Options struct {
 	// secure: it means that the HTTP server for foo.co.uk can set a cookie
 	// for bar.co.uk.
 	PublicSuffixList PublicSuffixList
+
+	// Filename, if non-empty, makes the jar file-backed: New loads the
+	// cookies in the named file, if it exists, and the jar writes its
+	// cookies back to the file, in FileFormat, whenever they change.
+	//
+	// Every change rewrites the whole file before the call that made
+	// it returns, so SetCookies on a busy client pays for a file write
+	// per response with cookies. Jars that change often can leave
+	// Filename empty and call Save periodically instead.
+	Filename string
+
+	// FileFormat is the format of the file named by Filename.
+	FileFormat Format
+
+	// ErrorLog specifies an optional logger for errors writing the
+	// file named by Filename after a change. If nil, logging is done
+	// via the log package's standard logger.
+	ErrorLog *log.Logger
+
+	// LaxByDefault treats cookies without a SameSite attribute as
+	// SameSite=Lax, as Chrome does. Otherwise they are sent with
+	// cross-site requests, as with SameSite=None.
+	LaxByDefault bool
+
+	// MaxCookiesPerDomain limits the cookies kept for a registrable
+	// domain, like example.com and its subdomains together. When a new
+	// cookie goes over the limit, the jar evicts cookies of low
+	// Priority first, then insecure ones, then the least recently
+	// used. Zero means DefaultMaxCookiesPerDomain, and a negative value
+	// means no limit.
+	MaxCookiesPerDomain int
 }
 
+// DefaultMaxCookiesPerDomain is Chrome's limit on the cookies of a
+// registrable domain.
+const DefaultMaxCookiesPerDomain = 180
+
 // Jar implements the http.CookieJar interface from the net/http package.
 type Jar struct {
 	psList PublicSuffixList
 
+	// filename and fileFormat are the file backing the jar, if any.
+	// fileMu serializes Flush, from taking the snapshot of the
+	// cookies to renaming the file into place.
+	filename   string
+	fileFormat Format
+	fileMu     sync.Mutex
+	errorLog   *log.Logger
+
+	laxByDefault bool
+	maxPerDomain int // or negative for none
+
 	// mu locks the remaining fields.
 	mu sync.Mutex
 
 	// entries is a set of entries, keyed by their eTLD+1 and subkeyed by
 	// their name/domain/path.
-	entries map[string]map[string]entry
+	entries map[string]map[string]Entry
 
 	// nextSeqNum is the next sequence number assigned to a new cookie
 	// created SetCookies.
@@ -75,21 +122,43 @@ type Jar struct {
 
 // New returns a new cookie jar. A nil *Options is equivalent to a zero
 // Options.
+//
+// New returns an error if o names a file that cannot be loaded.
 func New(o *Options) (*Jar, error) {
 	jar := &Jar{
-		entries: make(map[string]map[string]entry),
+		entries:      make(map[string]map[string]Entry),
+		maxPerDomain: DefaultMaxCookiesPerDomain,
 	}
 	if o != nil {
 		jar.psList = o.PublicSuffixList
+		jar.filename = o.Filename
+		jar.fileFormat = o.FileFormat
+		jar.errorLog = o.ErrorLog
+		jar.laxByDefault = o.LaxByDefault
+		if o.MaxCookiesPerDomain != 0 {
+			jar.maxPerDomain = o.MaxCookiesPerDomain
+		}
+	}
+	if jar.filename != "" {
+		if err := jar.loadFile(); err != nil {
+			return nil, err
+		}
 	}
 	return jar, nil
 }
 
-// entry is the internal representation of a cookie.
+// An Entry is a cookie stored in a Jar, with the fields of RFC 6265
+// section 5.3. Domain is canonical, without a leading dot, and HostOnly
+// reports whether the cookie is sent to Domain alone rather than also
+// to its subdomains. Session cookies, which aren't Persistent, expire
+// at the end of time. SameSite is empty or a SameSite attribute as
+// written in a Set-Cookie header, like "SameSite=Lax".
 //
-// This struct type is not used outside of this package per se, but the exported
-// fields are those of RFC 6265.
-type entry struct {
+// Partition is the top-level site, like "https://example.com", a
+// Partitioned cookie was set under and is only sent under. It is empty
+// for unpartitioned cookies. Priority is "Low", "Medium", "High" or
+// empty, which is Medium.
+type Entry struct {
 	Name       string
 	Value      string
 	Domain     string
@@ -102,6 +171,8 @@ type entry struct {
 	Expires    time.Time
 	Creation   time.Time
 	LastAccess time.Time
+	Partition  string
+	Priority   string
 
 	// seqNum is a sequence number so that Cookies returns cookies in a
 	// deterministic order, even for cookies that have equal Path length and
@@ -109,20 +180,24 @@ type entry struct {
 	seqNum uint64
 }
 
-// id returns the domain;path;name triple of e as an id.
-func (e *entry) id() string {
+// id returns the domain;path;name triple of e as an id, followed by
+// the partition of a partitioned cookie.
+func (e *Entry) id() string {
+	if e.Partition != "" {
+		return fmt.Sprintf("%s;%s;%s;%s", e.Domain, e.Path, e.Name, e.Partition)
+	}
 	return fmt.Sprintf("%s;%s;%s", e.Domain, e.Path, e.Name)
 }
 
 // shouldSend determines whether e's cookie qualifies to be included in a
 // request to host/path. It is the caller's responsibility to check if the
 // cookie is expired.
-func (e *entry) shouldSend(https bool, host, path string) bool {
+func (e *Entry) shouldSend(https bool, host, path string) bool {
 	return e.domainMatch(host) && e.pathMatch(path) && (https || !e.Secure)
 }
 
 // domainMatch implements "domain-match" of RFC 6265 section 5.1.3.
-func (e *entry) domainMatch(host string) bool {
+func (e *Entry) domainMatch(host string) bool {
 	if e.Domain == host {
 		return true
 	}
@@ -130,7 +205,7 @@ func (e *entry) domainMatch(host string) bool {
 }
 
 // pathMatch implements "path-match" according to RFC 6265 section 5.1.4.
-func (e *entry) pathMatch(requestPath string) bool {
+func (e *Entry) pathMatch(requestPath string) bool {
 	if requestPath == e.Path {
 		return true
 	}
@@ -150,14 +225,29 @@ func hasDotSuffix(s, suffix string) bool {
 }
 
 // Cookies implements the Cookies method of the http.CookieJar interface.
+// It treats the request as a same-site top-level navigation. The
+// cookies have their Path set, for http.CookieOrderBrowser.
 //
 // It returns an empty slice if the URL's scheme is not HTTP or HTTPS.
 func (j *Jar) Cookies(u *url.URL) (cookies []*http.Cookie) {
 	return j.cookies(u, time.Now())
 }
 
+// RequestCookies implements the RequestCookies method of the
+// http.RequestCookieJar interface. It is like Cookies, but withholds
+// SameSite cookies and cookies of other partitions according to the
+// http.CookieSite in req's context.
+func (j *Jar) RequestCookies(req *http.Request) []*http.Cookie {
+	return j.cookiesFor(req.URL, j.requestContext(req), time.Now())
+}
+
 // cookies is like Cookies but takes the current time as a parameter.
 func (j *Jar) cookies(u *url.URL, now time.Time) (cookies []*http.Cookie) {
+	return j.cookiesFor(u, j.directContext(u), now)
+}
+
+// cookiesFor is like cookies for a request made in context rc.
+func (j *Jar) cookiesFor(u *url.URL, rc reqContext, now time.Time) (cookies []*http.Cookie) {
 	if u.Scheme != "http" && u.Scheme != "https" {
 		return cookies
 	}
@@ -182,14 +272,14 @@ func (j *Jar) cookies(u *url.URL, now time.Time) (cookies []*http.Cookie) {
 	}
 
 	modified := false
-	var selected []entry
+	var selected []Entry
 	for id, e := range submap {
 		if e.Persistent && !e.Expires.After(now) {
 			delete(submap, id)
 			modified = true
 			continue
 		}
-		if !e.shouldSend(https, host, path) {
+		if !e.shouldSend(https, host, path) || !j.allowed(&e, rc) {
 			continue
 		}
 		e.LastAccess = now
@@ -218,7 +308,7 @@ func (j *Jar) cookies(u *url.URL, now time.Time) (cookies []*http.Cookie) {
 		return s[i].seqNum < s[j].seqNum
 	})
 	for _, e := range selected {
-		cookies = append(cookies, &http.Cookie{Name: e.Name, Value: e.Value})
+		cookies = append(cookies, &http.Cookie{Name: e.Name, Value: e.Value, Path: e.Path})
 	}
 
 	return cookies
@@ -227,21 +317,41 @@ func (j *Jar) cookies(u *url.URL, now time.Time) (cookies []*http.Cookie) {
 // SetCookies implements the SetCookies method of the http.CookieJar interface.
 //
 // It does nothing if the URL's scheme is not HTTP or HTTPS.
+// It treats the response as one to a same-site top-level navigation.
 func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
-	j.setCookies(u, cookies, time.Now())
+	if j.setCookies(u, cookies, time.Now()) {
+		j.flush()
+	}
+}
+
+// SetRequestCookies implements the SetRequestCookies method of the
+// http.RequestCookieJar interface. It is like SetCookies, but rejects
+// SameSite cookies and partitions cookies according to the
+// http.CookieSite in req's context.
+func (j *Jar) SetRequestCookies(req *http.Request, cookies []*http.Cookie) {
+	if j.setCookiesFor(req.URL, cookies, j.requestContext(req), time.Now()) {
+		j.flush()
+	}
 }
 
 // setCookies is like SetCookies but takes the current time as parameter.
-func (j *Jar) setCookies(u *url.URL, cookies []*http.Cookie, now time.Time) {
+// It reports whether the jar changed.
+func (j *Jar) setCookies(u *url.URL, cookies []*http.Cookie, now time.Time) (modified bool) {
+	return j.setCookiesFor(u, cookies, j.directContext(u), now)
+}
+
+// setCookiesFor is like setCookies for a response to a request made in
+// context rc.
+func (j *Jar) setCookiesFor(u *url.URL, cookies []*http.Cookie, rc reqContext, now time.Time) (modified bool) {
 	if len(cookies) == 0 {
-		return
+		return false
 	}
 	if u.Scheme != "http" && u.Scheme != "https" {
-		return
+		return false
 	}
 	host, err := canonicalHost(u.Host)
 	if err != nil {
-		return
+		return false
 	}
 	key := jarKey(host, j.psList)
 	defPath := defaultPath(u.Path)
@@ -251,9 +361,8 @@ func (j *Jar) setCookies(u *url.URL, cookies []*http.Cookie, now time.Time) {
 
 	submap := j.entries[key]
 
-	modified := false
 	for _, cookie := range cookies {
-		e, remove, err := j.newEntry(cookie, now, defPath, host)
+		e, remove, err := j.newEntry(cookie, now, defPath, host, u.Scheme == "https", rc)
 		if err != nil {
 			continue
 		}
@@ -268,7 +377,7 @@ func (j *Jar) setCookies(u *url.URL, cookies []*http.Cookie, now time.Time) {
 			continue
 		}
 		if submap == nil {
-			submap = make(map[string]entry)
+			submap = make(map[string]Entry)
 		}
 
 		if old, ok := submap[id]; ok {
@@ -282,6 +391,9 @@ func (j *Jar) setCookies(u *url.URL, cookies []*http.Cookie, now time.Time) {
 		e.LastAccess = now
 		submap[id] = e
 		modified = true
+		if j.maxPerDomain > 0 && len(submap) > j.maxPerDomain {
+			j.evict(submap, now)
+		}
 	}
 
 	if modified {
@@ -291,6 +403,86 @@ func (j *Jar) setCookies(u *url.URL, cookies []*http.Cookie, now time.Time) {
 			j.entries[key] = submap
 		}
 	}
+	return modified
+}
+
+// All returns the cookies in j, oldest first. Expired cookies are left
+// out.
+func (j *Jar) All() []Entry {
+	return j.snapshot(time.Now())
+}
+
+// Remove deletes the cookie with the given domain, path and name from
+// j, in every partition, and reports whether there was one. A leading dot on domain is
+// ignored, as both host-only and domain cookies are stored by their
+// bare domain.
+func (j *Jar) Remove(domain, path, name string) bool {
+	domain, err := canonicalDomain(strings.TrimPrefix(domain, "."))
+	if err != nil {
+		return false
+	}
+	key := jarKey(domain, j.psList)
+
+	j.mu.Lock()
+	ok := false
+	submap := j.entries[key]
+	for id, e := range submap {
+		if e.Domain == domain && e.Path == path && e.Name == name {
+			delete(submap, id)
+			ok = true
+		}
+	}
+	if ok && len(submap) == 0 {
+		delete(j.entries, key)
+	}
+	j.mu.Unlock()
+
+	if ok {
+		j.flush()
+	}
+	return ok
+}
+
+// RemoveDomain deletes the cookies of domain and its subdomains from j,
+// and returns how many there were. Removing "example.com" removes the
+// cookies of "www.example.com" too.
+func (j *Jar) RemoveDomain(domain string) int {
+	domain, err := canonicalDomain(strings.TrimPrefix(domain, "."))
+	if err != nil {
+		return 0
+	}
+	key := jarKey(domain, j.psList)
+
+	j.mu.Lock()
+	n := 0
+	submap := j.entries[key]
+	for id, e := range submap {
+		if e.Domain == domain || hasDotSuffix(e.Domain, domain) {
+			delete(submap, id)
+			n++
+		}
+	}
+	if submap != nil && len(submap) == 0 {
+		delete(j.entries, key)
+	}
+	j.mu.Unlock()
+
+	if n > 0 {
+		j.flush()
+	}
+	return n
+}
+
+// Clear deletes all cookies from j.
+func (j *Jar) Clear() {
+	j.mu.Lock()
+	n := len(j.entries)
+	j.entries = make(map[string]map[string]Entry)
+	j.mu.Unlock()
+
+	if n > 0 {
+		j.flush()
+	}
 }
 
 // canonicalHost strips port from host if present and returns the canonicalized
@@ -376,27 +568,66 @@ func defaultPath(path string) string {
 
 // newEntry creates an entry from a http.Cookie c. now is the current time and
 // is compared to c.Expires to determine deletion of c. defPath and host are the
-// default-path and the canonical host name of the URL c was received from.
+// default-path and the canonical host name of the URL c was received from,
+// https whether it was secure, and rc the context of the request.
 //
 // remove records whether the jar should delete this cookie, as it has already
 // expired with respect to now. In this case, e may be incomplete, but it will
-// be valid to call e.id (which depends on e's Name, Domain and Path).
+// be valid to call e.id (which depends on e's Name, Domain, Path and
+// Partition).
 //
-// A malformed c.Domain will result in an error.
-func (j *Jar) newEntry(c *http.Cookie, now time.Time, defPath, host string) (e entry, remove bool, err error) {
+// A malformed c.Domain, or a cookie that RFC 6265bis says to ignore,
+// will result in an error.
+func (j *Jar) newEntry(c *http.Cookie, now time.Time, defPath, host string, https bool, rc reqContext) (e Entry, remove bool, err error) {
+	if len(c.Name)+len(c.Value) > maxNameValueSize {
+		return e, false, errTooLarge
+	}
 	e.Name = c.Name
 
-	if c.Path == "" || c.Path[0] != '/' {
+	// Attribute values over maxAttrSize are ignored.
+	if c.Path == "" || c.Path[0] != '/' || len(c.Path) > maxAttrSize {
 		e.Path = defPath
 	} else {
 		e.Path = c.Path
 	}
 
-	e.Domain, e.HostOnly, err = j.domainAndType(host, c.Domain)
+	domain := c.Domain
+	if len(domain) > maxAttrSize {
+		domain = ""
+	}
+	e.Domain, e.HostOnly, err = j.domainAndType(host, domain)
 	if err != nil {
 		return e, false, err
 	}
 
+	if err := checkPrefix(c, https, domain, e.Path); err != nil {
+		return e, false, err
+	}
+
+	switch c.SameSite {
+	case http.SameSiteDefaultMode:
+		e.SameSite = "SameSite"
+	case http.SameSiteStrictMode:
+		e.SameSite = "SameSite=Strict"
+	case http.SameSiteLaxMode:
+		e.SameSite = "SameSite=Lax"
+	case http.SameSiteNoneMode:
+		if !c.Secure {
+			return e, false, errInsecureSameSiteNone
+		}
+		e.SameSite = "SameSite=None"
+	}
+	if j.sameSiteMode(&e) != http.SameSiteNoneMode && !rc.sameSite && !rc.navigation {
+		return e, false, errCrossSite
+	}
+
+	if c.Partitioned {
+		if !c.Secure {
+			return e, false, errInsecurePartitioned
+		}
+		e.Partition = rc.partition
+	}
+
 	// MaxAge takes precedence over Expires.
 	if c.MaxAge < 0 {
 		return e, true, nil
@@ -420,13 +651,13 @@ func (j *Jar) newEntry(c *http.Cookie, now time.Time, defPath, host string) (e e
 	e.Secure = c.Secure
 	e.HttpOnly = c.HttpOnly
 
-	switch c.SameSite {
-	case http.SameSiteDefaultMode:
-		e.SameSite = "SameSite"
-	case http.SameSiteStrictMode:
-		e.SameSite = "SameSite=Strict"
-	case http.SameSiteLaxMode:
-		e.SameSite = "SameSite=Lax"
+	switch c.Priority {
+	case http.CookiePriorityLow:
+		e.Priority = "Low"
+	case http.CookiePriorityMedium:
+		e.Priority = "Medium"
+	case http.CookiePriorityHigh:
+		e.Priority = "High"
 	}
 
 	return e, false, nil
@@ -436,6 +667,19 @@ var (
 	errIllegalDomain   = errors.New("cookiejar: illegal cookie domain attribute")
 	errMalformedDomain = errors.New("cookiejar: malformed cookie domain attribute")
 	errNoHostname      = errors.New("cookiejar: no host name available (IP only)")
+
+	errTooLarge             = errors.New("cookiejar: cookie name and value too large")
+	errPrefix               = errors.New("cookiejar: cookie breaks the rules of its name prefix")
+	errInsecureSameSiteNone = errors.New("cookiejar: SameSite=None cookie without Secure")
+	errInsecurePartitioned  = errors.New("cookiejar: Partitioned cookie without Secure")
+	errCrossSite            = errors.New("cookiejar: SameSite cookie set by a cross-site request")
+)
+
+// Size limits of RFC 6265bis section 5.6: cookies with a longer name
+// and value are ignored, and so are longer attribute values.
+const (
+	maxNameValueSize = 4096
+	maxAttrSize      = 1024
 )
 
 // endOfTime is the time when session (non-persistent) cookies expire.
@@ -1321,3 +1321,68 @@ func TestIssue19384(t *testing.T) {
 		}
 	}
 }
+
+// entryIDs returns the ids of entries.
+func entryIDs(entries []Entry) string {
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.id())
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestAllAndRemove(t *testing.T) {
+	jar := newTestJar()
+	set := func(u string, cookies ...string) {
+		var cs []*http.Cookie
+		for _, c := range cookies {
+			cs = append(cs, (&http.Response{Header: http.Header{"Set-Cookie": {c}}}).Cookies()...)
+		}
+		jar.SetCookies(mustParseURL(u), cs)
+	}
+	set("http://www.host.test/", "a=1", "b=2; domain=host.test", "gone=1; max-age=3600")
+	set("http://other.host.test/dir/", "c=3; secure; httponly")
+	set("http://www.google.com/", "d=4")
+
+	all := jar.All()
+	want := "www.host.test;/;a host.test;/;b www.host.test;/;gone other.host.test;/dir;c www.google.com;/;d"
+	if got := entryIDs(all); got != want {
+		t.Errorf("All = %q; want %q", got, want)
+	}
+	if c := all[3]; c.Value != "3" || !c.Secure || !c.HttpOnly || !c.HostOnly || c.Persistent {
+		t.Errorf("All()[3] = %+v", c)
+	}
+	if b := all[1]; b.HostOnly {
+		t.Errorf("All()[1] = %+v; want a domain cookie", b)
+	}
+
+	if !jar.Remove("www.host.test", "/", "gone") {
+		t.Error("Remove of a stored cookie reported false")
+	}
+	if jar.Remove("www.host.test", "/", "gone") {
+		t.Error("Remove of a missing cookie reported true")
+	}
+	if !jar.Remove(".HOST.test", "/", "b") {
+		t.Error("Remove of a domain cookie by dotted domain reported false")
+	}
+	want = "www.host.test;/;a other.host.test;/dir;c www.google.com;/;d"
+	if got := entryIDs(jar.All()); got != want {
+		t.Errorf("after Remove, All = %q; want %q", got, want)
+	}
+
+	if n := jar.RemoveDomain("host.test"); n != 2 {
+		t.Errorf("RemoveDomain removed %d cookies; want 2", n)
+	}
+	want = "www.google.com;/;d"
+	if got := entryIDs(jar.All()); got != want {
+		t.Errorf("after RemoveDomain, All = %q; want %q", got, want)
+	}
+
+	jar.Clear()
+	if got := jar.All(); len(got) != 0 {
+		t.Errorf("after Clear, All = %v", got)
+	}
+	if got := jar.Cookies(mustParseURL("http://www.google.com/")); len(got) != 0 {
+		t.Errorf("after Clear, Cookies = %v", got)
+	}
+}
@@ -0,0 +1,383 @@
+package cookiejar
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	http "github.com/useflyent/fhttp"
+)
+
+// A Format is a file format for the cookies of a Jar.
+type Format int
+
+const (
+	// FormatJSON is a JSON array of cookies. It keeps every attribute
+	// the jar tracks, including creation and last-access times, so that
+	// loading it restores the jar exactly.
+	FormatJSON Format = iota
+
+	// FormatNetscape is the cookies.txt format of Netscape, read and
+	// written by curl and wget: one tab-separated line per cookie, with
+	// HttpOnly cookies behind a "#HttpOnly_" domain prefix. It has no
+	// SameSite attribute or creation and last-access times; cookies
+	// loaded from it are created at load time. Partitioned cookies
+	// are left out.
+	FormatNetscape
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "JSON"
+	case FormatNetscape:
+		return "Netscape"
+	}
+	return "Format(" + strconv.Itoa(int(f)) + ")"
+}
+
+const netscapeHeader = "# Netscape HTTP Cookie File"
+
+const netscapeHttpOnlyPrefix = "#HttpOnly_"
+
+var (
+	errUnknownFormat  = errors.New("cookiejar: unknown format")
+	errMalformedEntry = errors.New("cookiejar: malformed cookie path, domain or SameSite")
+)
+
+// Save writes the cookies in j to w in format f, oldest first. Session
+// cookies are written as well; expired cookies are not.
+func (j *Jar) Save(w io.Writer, f Format) error {
+	entries := j.snapshot(time.Now())
+	switch f {
+	case FormatJSON:
+		if entries == nil {
+			entries = []Entry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(entries)
+	case FormatNetscape:
+		bw := bufio.NewWriter(w)
+		fmt.Fprintln(bw, netscapeHeader)
+		for _, e := range entries {
+			if e.Partition != "" {
+				// There is no way to mark partitioned cookies.
+				continue
+			}
+			writeNetscapeLine(bw, &e)
+		}
+		return bw.Flush()
+	}
+	return errUnknownFormat
+}
+
+// snapshot returns the unexpired entries of j in creation order.
+func (j *Jar) snapshot(now time.Time) []Entry {
+	j.mu.Lock()
+	var entries []Entry
+	for _, submap := range j.entries {
+		for _, e := range submap {
+			if e.Persistent && !e.Expires.After(now) {
+				continue
+			}
+			entries = append(entries, e)
+		}
+	}
+	j.mu.Unlock()
+
+	sort.Slice(entries, func(i, k int) bool {
+		s := entries
+		if !s[i].Creation.Equal(s[k].Creation) {
+			return s[i].Creation.Before(s[k].Creation)
+		}
+		return s[i].seqNum < s[k].seqNum
+	})
+	return entries
+}
+
+func writeNetscapeLine(w io.Writer, e *Entry) {
+	domain, subdomains := e.Domain, "FALSE"
+	if !e.HostOnly {
+		domain, subdomains = "."+domain, "TRUE"
+	}
+	if e.HttpOnly {
+		domain = netscapeHttpOnlyPrefix + domain
+	}
+	secure := "FALSE"
+	if e.Secure {
+		secure = "TRUE"
+	}
+	var expires int64
+	if e.Persistent {
+		expires = e.Expires.Unix()
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+		domain, subdomains, e.Path, secure, expires, e.Name, e.Value)
+}
+
+// Load reads cookies in format f from r and adds them to j, replacing
+// cookies with the same domain, path and name. Cookies that have
+// expired are skipped, and so are cookies SetCookies would reject,
+// such as ones that are too large or break the rules of their name
+// prefix. Domains over the jar's MaxCookiesPerDomain are evicted as
+// by SetCookies. If r is malformed, Load returns an error and leaves
+// j unchanged. A jar with a file writes it after a successful Load.
+func (j *Jar) Load(r io.Reader, f Format) error {
+	if err := j.load(r, f); err != nil {
+		return err
+	}
+	if j.filename != "" {
+		j.flush()
+	}
+	return nil
+}
+
+// load is Load without writing j's file.
+func (j *Jar) load(r io.Reader, f Format) error {
+	now := time.Now()
+	var entries []Entry
+	var err error
+	switch f {
+	case FormatJSON:
+		entries, err = readJSON(r)
+	case FormatNetscape:
+		entries, err = readNetscape(r, now)
+	default:
+		err = errUnknownFormat
+	}
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	touched := make(map[string]bool)
+	for _, e := range entries {
+		if e.Persistent && !e.Expires.After(now) {
+			continue
+		}
+		if j.checkLoaded(&e) != nil {
+			continue
+		}
+		key := jarKey(e.Domain, j.psList)
+		submap := j.entries[key]
+		if submap == nil {
+			submap = make(map[string]Entry)
+			j.entries[key] = submap
+		}
+		e.seqNum = j.nextSeqNum
+		j.nextSeqNum++
+		submap[e.id()] = e
+		touched[key] = true
+	}
+	if j.maxPerDomain > 0 {
+		for key := range touched {
+			if submap := j.entries[key]; len(submap) > j.maxPerDomain {
+				j.evict(submap, now)
+			}
+		}
+	}
+	return nil
+}
+
+// checkLoaded applies the rules newEntry enforces on cookies set by a
+// response to a loaded cookie, normalizing its domain and attributes.
+// Cookies for a public suffix become host-only, as in domainAndType.
+func (j *Jar) checkLoaded(e *Entry) error {
+	if len(e.Name)+len(e.Value) > maxNameValueSize {
+		return errTooLarge
+	}
+	if e.Path == "" || e.Path[0] != '/' || len(e.Path) > maxAttrSize || len(e.Domain) > maxAttrSize {
+		return errMalformedEntry
+	}
+
+	var domain string
+	if !e.HostOnly {
+		domain = e.Domain
+	}
+	var err error
+	e.Domain, e.HostOnly, err = j.domainAndType(e.Domain, domain)
+	if err != nil {
+		return err
+	}
+	if e.HostOnly {
+		domain = ""
+	}
+
+	// A Secure cookie can only have been set over HTTPS.
+	c := &http.Cookie{Name: e.Name, Secure: e.Secure}
+	if err := checkPrefix(c, e.Secure, domain, e.Path); err != nil {
+		return err
+	}
+
+	switch e.SameSite {
+	case "", "SameSite", "SameSite=Strict", "SameSite=Lax":
+	case "SameSite=None":
+		if !e.Secure {
+			return errInsecureSameSiteNone
+		}
+	default:
+		return errMalformedEntry
+	}
+	if e.Partition != "" && !e.Secure {
+		return errInsecurePartitioned
+	}
+	if _, ok := priorityRank[e.Priority]; !ok {
+		e.Priority = ""
+	}
+	return nil
+}
+
+func readJSON(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("cookiejar: malformed JSON: %v", err)
+	}
+	for i := range entries {
+		e := &entries[i]
+		domain, err := canonicalDomain(e.Domain)
+		if err != nil {
+			return nil, fmt.Errorf("cookiejar: cookie %d: %v", i, err)
+		}
+		e.Domain = domain
+		if e.Path == "" || e.Path[0] != '/' {
+			return nil, fmt.Errorf("cookiejar: cookie %d: malformed path %q", i, e.Path)
+		}
+		if !e.Persistent {
+			e.Expires = endOfTime
+		}
+	}
+	return entries, nil
+}
+
+func readNetscape(r io.Reader, now time.Time) ([]Entry, error) {
+	var entries []Entry
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		var e Entry
+		if strings.HasPrefix(line, netscapeHttpOnlyPrefix) {
+			line = line[len(netscapeHttpOnlyPrefix):]
+			e.HttpOnly = true
+		} else if line == "" || line[0] == '#' {
+			continue
+		}
+
+		f := strings.Split(line, "\t")
+		if len(f) == 6 {
+			// The tab before an empty value is often trimmed.
+			f = append(f, "")
+		}
+		if len(f) != 7 {
+			return nil, fmt.Errorf("cookiejar: line %d: want 7 fields, got %d", n, len(f))
+		}
+		domain := f[0]
+		e.HostOnly = f[1] != "TRUE" && !strings.HasPrefix(domain, ".")
+		domain, err := canonicalDomain(strings.TrimPrefix(domain, "."))
+		if err != nil {
+			return nil, fmt.Errorf("cookiejar: line %d: %v", n, err)
+		}
+		e.Domain = domain
+		e.Path = f[2]
+		if e.Path == "" || e.Path[0] != '/' {
+			return nil, fmt.Errorf("cookiejar: line %d: malformed path %q", n, e.Path)
+		}
+		e.Secure = f[3] == "TRUE"
+		expires, err := strconv.ParseInt(f[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cookiejar: line %d: malformed expiry %q", n, f[4])
+		}
+		if expires == 0 {
+			e.Expires = endOfTime
+		} else {
+			e.Expires = time.Unix(expires, 0).UTC()
+			e.Persistent = true
+		}
+		e.Name, e.Value = f[5], f[6]
+		e.Creation, e.LastAccess = now, now
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// canonicalDomain canonicalizes a cookie domain given to Load or
+// Remove.
+func canonicalDomain(domain string) (string, error) {
+	if domain == "" || domain[0] == '.' || domain[len(domain)-1] == '.' {
+		return "", fmt.Errorf("malformed domain %q", domain)
+	}
+	return toASCII(strings.ToLower(domain))
+}
+
+// loadFile fills j from the file named in its Options. A missing file
+// is an empty jar.
+func (j *Jar) loadFile() error {
+	f, err := os.Open(j.filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return j.load(f, j.fileFormat)
+}
+
+// Flush writes the cookies in j to its file, replacing it. The jar
+// already does so after each change to its cookies, but ignores errors
+// doing so, and doesn't write for updated last-access times alone.
+// Flush does nothing if j has no file.
+//
+// Concurrent Flushes are serialized, each taking its snapshot of the
+// cookies and renaming it into place under the same lock, so the file
+// never ends up older than the last change flushed.
+func (j *Jar) Flush() error {
+	if j.filename == "" {
+		return nil
+	}
+	j.fileMu.Lock()
+	defer j.fileMu.Unlock()
+
+	// Write a new file and rename it over the old one, so that a
+	// crash never leaves a partial file behind.
+	f, err := os.CreateTemp(filepath.Dir(j.filename), filepath.Base(j.filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	err = j.Save(f, j.fileFormat)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), j.filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// flush calls Flush after a change, logging its error, since the
+// methods making changes have no error to return.
+func (j *Jar) flush() {
+	if err := j.Flush(); err != nil {
+		if j.errorLog != nil {
+			j.errorLog.Printf("cookiejar: writing %s: %v", j.filename, err)
+		} else {
+			log.Printf("cookiejar: writing %s: %v", j.filename, err)
+		}
+	}
+}
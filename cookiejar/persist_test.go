@@ -0,0 +1,348 @@
+package cookiejar
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	http "github.com/useflyent/fhttp"
+)
+
+// persistNow is late enough that the cookies set at it are read as
+// recent by Load, which compares expiry times to the real time.
+var persistNow = time.Now().UTC().Truncate(time.Second)
+
+// fillPersistJar sets a mix of cookies on jar.
+func fillPersistJar(jar *Jar) {
+	set := func(u string, lines ...string) {
+		var cookies []*http.Cookie
+		for _, line := range lines {
+			cookies = append(cookies, (&http.Response{Header: http.Header{"Set-Cookie": {line}}}).Cookies()...)
+		}
+		jar.setCookies(mustParseURL(u), cookies, persistNow)
+	}
+	set("https://www.host.test/some/path",
+		"session=1",
+		"domain=2; domain=host.test; path=/; max-age=3600",
+		"secure=3; secure; httponly; samesite=strict",
+	)
+	set("http://www.google.com/", "pref=x; max-age=7200; samesite=lax")
+}
+
+// jarEntries returns the entries of jar, keyed by id.
+func jarEntries(jar *Jar) map[string]Entry {
+	m := make(map[string]Entry)
+	for _, submap := range jar.entries {
+		for id, e := range submap {
+			e.seqNum = 0
+			m[id] = e
+		}
+	}
+	return m
+}
+
+func TestSaveLoadJSON(t *testing.T) {
+	jar := newTestJar()
+	fillPersistJar(jar)
+
+	var buf bytes.Buffer
+	if err := jar.Save(&buf, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newTestJar()
+	if err := loaded.Load(&buf, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := jarEntries(loaded), jarEntries(jar); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded entries\ngot  %+v\nwant %+v", got, want)
+	}
+
+	u := mustParseURL("https://www.host.test/some/path")
+	now := persistNow.Add(time.Second)
+	if got, want := loaded.cookies(u, now), jar.cookies(u, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded cookies = %v; want %v", got, want)
+	}
+}
+
+func TestSaveNetscape(t *testing.T) {
+	jar := newTestJar()
+	fillPersistJar(jar)
+
+	var buf bytes.Buffer
+	if err := jar.Save(&buf, FormatNetscape); err != nil {
+		t.Fatal(err)
+	}
+	exp1 := persistNow.Add(time.Hour).Unix()
+	exp2 := persistNow.Add(2 * time.Hour).Unix()
+	want := netscapeHeader + "\n" +
+		"www.host.test\tFALSE\t/some\tFALSE\t0\tsession\t1\n" +
+		".host.test\tTRUE\t/\tFALSE\t" + strconv.FormatInt(exp1, 10) + "\tdomain\t2\n" +
+		"#HttpOnly_www.host.test\tFALSE\t/some\tTRUE\t0\tsecure\t3\n" +
+		"www.google.com\tFALSE\t/\tFALSE\t" + strconv.FormatInt(exp2, 10) + "\tpref\tx\n"
+	if got := buf.String(); got != want {
+		t.Errorf("saved\n%s\nwant\n%s", got, want)
+	}
+
+	loaded := newTestJar()
+	if err := loaded.Load(&buf, FormatNetscape); err != nil {
+		t.Fatal(err)
+	}
+	got, want2 := jarEntries(loaded), jarEntries(jar)
+	for id, e := range want2 {
+		// Netscape files lose SameSite and the creation times.
+		e.SameSite = ""
+		e.Creation, e.LastAccess = got[id].Creation, got[id].LastAccess
+		want2[id] = e
+	}
+	if !reflect.DeepEqual(got, want2) {
+		t.Errorf("loaded entries\ngot  %+v\nwant %+v", got, want2)
+	}
+}
+
+func TestLoadNetscapeCurl(t *testing.T) {
+	const file = `# Netscape HTTP Cookie File
+# https://curl.se/docs/http-cookies.html
+# This file was generated by libcurl! Edit at your own risk.
+
+.Example.COM	TRUE	/	TRUE	0	a	1
+#HttpOnly_example.com	FALSE	/app	FALSE	0	b
+example.com	FALSE	/	FALSE	1	expired	x
+`
+	jar := newTestJar()
+	if err := jar.Load(strings.NewReader(file), FormatNetscape); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for id, e := range jarEntries(jar) {
+		got = append(got, id+" "+e.Value)
+		if e.Name == "a" && (e.HostOnly || !e.Secure || e.Persistent) {
+			t.Errorf("cookie a = %+v", e)
+		}
+		if e.Name == "b" && (!e.HostOnly || !e.HttpOnly) {
+			t.Errorf("cookie b = %+v", e)
+		}
+	}
+	sort.Strings(got)
+	want := []string{"example.com;/;a 1", "example.com;/app;b "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %q; want %q", got, want)
+	}
+}
+
+func TestLoadMalformed(t *testing.T) {
+	tests := []struct {
+		f    Format
+		data string
+	}{
+		{FormatNetscape, "example.com\tFALSE\t/\tFALSE\t0\n"},
+		{FormatNetscape, "example.com\tFALSE\t/\tFALSE\tsoon\tname\tvalue\n"},
+		{FormatNetscape, "example.com\tFALSE\tpath\tFALSE\t0\tname\tvalue\n"},
+		{FormatNetscape, ".\tTRUE\t/\tFALSE\t0\tname\tvalue\n"},
+		{FormatJSON, `{"Name": "a"}`},
+		{FormatJSON, `[{"Name": "a", "Domain": "", "Path": "/"}]`},
+		{Format(7), ""},
+	}
+	for i, tt := range tests {
+		jar := newTestJar()
+		good := "example.com\tFALSE\t/\tFALSE\t0\tgood\t1\n"
+		if tt.f == FormatNetscape {
+			tt.data = good + tt.data
+		}
+		if err := jar.Load(strings.NewReader(tt.data), tt.f); err == nil {
+			t.Errorf("%d. Load(%q, %v) succeeded", i, tt.data, tt.f)
+		}
+		if len(jar.entries) != 0 {
+			t.Errorf("%d. Load(%q, %v) left %d keys in the jar", i, tt.data, tt.f, len(jar.entries))
+		}
+	}
+}
+
+func TestLoadValidates(t *testing.T) {
+	host := func(name string) Entry {
+		return Entry{Name: name, Value: "v", Domain: "www.host.test", Path: "/", HostOnly: true, Secure: true}
+	}
+	valid := host("valid")
+	hostPrefix := host("__Host-ok")
+	insecureHost := host("__Host-insecure")
+	insecureHost.Secure = false
+	domainHost := host("__Host-domain")
+	domainHost.HostOnly, domainHost.Domain = false, "host.test"
+	insecureNone := host("none")
+	insecureNone.SameSite, insecureNone.Secure = "SameSite=None", false
+	badSameSite := host("samesite")
+	badSameSite.SameSite = "SameSite=Bogus"
+	insecurePartitioned := host("partitioned")
+	insecurePartitioned.Partition, insecurePartitioned.Secure = "https://top.test", false
+	tooLarge := host("large")
+	tooLarge.Value = strings.Repeat("x", maxNameValueSize)
+	badPath := host("path")
+	badPath.Path = "/" + strings.Repeat("p", maxAttrSize)
+	suffix := host("suffix")
+	suffix.Domain, suffix.HostOnly = "co.uk", false
+
+	data, err := json.Marshal([]Entry{valid, hostPrefix, insecureHost, domainHost, insecureNone,
+		badSameSite, insecurePartitioned, tooLarge, badPath, suffix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar := newTestJar()
+	if err := jar.Load(bytes.NewReader(data), FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range jar.All() {
+		got = append(got, e.Name+"@"+e.Domain+"/"+strconv.FormatBool(e.HostOnly))
+	}
+	sort.Strings(got)
+	want := []string{"__Host-ok@www.host.test/true", "suffix@co.uk/true", "valid@www.host.test/true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %v; want %v", got, want)
+	}
+}
+
+func TestLoadEvicts(t *testing.T) {
+	var entries []Entry
+	for i := 0; i < 5; i++ {
+		entries = append(entries, Entry{
+			Name:       "c" + strconv.Itoa(i),
+			Domain:     "www.host.test",
+			Path:       "/",
+			HostOnly:   true,
+			LastAccess: persistNow.Add(time.Duration(i) * time.Second),
+		})
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar, err := New(&Options{PublicSuffixList: testPSL{}, MaxCookiesPerDomain: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jar.Load(bytes.NewReader(data), FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range jar.All() {
+		got = append(got, e.Name)
+	}
+	sort.Strings(got)
+	if want := []string{"c2", "c3", "c4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %v; want the most recently used %v", got, want)
+	}
+}
+
+func TestFileJar(t *testing.T) {
+	for _, f := range []Format{FormatJSON, FormatNetscape} {
+		name := filepath.Join(t.TempDir(), "cookies")
+		o := &Options{PublicSuffixList: testPSL{}, Filename: name, FileFormat: f}
+		jar, err := New(o)
+		if err != nil {
+			t.Fatalf("%v: New with no file: %v", f, err)
+		}
+		u := mustParseURL("https://www.host.test/")
+		jar.SetCookies(u, []*http.Cookie{{Name: "a", Value: "1", MaxAge: 3600}})
+		if _, err := os.Stat(name); err != nil {
+			t.Fatalf("%v: SetCookies didn't write the file: %v", f, err)
+		}
+
+		jar2, err := New(o)
+		if err != nil {
+			t.Fatalf("%v: New: %v", f, err)
+		}
+		if got := jar2.Cookies(u); len(got) != 1 || got[0].Name != "a" || got[0].Value != "1" {
+			t.Errorf("%v: reopened jar has cookies %v", f, got)
+		}
+
+		jar2.SetCookies(u, []*http.Cookie{{Name: "a", MaxAge: -1}})
+		jar3, err := New(o)
+		if err != nil {
+			t.Fatalf("%v: New: %v", f, err)
+		}
+		if got := jar3.Cookies(u); len(got) != 0 {
+			t.Errorf("%v: deleted cookie still in file: %v", f, got)
+		}
+	}
+
+	name := filepath.Join(t.TempDir(), "cookies")
+	if err := os.WriteFile(name, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(&Options{Filename: name}); err == nil {
+		t.Error("New with a malformed file succeeded")
+	}
+}
+
+func TestFileJarLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cookies")
+	o := &Options{PublicSuffixList: testPSL{}, Filename: name}
+	jar, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "www.host.test\tFALSE\t/\tFALSE\t0\ta\t1\n"
+	if err := jar.Load(strings.NewReader(in), FormatNetscape); err != nil {
+		t.Fatal(err)
+	}
+	jar2, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := jar2.Cookies(mustParseURL("https://www.host.test/")); len(got) != 1 || got[0].Name != "a" {
+		t.Errorf("loaded cookies not written to the file; reopened jar has %v", got)
+	}
+}
+
+// Concurrent changes must leave the file with all of them, whatever
+// order their flushes run in.
+func TestFileJarConcurrentChanges(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cookies")
+	o := &Options{PublicSuffixList: testPSL{}, Filename: name}
+	jar, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := mustParseURL("https://www.host.test/")
+	const n = 20
+	done := make(chan bool)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			jar.SetCookies(u, []*http.Cookie{{Name: "c" + strconv.Itoa(i), Value: "1", MaxAge: 3600}})
+			done <- true
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		<-done
+	}
+	jar2, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := jar2.Cookies(u); len(got) != n {
+		t.Errorf("file has %d cookies; want %d", len(got), n)
+	}
+}
+
+func TestFileJarWriteError(t *testing.T) {
+	var buf bytes.Buffer
+	name := filepath.Join(t.TempDir(), "missing", "cookies")
+	jar, err := New(&Options{Filename: name, ErrorLog: log.New(&buf, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar.SetCookies(mustParseURL("https://www.host.test/"), []*http.Cookie{{Name: "a", Value: "1"}})
+	if got := buf.String(); !strings.HasPrefix(got, "cookiejar: writing "+name) {
+		t.Errorf("logged %q; want the write error", got)
+	}
+	if err := jar.Flush(); err == nil {
+		t.Error("Flush into a missing directory succeeded")
+	}
+}
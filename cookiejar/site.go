@@ -0,0 +1,156 @@
+package cookiejar
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	http "github.com/useflyent/fhttp"
+)
+
+// A reqContext is what the jar knows of where a request comes from,
+// as described by RFC 6265bis section 5.2.
+type reqContext struct {
+	sameSite   bool   // the request is same-site
+	navigation bool   // the request loads a top-level document
+	safe       bool   // the request method is safe
+	partition  string // the site of the top-level document
+}
+
+// directContext returns the context of a request to u made directly
+// by the user: a same-site top-level navigation.
+func (j *Jar) directContext(u *url.URL) reqContext {
+	return reqContext{
+		sameSite:   true,
+		navigation: true,
+		safe:       true,
+		partition:  j.site(u),
+	}
+}
+
+// requestContext returns the context of req, from the http.CookieSite
+// in its context.
+func (j *Jar) requestContext(req *http.Request) reqContext {
+	site, ok := http.CookieSiteFromContext(req.Context())
+	if !ok {
+		rc := j.directContext(req.URL)
+		rc.safe = isSafeMethod(req.Method)
+		return rc
+	}
+	target := j.site(req.URL)
+	rc := reqContext{
+		sameSite:   site.Initiator == nil || j.site(site.Initiator) == target,
+		navigation: site.Navigation,
+		safe:       isSafeMethod(req.Method),
+		partition:  target,
+	}
+	if site.TopLevel != nil && !site.Navigation {
+		rc.partition = j.site(site.TopLevel)
+		rc.sameSite = rc.sameSite && rc.partition == target
+	}
+	return rc
+}
+
+// site returns the schemeful site of u, its scheme and registrable
+// domain, like "https://example.com".
+func (j *Jar) site(u *url.URL) string {
+	host, err := canonicalHost(u.Host)
+	if err != nil {
+		host = u.Host
+	}
+	return u.Scheme + "://" + jarKey(host, j.psList)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// sameSiteMode returns the SameSite enforcement mode of e: Strict, Lax
+// or None.
+func (j *Jar) sameSiteMode(e *Entry) http.SameSite {
+	switch e.SameSite {
+	case "SameSite=Strict":
+		return http.SameSiteStrictMode
+	case "SameSite=Lax":
+		return http.SameSiteLaxMode
+	case "SameSite=None":
+		return http.SameSiteNoneMode
+	}
+	if j.laxByDefault {
+		return http.SameSiteLaxMode
+	}
+	return http.SameSiteNoneMode
+}
+
+// allowed reports whether e may be sent with a request made in context
+// rc, by its SameSite mode and partition.
+func (j *Jar) allowed(e *Entry, rc reqContext) bool {
+	if e.Partition != "" && e.Partition != rc.partition {
+		return false
+	}
+	switch j.sameSiteMode(e) {
+	case http.SameSiteStrictMode:
+		return rc.sameSite
+	case http.SameSiteLaxMode:
+		return rc.sameSite || rc.navigation && rc.safe
+	}
+	return true
+}
+
+// checkPrefix enforces the rules of the __Secure- and __Host- cookie
+// name prefixes of RFC 6265bis section 4.1.3. domain and path are the
+// cookie's Domain attribute and path.
+func checkPrefix(c *http.Cookie, https bool, domain, path string) error {
+	if hasPrefixFold(c.Name, "__Secure-") && !(c.Secure && https) {
+		return errPrefix
+	}
+	if hasPrefixFold(c.Name, "__Host-") && !(c.Secure && https && domain == "" && path == "/") {
+		return errPrefix
+	}
+	return nil
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// priorityRank orders cookie priorities for eviction, lowest first.
+var priorityRank = map[string]int{"Low": 0, "": 1, "Medium": 1, "High": 2}
+
+// evict deletes cookies from submap until it holds j.maxPerDomain of
+// them: expired cookies first, then as Chrome does, cookies of lower
+// priority, insecure cookies, and the least recently accessed.
+func (j *Jar) evict(submap map[string]Entry, now time.Time) {
+	var ids []string
+	for id, e := range submap {
+		if e.Persistent && !e.Expires.After(now) {
+			delete(submap, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) <= j.maxPerDomain {
+		return
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		x, y := submap[ids[a]], submap[ids[b]]
+		if px, py := priorityRank[x.Priority], priorityRank[y.Priority]; px != py {
+			return px < py
+		}
+		if x.Secure != y.Secure {
+			return !x.Secure
+		}
+		if !x.LastAccess.Equal(y.LastAccess) {
+			return x.LastAccess.Before(y.LastAccess)
+		}
+		return x.seqNum < y.seqNum
+	})
+	for _, id := range ids[:len(ids)-j.maxPerDomain] {
+		delete(submap, id)
+	}
+}
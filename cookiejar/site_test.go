@@ -0,0 +1,241 @@
+package cookiejar
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	http "github.com/useflyent/fhttp"
+)
+
+// siteRequest returns a request to rawurl made in the given context.
+func siteRequest(method, rawurl string, site *http.CookieSite) *http.Request {
+	req, err := http.NewRequest(method, rawurl, nil)
+	if err != nil {
+		panic(err)
+	}
+	if site != nil {
+		req = req.WithContext(http.WithCookieSite(req.Context(), *site))
+	}
+	return req
+}
+
+// setLines sets the Set-Cookie lines on jar in a response to req.
+func setLines(jar *Jar, req *http.Request, lines ...string) {
+	var cookies []*http.Cookie
+	for _, line := range lines {
+		cookies = append(cookies, (&http.Response{Header: http.Header{"Set-Cookie": {line}}}).Cookies()...)
+	}
+	jar.SetRequestCookies(req, cookies)
+}
+
+// cookieNames returns the names of the cookies jar sends with req,
+// sorted.
+func cookieNames(jar *Jar, req *http.Request) string {
+	var names []string
+	for _, c := range jar.RequestCookies(req) {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+func TestCookiePrefixes(t *testing.T) {
+	jar := newTestJar()
+	setLines(jar, siteRequest("GET", "https://www.host.test/dir/", nil),
+		"__Secure-ok=1; Secure",
+		"__secure-insecure=1",
+		"__Host-ok=1; Secure; Path=/",
+		"__Host-domain=1; Secure; Path=/; Domain=host.test",
+		"__Host-path=1; Secure",
+		"__HOST-insecure=1; Path=/",
+	)
+	setLines(jar, siteRequest("GET", "http://www.host.test/", nil),
+		"__Secure-http=1; Secure",
+		"__Host-http=1; Secure; Path=/",
+	)
+	want := "www.host.test;/;__Host-ok www.host.test;/dir;__Secure-ok"
+	var ids []string
+	for _, e := range jar.All() {
+		ids = append(ids, e.id())
+	}
+	sort.Strings(ids)
+	if got := strings.Join(ids, " "); got != want {
+		t.Errorf("stored %q; want %q", got, want)
+	}
+}
+
+func TestCookieRequiresSecure(t *testing.T) {
+	jar := newTestJar()
+	setLines(jar, siteRequest("GET", "https://www.host.test/", nil),
+		"none=1; SameSite=None",
+		"noneSecure=1; SameSite=None; Secure",
+		"chips=1; Partitioned",
+		"chipsSecure=1; Partitioned; Secure",
+		"big="+strings.Repeat("x", maxNameValueSize),
+	)
+	if got, want := cookieNames(jar, siteRequest("GET", "https://www.host.test/", nil)), "chipsSecure noneSecure"; got != want {
+		t.Errorf("cookies = %q; want %q", got, want)
+	}
+}
+
+func TestSameSite(t *testing.T) {
+	jar, err := New(&Options{PublicSuffixList: testPSL{}, LaxByDefault: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setLines(jar, siteRequest("GET", "https://www.host.test/", nil),
+		"strict=1; SameSite=Strict",
+		"lax=1; SameSite=Lax",
+		"none=1; SameSite=None; Secure",
+		"default=1",
+	)
+
+	page := mustParseURL("https://www.host.test/page")
+	other := mustParseURL("https://www.other.test/page")
+	tests := []struct {
+		desc   string
+		method string
+		url    string
+		site   *http.CookieSite
+		want   string
+	}{
+		{"no site", "POST", "https://www.host.test/", nil, "default lax none strict"},
+		{"Cookies", "", "", nil, "default lax none strict"},
+		{
+			"same-site subresource", "POST", "https://www.host.test/api",
+			&http.CookieSite{TopLevel: page, Initiator: page},
+			"default lax none strict",
+		},
+		{
+			"cross-site subresource", "GET", "https://www.host.test/",
+			&http.CookieSite{TopLevel: other, Initiator: other},
+			"none",
+		},
+		{
+			"same-site frame in a cross-site page", "GET", "https://www.host.test/",
+			&http.CookieSite{TopLevel: other, Initiator: page},
+			"none",
+		},
+		{
+			"cross-site navigation", "GET", "https://www.host.test/",
+			&http.CookieSite{Initiator: other, Navigation: true},
+			"default lax none",
+		},
+		{
+			"cross-site POST navigation", "POST", "https://www.host.test/",
+			&http.CookieSite{Initiator: other, Navigation: true},
+			"none",
+		},
+		{
+			"same-site navigation", "POST", "https://www.host.test/",
+			&http.CookieSite{TopLevel: other, Initiator: page, Navigation: true},
+			"default lax none strict",
+		},
+		{
+			"schemeful cross-site", "GET", "https://www.host.test/",
+			&http.CookieSite{Initiator: mustParseURL("http://www.host.test/")},
+			"none",
+		},
+	}
+	for _, tt := range tests {
+		var got string
+		if tt.url == "" {
+			var names []string
+			for _, c := range jar.Cookies(mustParseURL("https://www.host.test/")) {
+				names = append(names, c.Name)
+			}
+			sort.Strings(names)
+			got = strings.Join(names, " ")
+		} else {
+			got = cookieNames(jar, siteRequest(tt.method, tt.url, tt.site))
+		}
+		if got != tt.want {
+			t.Errorf("%s: cookies = %q; want %q", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestSameSiteSet(t *testing.T) {
+	jar := newTestJar()
+	other := mustParseURL("https://www.other.test/")
+	lines := []string{
+		"strict=1; SameSite=Strict",
+		"lax=1; SameSite=Lax",
+		"none=1; SameSite=None; Secure",
+		"default=1",
+	}
+
+	setLines(jar, siteRequest("GET", "https://www.host.test/", &http.CookieSite{TopLevel: other, Initiator: other}), lines...)
+	if got, want := cookieNames(jar, siteRequest("GET", "https://www.host.test/", nil)), "default none"; got != want {
+		t.Errorf("set by cross-site subresource: %q; want %q", got, want)
+	}
+
+	jar.Clear()
+	setLines(jar, siteRequest("POST", "https://www.host.test/", &http.CookieSite{Initiator: other, Navigation: true}), lines...)
+	if got, want := cookieNames(jar, siteRequest("GET", "https://www.host.test/", nil)), "default lax none strict"; got != want {
+		t.Errorf("set by cross-site navigation: %q; want %q", got, want)
+	}
+}
+
+func TestPartitioned(t *testing.T) {
+	jar := newTestJar()
+	top1 := mustParseURL("https://www.top1.test/")
+	top2 := mustParseURL("https://www.top2.test/")
+	embed := "https://widget.embed.test/"
+	in := func(top *url.URL) *http.CookieSite {
+		return &http.CookieSite{TopLevel: top, Initiator: top}
+	}
+
+	setLines(jar, siteRequest("GET", embed, in(top1)), "chips=1; Secure; Partitioned; SameSite=None", "plain=1; Secure; SameSite=None")
+	setLines(jar, siteRequest("GET", embed, in(top2)), "chips=2; Secure; Partitioned; SameSite=None")
+
+	values := func(req *http.Request) string {
+		var s []string
+		for _, c := range jar.RequestCookies(req) {
+			s = append(s, c.Name+"="+c.Value)
+		}
+		sort.Strings(s)
+		return strings.Join(s, " ")
+	}
+	if got, want := values(siteRequest("GET", embed, in(top1))), "chips=1 plain=1"; got != want {
+		t.Errorf("under top1: %q; want %q", got, want)
+	}
+	if got, want := values(siteRequest("GET", embed, in(top2))), "chips=2 plain=1"; got != want {
+		t.Errorf("under top2: %q; want %q", got, want)
+	}
+	if got, want := values(siteRequest("GET", embed, nil)), "plain=1"; got != want {
+		t.Errorf("top-level: %q; want %q", got, want)
+	}
+
+	all := jar.All()
+	if len(all) != 3 || all[0].Partition != "https://top1.test" || all[2].Partition != "https://top2.test" {
+		t.Errorf("All = %+v", all)
+	}
+	if !jar.Remove("widget.embed.test", "/", "chips") || len(jar.All()) != 1 {
+		t.Errorf("Remove didn't remove chips from every partition: %+v", jar.All())
+	}
+}
+
+func TestMaxCookiesPerDomain(t *testing.T) {
+	jar, err := New(&Options{PublicSuffixList: testPSL{}, MaxCookiesPerDomain: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := siteRequest("GET", "https://www.host.test/", nil)
+	setLines(jar, req, "high=1; Priority=High", "low=1; Priority=Low", "secure=1; Secure", "insecure=1")
+	if got, want := cookieNames(jar, req), "high insecure secure"; got != want {
+		t.Errorf("after 4 cookies: %q; want %q", got, want)
+	}
+	setLines(jar, req, "another=1; Secure")
+	if got, want := cookieNames(jar, req), "another high secure"; got != want {
+		t.Errorf("after 5 cookies: %q; want %q", got, want)
+	}
+
+	// Other registrable domains have their own limit.
+	setLines(jar, siteRequest("GET", "https://www.other.test/", nil), "a=1", "b=1", "c=1")
+	if n := len(jar.All()); n != 6 {
+		t.Errorf("jar has %d cookies; want 6", n)
+	}
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// An HTTP2Fingerprint describes how a client set up an HTTP/2
+// connection and sent a request on it, as seen by the server. It is
+// what passive HTTP/2 fingerprinting, such as Akamai's, is based on.
+type HTTP2Fingerprint struct {
+	// Settings are the parameters of the client's initial SETTINGS
+	// frame, in the order they were received.
+	Settings []ProfileSetting
+
+	// WindowUpdate is the increment of the connection-level
+	// WINDOW_UPDATE frame received before the first HEADERS frame,
+	// or zero if there was none.
+	WindowUpdate uint32
+
+	// Priorities are the PRIORITY frames received before the first
+	// HEADERS frame, in order. At most 16 are recorded.
+	Priorities []ProfilePriority
+
+	// PrioritiesTruncated reports whether more PRIORITY frames were
+	// received before the first HEADERS frame than Priorities holds.
+	PrioritiesTruncated bool
+
+	// PseudoHeaderOrder is the order of the pseudo-header fields in
+	// the request's HEADERS frame, such as
+	// [":method", ":authority", ":scheme", ":path"].
+	PseudoHeaderOrder []string
+
+	// HeaderPriority is the priority carried by the request's HEADERS
+	// frame, or nil if it had none.
+	HeaderPriority *StreamPriority
+}
+
+// String returns f in the Akamai format
+//
+//	SETTINGS|WINDOW_UPDATE|PRIORITY|Pseudo-Header-Order
+//
+// for example "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p".
+// A missing WINDOW_UPDATE is written as "00" and missing PRIORITY
+// frames as "0". PRIORITY frames are written as
+// "StreamID:Exclusive:StreamDep:Weight", with the weight from 1 to 256.
+func (f *HTTP2Fingerprint) String() string {
+	var b strings.Builder
+	for i, s := range f.Settings {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(strconv.FormatUint(uint64(s.ID), 10))
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatUint(uint64(s.Val), 10))
+	}
+
+	b.WriteByte('|')
+	if f.WindowUpdate == 0 {
+		b.WriteString("00")
+	} else {
+		b.WriteString(strconv.FormatUint(uint64(f.WindowUpdate), 10))
+	}
+
+	b.WriteByte('|')
+	if len(f.Priorities) == 0 {
+		b.WriteByte('0')
+	}
+	for i, p := range f.Priorities {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		exclusive := "0"
+		if p.Exclusive {
+			exclusive = "1"
+		}
+		b.WriteString(strconv.FormatUint(uint64(p.StreamID), 10))
+		b.WriteByte(':')
+		b.WriteString(exclusive)
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatUint(uint64(p.StreamDep), 10))
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(int(p.Weight) + 1))
+	}
+
+	b.WriteByte('|')
+	for i, name := range f.PseudoHeaderOrder {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if name = strings.TrimPrefix(name, ":"); name != "" {
+			b.WriteByte(name[0])
+		}
+	}
+	return b.String()
+}
+
+var http2FingerprintContextKey = &contextKey{"http2-fingerprint"}
+
+// WithHTTP2Fingerprint returns a copy of ctx carrying f. The HTTP/2
+// server uses it to attach the client's fingerprint to the contexts
+// of incoming requests.
+func WithHTTP2Fingerprint(ctx context.Context, f *HTTP2Fingerprint) context.Context {
+	return context.WithValue(ctx, http2FingerprintContextKey, f)
+}
+
+// HTTP2FingerprintFromContext returns the HTTP/2 fingerprint of the
+// client that sent a server request, given the request's context. It
+// reports false for requests that didn't arrive over HTTP/2.
+func HTTP2FingerprintFromContext(ctx context.Context) (f *HTTP2Fingerprint, ok bool) {
+	f, ok = ctx.Value(http2FingerprintContextKey).(*HTTP2Fingerprint)
+	return f, ok && f != nil
+}
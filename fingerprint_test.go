@@ -0,0 +1,26 @@
+package http
+
+import "testing"
+
+func TestHTTP2FingerprintString(t *testing.T) {
+	tests := []struct {
+		fp   HTTP2Fingerprint
+		want string
+	}{
+		{HTTP2Fingerprint{}, "|00|0|"},
+		{
+			HTTP2Fingerprint{
+				Settings:          []ProfileSetting{{1, 65536}, {4, 131072}, {5, 16384}},
+				WindowUpdate:      12517377,
+				Priorities:        []ProfilePriority{{StreamID: 3, Weight: 200}, {StreamID: 7, StreamDep: 3, Exclusive: true}},
+				PseudoHeaderOrder: []string{":method", ":path", ":authority", ":scheme"},
+			},
+			"1:65536;4:131072;5:16384|12517377|3:0:0:201,7:1:3:1|m,p,a,s",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.fp.String(); got != tt.want {
+			t.Errorf("String() = %q; want %q", got, tt.want)
+		}
+	}
+}
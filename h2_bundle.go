@@ -755,49 +755,56 @@ func (p *http2clientConnPool) getClientConn(req *Request, addr string, dialOnMis
 		// It gets its own connection.
 		http2traceGetConn(req, addr)
 		const singleUse = true
-		cc, err := p.t.dialClientConn(addr, singleUse)
+		cc, err := p.t.dialRequestConn(req, addr, singleUse)
 		if err != nil {
 			return nil, err
 		}
 		return cc, nil
 	}
-	p.mu.Lock()
-	for _, cc := range p.conns[addr] {
-		if st := cc.idleState(); st.canTakeNewRequest {
-			if p.shouldTraceGetConn(st) {
-				http2traceGetConn(req, addr)
+	for {
+		p.mu.Lock()
+		for _, cc := range p.conns[addr] {
+			if st := cc.idleState(); st.canTakeNewRequest {
+				if p.shouldTraceGetConn(st) {
+					http2traceGetConn(req, addr)
+				}
+				p.mu.Unlock()
+				return cc, nil
 			}
+		}
+		if !dialOnMiss {
 			p.mu.Unlock()
-			return cc, nil
+			return nil, http2ErrNoCachedConn
 		}
-	}
-	if !dialOnMiss {
+		http2traceGetConn(req, addr)
+		call := p.getStartDialLocked(req, addr)
 		p.mu.Unlock()
-		return nil, http2ErrNoCachedConn
+		<-call.done
+		if http2shouldRetryDial(call, req) {
+			continue
+		}
+		return call.res, call.err
 	}
-	http2traceGetConn(req, addr)
-	call := p.getStartDialLocked(addr)
-	p.mu.Unlock()
-	<-call.done
-	return call.res, call.err
 }
 
 // dialCall is an in-flight Transport dial call to a host.
 type http2dialCall struct {
 	_    http2incomparable
 	p    *http2clientConnPool
+	req  *Request         // the request that started the dial
+	ctx  context.Context  // context of req
 	done chan struct{}    // closed when done
 	res  *http2ClientConn // valid after done is closed
 	err  error            // valid after done is closed
 }
 
 // requires p.mu is held.
-func (p *http2clientConnPool) getStartDialLocked(addr string) *http2dialCall {
+func (p *http2clientConnPool) getStartDialLocked(req *Request, addr string) *http2dialCall {
 	if call, ok := p.dialing[addr]; ok {
 		// A dial is already in-flight. Don't start another.
 		return call
 	}
-	call := &http2dialCall{p: p, done: make(chan struct{})}
+	call := &http2dialCall{p: p, req: req, ctx: req.Context(), done: make(chan struct{})}
 	if p.dialing == nil {
 		p.dialing = make(map[string]*http2dialCall)
 	}
@@ -809,7 +816,7 @@ func (p *http2clientConnPool) getStartDialLocked(addr string) *http2dialCall {
 // run in its own goroutine.
 func (c *http2dialCall) dial(addr string) {
 	const singleUse = false // shared conn
-	c.res, c.err = c.p.t.dialClientConn(addr, singleUse)
+	c.res, c.err = c.p.t.dialRequestConn(c.req, addr, singleUse)
 	close(c.done)
 
 	c.p.mu.Lock()
@@ -820,6 +827,19 @@ func (c *http2dialCall) dial(addr string) {
 	c.p.mu.Unlock()
 }
 
+// shouldRetryDial reports whether req, which waited on call, should
+// start a dial of its own because call failed only as the request
+// that started it was canceled.
+func http2shouldRetryDial(call *http2dialCall, req *Request) bool {
+	if call.err == nil || call.ctx == req.Context() {
+		return false
+	}
+	if !errors.Is(call.err, context.Canceled) && !errors.Is(call.err, context.DeadlineExceeded) {
+		return false
+	}
+	return call.ctx.Err() != nil
+}
+
 // addConnIfNeeded makes a NewClientConn out of c if a connection for key doesn't
 // already exist. It coalesces concurrent calls with the same key.
 // This is used by the http1 Transport code when it creates a new connection. Because
@@ -828,7 +848,7 @@ func (c *http2dialCall) dial(addr string) {
 // This code decides which ones live or die.
 // The return value used is whether c was used.
 // c is never closed.
-func (p *http2clientConnPool) addConnIfNeeded(key string, t *http2Transport, c *tls.Conn) (used bool, err error) {
+func (p *http2clientConnPool) addConnIfNeeded(key string, t *http2Transport, c TLSConn) (used bool, err error) {
 	p.mu.Lock()
 	for _, cc := range p.conns[key] {
 		if cc.CanTakeNewRequest() {
@@ -864,7 +884,7 @@ type http2addConnCall struct {
 	err  error
 }
 
-func (c *http2addConnCall) run(t *http2Transport, key string, tc *tls.Conn) {
+func (c *http2addConnCall) run(t *http2Transport, key string, tc TLSConn) {
 	cc, err := t.NewClientConn(tc)
 
 	p := c.p
@@ -1278,6 +1298,8 @@ const (
 	http2FrameGoAway       http2FrameType = 0x7
 	http2FrameWindowUpdate http2FrameType = 0x8
 	http2FrameContinuation http2FrameType = 0x9
+
+	http2FramePriorityUpdate http2FrameType = 0x10 // RFC 9218
 )
 
 var http2frameName = map[http2FrameType]string{
@@ -1291,6 +1313,8 @@ var http2frameName = map[http2FrameType]string{
 	http2FrameGoAway:       "GOAWAY",
 	http2FrameWindowUpdate: "WINDOW_UPDATE",
 	http2FrameContinuation: "CONTINUATION",
+
+	http2FramePriorityUpdate: "PRIORITY_UPDATE",
 }
 
 func (t http2FrameType) String() string {
@@ -1377,6 +1401,8 @@ var http2frameParsers = map[http2FrameType]http2frameParser{
 	http2FrameGoAway:       http2parseGoAwayFrame,
 	http2FrameWindowUpdate: http2parseWindowUpdateFrame,
 	http2FrameContinuation: http2parseContinuationFrame,
+
+	http2FramePriorityUpdate: http2parsePriorityUpdateFrame,
 }
 
 func http2typeFrameParser(t http2FrameType) http2frameParser {
@@ -2300,6 +2326,10 @@ type http2HeadersFrameParam struct {
 	// Priority, if non-zero, includes stream priority information
 	// in the HEADER frame.
 	Priority http2PriorityParam
+
+	// HasPriority, if true, includes Priority in the HEADERS frame
+	// even when it is the zero value.
+	HasPriority bool
 }
 
 // WriteHeaders writes a single HEADERS frame.
@@ -2324,14 +2354,15 @@ func (f *http2Framer) WriteHeaders(p http2HeadersFrameParam) error {
 	if p.EndHeaders {
 		flags |= http2FlagHeadersEndHeaders
 	}
-	if !p.Priority.IsZero() {
+	hasPriority := p.HasPriority || !p.Priority.IsZero()
+	if hasPriority {
 		flags |= http2FlagHeadersPriority
 	}
 	f.startWrite(http2FrameHeaders, flags, p.StreamID)
 	if p.PadLength != 0 {
 		f.writeByte(p.PadLength)
 	}
-	if !p.Priority.IsZero() {
+	if hasPriority {
 		v := p.Priority.StreamDep
 		if !http2validStreamIDOrZero(v) && !f.AllowIllegalWrites {
 			return http2errDepStreamID
@@ -2415,6 +2446,53 @@ func (f *http2Framer) WritePriority(streamID uint32, p http2PriorityParam) error
 	return f.endWrite()
 }
 
+// A PriorityUpdateFrame carries the RFC 9218 extensible priority of a
+// request stream. It is sent by clients on stream 0.
+// See https://www.rfc-editor.org/rfc/rfc9218.html#section-7.1
+type http2PriorityUpdateFrame struct {
+	http2FrameHeader
+
+	// PrioritizedStreamID is the stream whose priority is updated.
+	PrioritizedStreamID uint32
+
+	// PriorityFieldValue is the priority, in the format of the
+	// "priority" header field, such as "u=0, i".
+	PriorityFieldValue string
+}
+
+func http2parsePriorityUpdateFrame(_ *http2frameCache, fh http2FrameHeader, payload []byte) (http2Frame, error) {
+	if fh.StreamID != 0 {
+		return nil, http2connError{http2ErrCodeProtocol, "PRIORITY_UPDATE frame with non-zero stream ID"}
+	}
+	if len(payload) < 4 {
+		return nil, http2connError{http2ErrCodeFrameSize, fmt.Sprintf("PRIORITY_UPDATE frame payload size was %d; want at least 4", len(payload))}
+	}
+	id := binary.BigEndian.Uint32(payload[:4]) & 0x7fffffff
+	if id == 0 {
+		return nil, http2connError{http2ErrCodeProtocol, "PRIORITY_UPDATE frame for stream 0"}
+	}
+	return &http2PriorityUpdateFrame{
+		http2FrameHeader:    fh,
+		PrioritizedStreamID: id,
+		PriorityFieldValue:  string(payload[4:]),
+	}, nil
+}
+
+// WritePriorityUpdate writes a PRIORITY_UPDATE frame carrying the
+// priority field value for the given stream.
+//
+// It will perform exactly one Write to the underlying Writer.
+// It is the caller's responsibility to not call other Write methods concurrently.
+func (f *http2Framer) WritePriorityUpdate(streamID uint32, priority string) error {
+	if !http2validStreamID(streamID) && !f.AllowIllegalWrites {
+		return http2errStreamID
+	}
+	f.startWrite(http2FramePriorityUpdate, 0, 0)
+	f.writeUint32(streamID)
+	f.writeBytes([]byte(priority))
+	return f.endWrite()
+}
+
 // A RSTStreamFrame allows for abnormal termination of a stream.
 // See http://http2.github.io/http2-spec/#rfc.section.6.4
 type http2RSTStreamFrame struct {
@@ -3314,6 +3392,10 @@ func (s http2Setting) Valid() error {
 		if s.Val < 16384 || s.Val > 1<<24-1 {
 			return http2ConnectionError(http2ErrCodeProtocol)
 		}
+	case http2SettingNoRFC7540Priorities:
+		if s.Val != 1 && s.Val != 0 {
+			return http2ConnectionError(http2ErrCodeProtocol)
+		}
 	}
 	return nil
 }
@@ -3329,6 +3411,7 @@ const (
 	http2SettingInitialWindowSize    http2SettingID = 0x4
 	http2SettingMaxFrameSize         http2SettingID = 0x5
 	http2SettingMaxHeaderListSize    http2SettingID = 0x6
+	http2SettingNoRFC7540Priorities  http2SettingID = 0x9 // RFC 9218
 )
 
 var http2settingName = map[http2SettingID]string{
@@ -3338,6 +3421,7 @@ var http2settingName = map[http2SettingID]string{
 	http2SettingInitialWindowSize:    "INITIAL_WINDOW_SIZE",
 	http2SettingMaxFrameSize:         "MAX_FRAME_SIZE",
 	http2SettingMaxHeaderListSize:    "MAX_HEADER_LIST_SIZE",
+	http2SettingNoRFC7540Priorities:  "NO_RFC7540_PRIORITIES",
 }
 
 func (s http2SettingID) String() string {
@@ -3351,10 +3435,11 @@ func (s http2SettingID) String() string {
 // name (key). See httpguts.ValidHeaderName for the base rules.
 //
 // Further, http2 says:
-//   "Just as in HTTP/1.x, header field names are strings of ASCII
-//   characters that are compared in a case-insensitive
-//   fashion. However, header field names MUST be converted to
-//   lowercase prior to their encoding in HTTP/2. "
+//
+//	"Just as in HTTP/1.x, header field names are strings of ASCII
+//	characters that are compared in a case-insensitive
+//	fashion. However, header field names MUST be converted to
+//	lowercase prior to their encoding in HTTP/2. "
 func http2validWireHeaderFieldName(v string) bool {
 	if len(v) == 0 {
 		return false
@@ -3545,8 +3630,8 @@ func (s *http2sorter) SortStrings(ss []string) {
 // validPseudoPath reports whether v is a valid :path pseudo-header
 // value. It must be either:
 //
-//     *) a non-empty string starting with '/'
-//     *) the string '*', for OPTIONS requests.
+//	*) a non-empty string starting with '/'
+//	*) the string '*', for OPTIONS requests.
 //
 // For now this is only used a quick check for deciding when to clean
 // up Opaque URLs before sending requests from the Transport.
@@ -4363,6 +4448,17 @@ type http2serverConn struct {
 	shutdownTimer               *time.Timer // nil until used
 	idleTimer                   *time.Timer // nil if unused
 
+	// pendingPriorityUpdates are PRIORITY_UPDATE frames received for
+	// idle streams, applied when the stream opens. Owned by serve.
+	pendingPriorityUpdates map[uint32]ExtensiblePriority
+
+	// fingerprint is what the client revealed about itself before
+	// its first request: its initial SETTINGS, connection
+	// WINDOW_UPDATE and PRIORITY frames. Owned by serve.
+	fingerprint       HTTP2Fingerprint
+	sawClientSettings bool
+	sawClientHeaders  bool // a HEADERS frame was received; stop recording
+
 	// Owned by the writeFrameAsync goroutine:
 	headerWriteBuf bytes.Buffer
 	hpackEncoder   *hpack.Encoder
@@ -4643,14 +4739,17 @@ func (sc *http2serverConn) serve() {
 		sc.vlogf("http2: server connection from %v on %p", sc.conn.RemoteAddr(), sc.hs)
 	}
 
-	sc.writeFrame(http2FrameWriteRequest{
-		write: http2writeSettings{
-			{http2SettingMaxFrameSize, sc.srv.maxReadFrameSize()},
-			{http2SettingMaxConcurrentStreams, sc.advMaxStreams},
-			{http2SettingMaxHeaderListSize, sc.maxHeaderListSize()},
-			{http2SettingInitialWindowSize, uint32(sc.srv.initialStreamRecvWindowSize())},
-		},
-	})
+	settings := http2writeSettings{
+		{http2SettingMaxFrameSize, sc.srv.maxReadFrameSize()},
+		{http2SettingMaxConcurrentStreams, sc.advMaxStreams},
+		{http2SettingMaxHeaderListSize, sc.maxHeaderListSize()},
+		{http2SettingInitialWindowSize, uint32(sc.srv.initialStreamRecvWindowSize())},
+	}
+	if _, ok := sc.writeSched.(http2ExtensiblePriorityWriteScheduler); ok {
+		// Tell the client that RFC 9218 priorities are used instead.
+		settings = append(settings, http2Setting{http2SettingNoRFC7540Priorities, 1})
+	}
+	sc.writeFrame(http2FrameWriteRequest{write: settings})
 	sc.unackedSettings++
 
 	// Each connection starts with intialWindowSize inflow tokens.
@@ -5247,6 +5346,8 @@ func (sc *http2serverConn) processFrame(f http2Frame) error {
 		return sc.processResetStream(f)
 	case *http2PriorityFrame:
 		return sc.processPriority(f)
+	case *http2PriorityUpdateFrame:
+		return sc.processPriorityUpdate(f)
 	case *http2GoAwayFrame:
 		return sc.processGoAway(f)
 	case *http2MetaPushPromiseFrame:
@@ -5308,6 +5409,9 @@ func (sc *http2serverConn) processWindowUpdate(f *http2WindowUpdateFrame) error
 		if !sc.flow.add(int32(f.Increment)) {
 			return http2goAwayFlowError{}
 		}
+		if !sc.sawClientHeaders && sc.fingerprint.WindowUpdate == 0 {
+			sc.fingerprint.WindowUpdate = f.Increment
+		}
 	}
 	sc.scheduleFrameWrite()
 	return nil
@@ -5388,6 +5492,13 @@ func (sc *http2serverConn) processSettings(f *http2SettingsFrame) error {
 	if err := f.ForeachSetting(sc.processSetting); err != nil {
 		return err
 	}
+	if !sc.sawClientSettings {
+		sc.sawClientSettings = true
+		f.ForeachSetting(func(s http2Setting) error {
+			sc.fingerprint.Settings = append(sc.fingerprint.Settings, ProfileSetting{ID: uint16(s.ID), Val: s.Val})
+			return nil
+		})
+	}
 	// TODO: judging by RFC 7540, Section 6.5.3 each SETTINGS frame should be
 	// acknowledged individually, even if multiple are received before the ACK.
 	sc.needToSendSettingsAck = true
@@ -5677,6 +5788,24 @@ func (sc *http2serverConn) processHeaders(f *http2MetaHeadersFrame) error {
 		}
 		sc.writeSched.AdjustStream(st.id, f.Priority)
 	}
+	if ws, ok := sc.writeSched.(http2ExtensiblePriorityWriteScheduler); ok {
+		// RFC 9218, Section 7.1: a PRIORITY_UPDATE frame received
+		// before the request takes precedence over its header.
+		if p, ok := sc.pendingPriorityUpdates[id]; ok {
+			delete(sc.pendingPriorityUpdates, id)
+			ws.AdjustStreamExtensible(id, p)
+		} else {
+			for _, hf := range f.RegularFields() {
+				if hf.Name == "priority" {
+					ws.AdjustStreamExtensible(id, ParseExtensiblePriority(hf.Value))
+					break
+				}
+			}
+		}
+	}
+
+	sc.sawClientHeaders = true
+	st.ctx = WithHTTP2Fingerprint(st.ctx, sc.streamFingerprint(f))
 
 	rw, req, err := sc.newWriterAndRequest(st, f)
 	if err != nil {
@@ -5742,6 +5871,28 @@ func (st *http2stream) processTrailerHeaders(f *http2MetaHeadersFrame) error {
 	return nil
 }
 
+// streamFingerprint returns the client's fingerprint as of the
+// request sent in f.
+func (sc *http2serverConn) streamFingerprint(f *http2MetaHeadersFrame) *HTTP2Fingerprint {
+	fp := &HTTP2Fingerprint{
+		Settings:            append([]ProfileSetting(nil), sc.fingerprint.Settings...),
+		WindowUpdate:        sc.fingerprint.WindowUpdate,
+		Priorities:          append([]ProfilePriority(nil), sc.fingerprint.Priorities...),
+		PrioritiesTruncated: sc.fingerprint.PrioritiesTruncated,
+	}
+	for _, hf := range f.PseudoFields() {
+		fp.PseudoHeaderOrder = append(fp.PseudoHeaderOrder, hf.Name)
+	}
+	if f.HasPriority() {
+		fp.HeaderPriority = &StreamPriority{
+			StreamDep: f.Priority.StreamDep,
+			Exclusive: f.Priority.Exclusive,
+			Weight:    f.Priority.Weight,
+		}
+	}
+	return fp
+}
+
 func http2checkPriority(streamID uint32, p http2PriorityParam) error {
 	if streamID == p.StreamDep {
 		// Section 5.3.1: "A stream cannot depend on itself. An endpoint MUST treat
@@ -5760,10 +5911,62 @@ func (sc *http2serverConn) processPriority(f *http2PriorityFrame) error {
 	if err := http2checkPriority(f.StreamID, f.http2PriorityParam); err != nil {
 		return err
 	}
+	if !sc.sawClientHeaders {
+		if len(sc.fingerprint.Priorities) < http2maxFingerprintPriorities {
+			sc.fingerprint.Priorities = append(sc.fingerprint.Priorities, ProfilePriority{
+				StreamID:  f.StreamID,
+				StreamDep: f.StreamDep,
+				Exclusive: f.Exclusive,
+				Weight:    f.Weight,
+			})
+		} else {
+			sc.fingerprint.PrioritiesTruncated = true
+		}
+	}
 	sc.writeSched.AdjustStream(f.StreamID, f.http2PriorityParam)
 	return nil
 }
 
+// maxFingerprintPriorities is the maximum number of PRIORITY frames
+// recorded in a connection's fingerprint. Browsers send a handful at
+// most; the rest are counted as truncation.
+const http2maxFingerprintPriorities = 16
+
+// maxPendingPriorityUpdates is the maximum number of PRIORITY_UPDATE
+// frames for idle streams remembered per connection.
+const http2maxPendingPriorityUpdates = 100
+
+func (sc *http2serverConn) processPriorityUpdate(f *http2PriorityUpdateFrame) error {
+	sc.serveG.check()
+	if sc.inGoAway {
+		return nil
+	}
+	ws, ok := sc.writeSched.(http2ExtensiblePriorityWriteScheduler)
+	if !ok {
+		return nil
+	}
+	id := f.PrioritizedStreamID
+	if id%2 != 1 {
+		// RFC 9218, Section 7.1: servers only accept updates for
+		// client-initiated request streams.
+		return http2ConnectionError(http2ErrCodeProtocol)
+	}
+	p := ParseExtensiblePriority(f.PriorityFieldValue)
+	if id > sc.maxClientStreamID {
+		// The stream is idle; apply the update once it opens.
+		if sc.pendingPriorityUpdates == nil {
+			sc.pendingPriorityUpdates = make(map[uint32]ExtensiblePriority)
+		}
+		if _, ok := sc.pendingPriorityUpdates[id]; !ok && len(sc.pendingPriorityUpdates) >= http2maxPendingPriorityUpdates {
+			return nil
+		}
+		sc.pendingPriorityUpdates[id] = p
+		return nil
+	}
+	ws.AdjustStreamExtensible(id, p)
+	return nil
+}
+
 func (sc *http2serverConn) newStream(id, pusherID uint32, state http2streamState) *http2stream {
 	sc.serveG.check()
 	if id == 0 {
@@ -5848,6 +6051,10 @@ func (sc *http2serverConn) newWriterAndRequest(st *http2stream, f *http2MetaHead
 	if err != nil {
 		return nil, nil, err
 	}
+	req.RawHeaders = make([]RawHeader, len(f.Fields))
+	for i, hf := range f.Fields {
+		req.RawHeaders[i] = RawHeader{Name: hf.Name, Value: hf.Value}
+	}
 	if bodyOpen {
 		if vv, ok := rp.header["Content-Length"]; ok {
 			if cl, err := strconv.ParseUint(vv[0], 10, 63); err == nil {
@@ -6343,8 +6550,9 @@ func (rws *http2responseWriterState) writeChunk(p []byte) (n int, err error) {
 // prior to the headers being written. If the set of trailers is fixed
 // or known before the header is written, the normal Go trailers mechanism
 // is preferred:
-//    https://golang.org/pkg/net/http/#ResponseWriter
-//    https://golang.org/pkg/net/http/#example_ResponseWriter_trailers
+//
+//	https://golang.org/pkg/net/http/#ResponseWriter
+//	https://golang.org/pkg/net/http/#example_ResponseWriter_trailers
 const http2TrailerPrefix = "Trailer:"
 
 // promoteUndeclaredTrailers permits http.Handlers to set trailers
@@ -6831,15 +7039,52 @@ const (
 // A Transport internally caches connections to servers. It is safe
 // for concurrent use by multiple goroutines.
 type http2Transport struct {
-	// DialTLS specifies an optional dial function for creating
-	// TLS connections for requests.
+	// DialTLSContext specifies an optional dial function with context
+	// for creating TLS connections for requests. The context is that
+	// of the request that caused the dial.
 	//
-	// If DialTLS is nil, tls.Dial is used.
+	// If DialTLSContext is nil, DialTLS is used. If both are nil, a
+	// TCP connection is dialed with DialContext, through the proxy
+	// chosen by Proxy if any, and TLS is set up over it.
 	//
 	// If the returned net.Conn has a ConnectionState method like tls.Conn,
-	// it will be used to set http.Response.TLS.
+	// it will be used to set http.Response.TLS. Connections implementing
+	// http.TLSConn are accepted as well as *tls.Conn.
+	DialTLSContext func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error)
+
+	// DialTLS specifies an optional dial function for creating
+	// TLS connections for requests.
+	//
+	// Deprecated: Use DialTLSContext instead, which allows the dial
+	// to be canceled. If both are set, DialTLSContext takes priority.
 	DialTLS func(network, addr string, cfg *tls.Config) (net.Conn, error)
 
+	// DialContext specifies an optional dial function for the TCP
+	// connections that TLS is set up over, to servers or to proxies.
+	// It is not used if DialTLSContext or DialTLS is set.
+	//
+	// If DialContext is nil, a net.Dialer is used.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Proxy optionally specifies a function to return a proxy for a
+	// request, as for http.Transport. The "http", "https" and
+	// SOCKS schemes are supported, as by http.ProxyDialer; a nil
+	// URL or error means no proxy is used. The proxy's TLS
+	// configuration is taken from TLSClientConfig, without its
+	// ServerName.
+	//
+	// Connections are pooled by target address, so the proxy chosen
+	// for the request that dials a connection is used by all the
+	// requests sharing it.
+	//
+	// Proxy is not used if DialTLSContext or DialTLS is set. Such
+	// functions can use http.ProxyDialer themselves.
+	Proxy func(*Request) (*url.URL, error)
+
+	// ProxyConnectHeader optionally specifies headers to send to
+	// proxies with CONNECT requests.
+	ProxyConnectHeader Header
+
 	// TLSClientConfig specifies the TLS configuration to use with
 	// tls.Client. If nil, the default configuration is used.
 	TLSClientConfig *tls.Config
@@ -6871,6 +7116,12 @@ type http2Transport struct {
 	// to mean no limit.
 	MaxHeaderListSize uint32
 
+	// MaxEncoderHeaderTableSize is the upper limit of the HPACK
+	// dynamic table used to encode request headers. The table size
+	// follows the server's SETTINGS_HEADER_TABLE_SIZE, capped at this
+	// value. If zero, the default of 4096 from RFC 7541 is used.
+	MaxEncoderHeaderTableSize uint32
+
 	// StrictMaxConcurrentStreams controls whether the server's
 	// SETTINGS_MAX_CONCURRENT_STREAMS should be respected
 	// globally. If false, new TCP connections are created to the
@@ -6916,10 +7167,116 @@ type http2Transport struct {
 	connPoolOnce  sync.Once
 	connPoolOrDef http2ClientConnPool // non-nil version of ConnPool
 
-	// Settings should not include InitialWindowSize or HeaderTableSize, set that in Transport
-	Settings          []http2Setting
-	InitialWindowSize uint32 // if nil, will use global initialWindowSize
-	HeaderTableSize   uint32 // if nil, will use global initialHeaderTableSize
+	// Settings, if non-nil, are the parameters of the initial
+	// SETTINGS frame. They are written exactly in this order and
+	// nothing else is added; in particular SETTINGS_ENABLE_PUSH is
+	// only sent if it is listed. The connection's flow control and
+	// HPACK decoder state are derived from the values listed here,
+	// using the spec defaults for the settings that are left out.
+	//
+	// If nil, the Transport sends SETTINGS_ENABLE_PUSH,
+	// SETTINGS_INITIAL_WINDOW_SIZE, SETTINGS_HEADER_TABLE_SIZE and
+	// SETTINGS_MAX_HEADER_LIST_SIZE, in that order.
+	Settings []http2Setting
+
+	// InitialWindowSize and HeaderTableSize are the values of
+	// SETTINGS_INITIAL_WINDOW_SIZE and SETTINGS_HEADER_TABLE_SIZE
+	// sent when Settings is nil. Zero means the Transport's default.
+	// They are ignored if Settings is non-nil.
+	InitialWindowSize uint32
+	HeaderTableSize   uint32
+
+	// HeaderEncodings, if non-nil, sets the HPACK encoding of request
+	// header fields by lowercase name: whether they are added to the
+	// dynamic table and whether their strings are Huffman coded.
+	// Fields not listed use the encoder's default. Headers marked
+	// with http.WithSensitiveHeaders are always never indexed.
+	HeaderEncodings map[string]hpack.FieldEncoding
+
+	// ConnectionFlow is the increment of the connection-level
+	// WINDOW_UPDATE frame written after the initial SETTINGS frame.
+	// If zero, the Profile's ConnectionFlow is used, or 1<<30 if
+	// there is no profile. Values that would grow the connection
+	// window past 2^31-1 are rejected when a connection is created.
+	ConnectionFlow uint32
+
+	// PriorityFrames, if non-nil, are PRIORITY frames written after
+	// the connection-level WINDOW_UPDATE, in order. Some browsers
+	// use them to build a dependency tree out of idle streams that
+	// their requests then depend on. Requests are sent on stream
+	// IDs above the highest client stream ID used here.
+	// If nil, the Profile's PriorityFrames are used.
+	PriorityFrames []http2PriorityFrameParam
+
+	// Profile optionally specifies the client profile used for new
+	// connections and requests. If non-nil and Settings is nil, its
+	// settings are sent instead of the Transport's defaults. Its
+	// ConnectionFlow is used as the connection-level WINDOW_UPDATE
+	// increment, and its header orders are used for requests
+	// that don't set HeaderOrderKey or PHeaderOrderKey.
+	//
+	// If nil, the ClientProfile of the http.Transport this Transport
+	// was configured from is used, if any.
+	Profile *ClientProfile
+}
+
+func (t *http2Transport) profile() *ClientProfile {
+	if t.Profile != nil {
+		return t.Profile
+	}
+	if t.t1 != nil {
+		return t.t1.ClientProfile
+	}
+	return nil
+}
+
+func (t *http2Transport) connectionFlow() uint32 {
+	if t.ConnectionFlow != 0 {
+		return t.ConnectionFlow
+	}
+	if p := t.profile(); p != nil && p.ConnectionFlow != 0 {
+		return p.ConnectionFlow
+	}
+	return http2transportDefaultConnFlow
+}
+
+// maxConnFlow is the largest connection-level WINDOW_UPDATE increment
+// the preface may carry: the window starts at initialWindowSize and
+// must stay within 2^31-1 (RFC 7540, 6.9.1).
+const http2maxConnFlow = 1<<31 - 1 - http2initialWindowSize
+
+var http2errConnFlow = errors.New("http2: connection flow increment grows the connection window past 2^31-1")
+
+func (t *http2Transport) priorityFrames() []http2PriorityFrameParam {
+	if t.PriorityFrames != nil {
+		return t.PriorityFrames
+	}
+	p := t.profile()
+	if p == nil {
+		return nil
+	}
+	frames := make([]http2PriorityFrameParam, len(p.PriorityFrames))
+	for i, f := range p.PriorityFrames {
+		frames[i] = http2PriorityFrameParam{
+			StreamID: f.StreamID,
+			http2PriorityParam: http2PriorityParam{
+				StreamDep: f.StreamDep,
+				Exclusive: f.Exclusive,
+				Weight:    f.Weight,
+			},
+		}
+	}
+	return frames
+}
+
+// PriorityFrameParam describes a PRIORITY frame written by the
+// Transport right after the connection preface.
+type http2PriorityFrameParam struct {
+	// StreamID is the stream whose priority is set. It is usually
+	// an idle stream used only as a node of the dependency tree.
+	StreamID uint32
+
+	http2PriorityParam
 }
 
 func (t *http2Transport) maxHeaderListSize() uint32 {
@@ -6932,6 +7289,13 @@ func (t *http2Transport) maxHeaderListSize() uint32 {
 	return t.MaxHeaderListSize
 }
 
+func (t *http2Transport) maxEncoderHeaderTableSize() uint32 {
+	if t.MaxEncoderHeaderTableSize == 0 {
+		return http2initialHeaderTableSize
+	}
+	return t.MaxEncoderHeaderTableSize
+}
+
 func (t *http2Transport) disableCompression() bool {
 	return t.DisableCompression || (t.t1 != nil && t.t1.DisableCompression)
 }
@@ -6961,6 +7325,14 @@ func http2ConfigureTransports(t1 *Transport) (*http2Transport, error) {
 }
 
 func http2configureTransports(t1 *Transport) (*http2Transport, error) {
+	return http2configureTransportsALPN(t1, true)
+}
+
+// http2configureTransportsALPN is http2configureTransports, but only
+// adds "h2" and "http/1.1" to t1.TLSClientConfig.NextProtos if
+// setNextProtos is set. Otherwise HTTP/2 is used on connections that
+// negotiate it by other means, such as a custom TLS dialer.
+func http2configureTransportsALPN(t1 *Transport, setNextProtos bool) (*http2Transport, error) {
 	connPool := new(http2clientConnPool)
 	t2 := &http2Transport{
 		ConnPool: http2noDialClientConnPool{connPool},
@@ -6971,16 +7343,18 @@ func http2configureTransports(t1 *Transport) (*http2Transport, error) {
 	if err := http2registerHTTPSProtocol(t1, http2noDialH2RoundTripper{t2}); err != nil {
 		return nil, err
 	}
-	if t1.TLSClientConfig == nil {
-		t1.TLSClientConfig = new(tls.Config)
-	}
-	if !http2strSliceContains(t1.TLSClientConfig.NextProtos, "h2") {
-		t1.TLSClientConfig.NextProtos = append([]string{"h2"}, t1.TLSClientConfig.NextProtos...)
-	}
-	if !http2strSliceContains(t1.TLSClientConfig.NextProtos, "http/1.1") {
-		t1.TLSClientConfig.NextProtos = append(t1.TLSClientConfig.NextProtos, "http/1.1")
+	if setNextProtos {
+		if t1.TLSClientConfig == nil {
+			t1.TLSClientConfig = new(tls.Config)
+		}
+		if !http2strSliceContains(t1.TLSClientConfig.NextProtos, "h2") {
+			t1.TLSClientConfig.NextProtos = append([]string{"h2"}, t1.TLSClientConfig.NextProtos...)
+		}
+		if !http2strSliceContains(t1.TLSClientConfig.NextProtos, "http/1.1") {
+			t1.TLSClientConfig.NextProtos = append(t1.TLSClientConfig.NextProtos, "http/1.1")
+		}
 	}
-	upgradeFn := func(authority string, c *tls.Conn) RoundTripper {
+	upgradeFn := func(authority string, c TLSConn) RoundTripper {
 		addr := http2authorityAddr("https", authority)
 		if used, err := connPool.addConnIfNeeded(addr, t2, c); err != nil {
 			go c.Close()
@@ -6995,7 +7369,7 @@ func http2configureTransports(t1 *Transport) (*http2Transport, error) {
 		return t2
 	}
 	if m := t1.TLSNextProto; len(m) == 0 {
-		t1.TLSNextProto = map[string]func(string, *tls.Conn) RoundTripper{
+		t1.TLSNextProto = map[string]func(string, TLSConn) RoundTripper{
 			"h2": upgradeFn,
 		}
 	} else {
@@ -7053,6 +7427,8 @@ type http2ClientConn struct {
 	cond             *sync.Cond // hold mu; broadcast on flow/closed changes
 	flow             http2flow  // our conn-level flow control quota (cs.flow is per stream)
 	inflow           http2flow  // peer's conn-level flow control
+	connFlow         int32      // conn-level window increment we announced in the preface
+	streamFlow       int32      // stream-level window we announced in SETTINGS_INITIAL_WINDOW_SIZE
 	closing          bool
 	closed           bool
 	wantSettingsAck  bool                          // we sent a SETTINGS frame and haven't heard back
@@ -7329,10 +7705,9 @@ func (t *http2Transport) CloseIdleConnections() {
 }
 
 var (
-	http2errClientConnClosed               = errors.New("http2: client conn is closed")
-	http2errClientConnUnusable             = errors.New("http2: client conn not usable")
-	http2errClientConnGotGoAway            = errors.New("http2: Transport received Server's graceful shutdown GOAWAY")
-	http2errSettingsIncludeIllegalSettings = errors.New("http2: Settings contains either SettingInitialWindowSize or SettingHeaderTableSize, which should be specified in transport instead")
+	http2errClientConnClosed    = errors.New("http2: client conn is closed")
+	http2errClientConnUnusable  = errors.New("http2: client conn not usable")
+	http2errClientConnGotGoAway = errors.New("http2: Transport received Server's graceful shutdown GOAWAY")
 )
 
 // shouldRetryRequest is called by RoundTrip when a request fails to get
@@ -7384,12 +7759,25 @@ func http2canRetryError(err error) bool {
 	return false
 }
 
-func (t *http2Transport) dialClientConn(addr string, singleUse bool) (*http2ClientConn, error) {
+// dialRequestConn dials a connection to addr for req, through the
+// proxy that Proxy returns for req, if any.
+func (t *http2Transport) dialRequestConn(req *Request, addr string, singleUse bool) (*http2ClientConn, error) {
+	var proxyURL *url.URL
+	if t.Proxy != nil && t.DialTLSContext == nil && t.DialTLS == nil {
+		var err error
+		if proxyURL, err = t.Proxy(req); err != nil {
+			return nil, err
+		}
+	}
+	return t.dialClientConn(req.Context(), addr, proxyURL, singleUse)
+}
+
+func (t *http2Transport) dialClientConn(ctx context.Context, addr string, proxyURL *url.URL, singleUse bool) (*http2ClientConn, error) {
 	host, _, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
 	}
-	tconn, err := t.dialTLS()("tcp", addr, t.newTLSConfig(host))
+	tconn, err := t.dialTLS(ctx, "tcp", addr, proxyURL, t.newTLSConfig(host))
 	if err != nil {
 		return nil, err
 	}
@@ -7410,36 +7798,79 @@ func (t *http2Transport) newTLSConfig(host string) *tls.Config {
 	return cfg
 }
 
-func (t *http2Transport) dialTLS() func(string, string, *tls.Config) (net.Conn, error) {
+func (t *http2Transport) dialTLS(ctx context.Context, network, addr string, proxyURL *url.URL, cfg *tls.Config) (net.Conn, error) {
+	if t.DialTLSContext != nil {
+		return t.DialTLSContext(ctx, network, addr, cfg)
+	}
 	if t.DialTLS != nil {
-		return t.DialTLS
+		return t.DialTLS(network, addr, cfg)
 	}
-	return t.dialTLSDefault
+	return t.dialTLSDefault(ctx, network, addr, proxyURL, cfg)
 }
 
-func (t *http2Transport) dialTLSDefault(network, addr string, cfg *tls.Config) (net.Conn, error) {
-	cn, err := tls.Dial(network, addr, cfg)
+func (t *http2Transport) dialTLSDefault(ctx context.Context, network, addr string, proxyURL *url.URL, cfg *tls.Config) (net.Conn, error) {
+	dial := t.DialContext
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	if proxyURL != nil {
+		var proxyTLS *tls.Config
+		if t.TLSClientConfig != nil {
+			proxyTLS = t.TLSClientConfig.Clone()
+			proxyTLS.ServerName = ""
+		}
+		pd := &ProxyDialer{
+			ProxyURL:        proxyURL,
+			ConnectHeader:   t.ProxyConnectHeader,
+			DialProxy:       dial,
+			TLSClientConfig: proxyTLS,
+		}
+		dial = pd.DialContext
+	}
+	conn, err := dial(ctx, network, addr)
 	if err != nil {
 		return nil, err
 	}
-	if err := cn.Handshake(); err != nil {
+	cn := tls.Client(conn, cfg)
+	if err := http2tlsHandshake(ctx, cn); err != nil {
+		cn.Close()
 		return nil, err
 	}
 	if !cfg.InsecureSkipVerify {
 		if err := cn.VerifyHostname(cfg.ServerName); err != nil {
+			cn.Close()
 			return nil, err
 		}
 	}
 	state := cn.ConnectionState()
 	if p := state.NegotiatedProtocol; p != http2NextProtoTLS {
+		cn.Close()
 		return nil, fmt.Errorf("http2: unexpected ALPN protocol %q; want %q", p, http2NextProtoTLS)
 	}
 	if !state.NegotiatedProtocolIsMutual {
+		cn.Close()
 		return nil, errors.New("http2: could not negotiate protocol mutually")
 	}
 	return cn, nil
 }
 
+// tlsHandshake runs the handshake of cn, giving up when ctx is done.
+func http2tlsHandshake(ctx context.Context, cn *tls.Conn) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- cn.Handshake()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		cn.Close()
+		<-errc
+		return ctx.Err()
+	}
+}
+
 // disableKeepAlives reports whether connections should be closed as
 // soon as possible after handling the first request.
 func (t *http2Transport) disableKeepAlives() bool {
@@ -7458,6 +7889,26 @@ func (t *http2Transport) NewClientConn(c net.Conn) (*http2ClientConn, error) {
 }
 
 func (t *http2Transport) newClientConn(c net.Conn, addr string, singleUse bool) (*http2ClientConn, error) {
+	initialSettings := t.initialSettings()
+	for _, s := range initialSettings {
+		if err := s.Valid(); err != nil {
+			return nil, err
+		}
+	}
+	priorityFrames := t.priorityFrames()
+	for _, p := range priorityFrames {
+		if !http2validStreamID(p.StreamID) {
+			return nil, http2errStreamID
+		}
+		if !http2validStreamIDOrZero(p.StreamDep) || p.StreamDep == p.StreamID {
+			return nil, http2errDepStreamID
+		}
+	}
+	connFlow := t.connectionFlow()
+	if connFlow > http2maxConnFlow {
+		return nil, http2errConnFlow
+	}
+
 	cc := &http2ClientConn{
 		t:                     t,
 		tconn:                 c,
@@ -7466,6 +7917,7 @@ func (t *http2Transport) newClientConn(c net.Conn, addr string, singleUse bool)
 		nextStreamID:          1,
 		maxFrameSize:          16 << 10,           // spec default
 		initialWindowSize:     65535,              // spec default
+		streamFlow:            65535,              // spec default
 		maxConcurrentStreams:  1000,               // "infinite", per spec. 1000 seems good enough.
 		peerMaxHeaderListSize: 0xffffffffffffffff, // "infinite", per spec. Use 2^64-1 instead.
 		streams:               make(map[uint32]*http2clientStream),
@@ -7489,16 +7941,18 @@ func (t *http2Transport) newClientConn(c net.Conn, addr string, singleUse bool)
 	cc.bw = bufio.NewWriter(http2stickyErrWriter{c, &cc.werr})
 	cc.br = bufio.NewReader(c)
 	cc.fr = http2NewFramer(cc.bw, cc.br)
-	if t.HeaderTableSize != 0 {
-		cc.fr.ReadMetaHeaders = hpack.NewDecoder(t.HeaderTableSize, nil)
-	} else {
-		cc.fr.ReadMetaHeaders = hpack.NewDecoder(http2initialHeaderTableSize, nil)
-	}
 	cc.fr.MaxHeaderListSize = t.maxHeaderListSize()
 
-	// TODO: SetMaxDynamicTableSize, SetMaxDynamicTableSizeLimit on
-	// henc in response to SETTINGS frames?
+	// The encoder's table starts at the spec default of 4096 and
+	// follows the server's SETTINGS_HEADER_TABLE_SIZE, up to the
+	// Transport's limit.
 	cc.henc = hpack.NewEncoder(&cc.hbuf)
+	cc.henc.SetMaxDynamicTableSizeLimit(t.maxEncoderHeaderTableSize())
+	if encs := t.HeaderEncodings; encs != nil {
+		cc.henc.SetEncodingPolicy(func(f hpack.HeaderField) hpack.FieldEncoding {
+			return encs[f.Name]
+		})
+	}
 
 	if t.AllowHTTP {
 		cc.nextStreamID = 3
@@ -7509,26 +7963,75 @@ func (t *http2Transport) newClientConn(c net.Conn, addr string, singleUse bool)
 		cc.tlsState = &state
 	}
 
-	initialSettings := []http2Setting{}
+	// Derive our flow control and HPACK decoder state from the
+	// settings we announce, falling back to the spec defaults for
+	// the ones we leave out.
+	headerTableSize := uint32(http2initialHeaderTableSize)
+	for _, s := range initialSettings {
+		switch s.ID {
+		case http2SettingHeaderTableSize:
+			headerTableSize = s.Val
+		case http2SettingInitialWindowSize:
+			cc.streamFlow = int32(s.Val)
+		case http2SettingMaxFrameSize:
+			cc.fr.SetMaxReadFrameSize(s.Val)
+		case http2SettingMaxHeaderListSize:
+			cc.fr.MaxHeaderListSize = s.Val
+		}
+	}
+	cc.fr.ReadMetaHeaders = hpack.NewDecoder(headerTableSize, nil)
+	cc.connFlow = int32(connFlow)
 
-	var pushEnabled uint32
-	if t.PushHandler != nil {
-		pushEnabled = 1
+	_, err := cc.bw.Write(http2clientPreface)
+	if err == nil {
+		err = cc.fr.WriteSettings(initialSettings...)
+	}
+	if err == nil {
+		err = cc.fr.WriteWindowUpdate(0, uint32(cc.connFlow))
+	}
+	cc.inflow.add(cc.connFlow + http2initialWindowSize)
+	for _, p := range priorityFrames {
+		if err != nil {
+			break
+		}
+		err = cc.fr.WritePriority(p.StreamID, p.http2PriorityParam)
+		// Idle streams named in PRIORITY frames can't be opened
+		// later on, so new streams start above them.
+		if p.StreamID%2 == 1 && p.StreamID >= cc.nextStreamID {
+			cc.nextStreamID = p.StreamID + 2
+		}
 	}
-	initialSettings = append(initialSettings, http2Setting{ID: http2SettingEnablePush, Val: pushEnabled})
+	if err == nil {
+		err = cc.bw.Flush()
+	}
+	if err != nil {
+		cc.Close()
+		return nil, err
+	}
+
+	go cc.readLoop()
+	return cc, nil
+}
 
-	setMaxHeader := false
+// initialSettings returns the parameters of the SETTINGS frame written
+// after the client preface, in the order they are written.
+func (t *http2Transport) initialSettings() []http2Setting {
 	if t.Settings != nil {
-		for _, setting := range t.Settings {
-			if setting.ID == http2SettingMaxHeaderListSize {
-				setMaxHeader = true
-			}
-			if setting.ID == http2SettingHeaderTableSize || setting.ID == http2SettingInitialWindowSize {
-				return nil, http2errSettingsIncludeIllegalSettings
-			}
-			initialSettings = append(initialSettings, setting)
+		return t.Settings
+	}
+	if p := t.profile(); p != nil && len(p.Settings) > 0 {
+		initialSettings := make([]http2Setting, len(p.Settings))
+		for i, s := range p.Settings {
+			initialSettings[i] = http2Setting{ID: http2SettingID(s.ID), Val: s.Val}
 		}
+		return initialSettings
 	}
+
+	var pushEnabled uint32
+	if t.PushHandler != nil {
+		pushEnabled = 1
+	}
+	initialSettings := []http2Setting{{ID: http2SettingEnablePush, Val: pushEnabled}}
 	if t.InitialWindowSize != 0 {
 		initialSettings = append(initialSettings, http2Setting{ID: http2SettingInitialWindowSize, Val: t.InitialWindowSize})
 	} else {
@@ -7539,22 +8042,10 @@ func (t *http2Transport) newClientConn(c net.Conn, addr string, singleUse bool)
 	} else {
 		initialSettings = append(initialSettings, http2Setting{ID: http2SettingHeaderTableSize, Val: http2initialHeaderTableSize})
 	}
-	if max := t.maxHeaderListSize(); max != 0 && !setMaxHeader {
+	if max := t.maxHeaderListSize(); max != 0 {
 		initialSettings = append(initialSettings, http2Setting{ID: http2SettingMaxHeaderListSize, Val: max})
 	}
-
-	cc.bw.Write(http2clientPreface)
-	cc.fr.WriteSettings(initialSettings...)
-	cc.fr.WriteWindowUpdate(0, http2transportDefaultConnFlow)
-	cc.inflow.add(http2transportDefaultConnFlow + http2initialWindowSize)
-	cc.bw.Flush()
-	if cc.werr != nil {
-		cc.Close()
-		return nil, cc.werr
-	}
-
-	go cc.readLoop()
-	return cc, nil
+	return initialSettings
 }
 
 func (cc *http2ClientConn) healthCheck() {
@@ -7604,6 +8095,14 @@ func (cc *http2ClientConn) CanTakeNewRequest() bool {
 	return cc.canTakeNewRequestLocked()
 }
 
+// HeaderEncoderState returns the state of the HPACK dynamic table
+// used to encode request headers on cc. It is meant for debugging.
+func (cc *http2ClientConn) HeaderEncoderState() hpack.TableState {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.henc.TableState()
+}
+
 // clientConnIdleState describes the suitability of a client
 // connection to initiate a new RoundTrip request.
 type http2clientConnIdleState struct {
@@ -7932,8 +8431,21 @@ func (cc *http2ClientConn) roundTrip(req *Request) (res *Response, gotErrAfterRe
 
 	cc.wmu.Lock()
 	endStream := !hasBody && !hasTrailers
-	werr := cc.writeHeaders(cs.ID, endStream, int(cc.maxFrameSize), hdrs)
+	priority, hasPriority := cc.headersPriority(req)
+	var pp *http2PriorityParam
+	if hasPriority {
+		pp = &priority
+	}
+	werr := cc.writeHeaders(cs.ID, endStream, int(cc.maxFrameSize), pp, hdrs)
+	if p, ok := PriorityUpdateFromContext(req.Context()); ok && werr == nil {
+		cc.fr.WritePriorityUpdate(cs.ID, p.String())
+		cc.bw.Flush()
+		werr = cc.werr
+	}
 	cc.wmu.Unlock()
+	if hasPriority {
+		http2traceWroteHeadersPriority(cs.trace, cs.ID, priority)
+	}
 	http2traceWroteHeaders(cs.trace)
 	cc.mu.Unlock()
 
@@ -7980,6 +8492,10 @@ func (cc *http2ClientConn) roundTrip(req *Request) (res *Response, gotErrAfterRe
 			bodyWriter.cancel()
 			cs.abortRequestBodyWrite(http2errStopReqBodyWrite)
 			if hasBody && !bodyWritten {
+				// The body write may be blocked in a Read
+				// that only returns once the body is closed,
+				// as with a pipe streaming to the server.
+				go req.Body.Close()
 				<-bodyWriter.resc
 			}
 		}
@@ -8095,23 +8611,54 @@ func (cc *http2ClientConn) awaitOpenSlotForRequest(req *Request) error {
 	}
 }
 
+// headersPriority returns the priority to send in the HEADERS frame of
+// req: the StreamPriority of its context, or else the HeaderPriority of
+// the Transport's profile. It reports false if neither is set, in which
+// case the HEADERS frame carries no priority.
+func (cc *http2ClientConn) headersPriority(req *Request) (http2PriorityParam, bool) {
+	p, ok := StreamPriorityFromContext(req.Context())
+	if !ok && cc.t != nil {
+		if profile := cc.t.profile(); profile != nil && profile.HeaderPriority != nil {
+			p, ok = *profile.HeaderPriority, true
+		}
+	}
+	if !ok {
+		return http2PriorityParam{}, false
+	}
+	return http2PriorityParam{
+		StreamDep: p.StreamDep,
+		Exclusive: p.Exclusive,
+		Weight:    p.Weight,
+	}, true
+}
+
+// writeHeaders writes hdrs as a HEADERS frame and any CONTINUATION
+// frames it needs. The HEADERS frame carries priority if it is non-nil.
 // requires cc.wmu be held
-func (cc *http2ClientConn) writeHeaders(streamID uint32, endStream bool, maxFrameSize int, hdrs []byte) error {
+func (cc *http2ClientConn) writeHeaders(streamID uint32, endStream bool, maxFrameSize int, priority *http2PriorityParam, hdrs []byte) error {
 	first := true // first frame written (HEADERS is first, then CONTINUATION)
 	for len(hdrs) > 0 && cc.werr == nil {
 		chunk := hdrs
-		if len(chunk) > maxFrameSize {
-			chunk = chunk[:maxFrameSize]
+		max := maxFrameSize
+		if first && priority != nil {
+			max -= 5 // priority fields take 5 bytes of the HEADERS payload
+		}
+		if len(chunk) > max {
+			chunk = chunk[:max]
 		}
 		hdrs = hdrs[len(chunk):]
 		endHeaders := len(hdrs) == 0
 		if first {
-			cc.fr.WriteHeaders(http2HeadersFrameParam{
+			p := http2HeadersFrameParam{
 				StreamID:      streamID,
 				BlockFragment: chunk,
 				EndStream:     endStream,
 				EndHeaders:    endHeaders,
-			})
+			}
+			if priority != nil {
+				p.Priority, p.HasPriority = *priority, true
+			}
+			cc.fr.WriteHeaders(p)
 			first = false
 		} else {
 			cc.fr.WriteContinuation(streamID, endHeaders, chunk)
@@ -8276,7 +8823,7 @@ func (cs *http2clientStream) writeRequestBody(body io.Reader, bodyCloser io.Clos
 	// Two ways to send END_STREAM: either with trailers, or
 	// with an empty DATA frame.
 	if len(trls) > 0 {
-		err = cc.writeHeaders(cs.ID, true, maxFrameSize, trls)
+		err = cc.writeHeaders(cs.ID, true, maxFrameSize, nil, trls)
 	} else {
 		err = cc.fr.WriteData(cs.ID, true, nil)
 	}
@@ -8369,6 +8916,10 @@ func (cc *http2ClientConn) encodeHeaders(req *Request, addGzipHeader bool, trail
 		}
 	}
 
+	var profile *ClientProfile
+	if cc.t != nil {
+		profile = cc.t.profile()
+	}
 	enumerateHeaders := func(f func(name, value string)) {
 		// 8.1.2.3 Request Pseudo-Header Fields
 		// The :path pseudo-header field includes the path and query parts of the
@@ -8377,6 +8928,9 @@ func (cc *http2ClientConn) encodeHeaders(req *Request, addGzipHeader bool, trail
 		// [RFC3986]).
 
 		pHeaderOrder, ok := req.Header[PHeaderOrderKey]
+		if !ok && profile != nil && len(profile.PHeaderOrder) > 0 {
+			pHeaderOrder, ok = profile.PHeaderOrder, true
+		}
 		m := req.Method
 		if m == "" {
 			m = MethodGet
@@ -8428,16 +8982,25 @@ func (cc *http2ClientConn) encodeHeaders(req *Request, addGzipHeader bool, trail
 			hdrs["accept-encoding"] = []string{"gzip, deflate, br"}
 		}
 
+		// RFC 9218 priority, unless the request sets its own header.
+		if p, ok := ExtensiblePriorityFromContext(req.Context()); ok {
+			if _, ok := hdrs["priority"]; !ok && hdrs.Get("Priority") == "" {
+				if v := p.String(); v != "" {
+					hdrs["priority"] = []string{v}
+				}
+			}
+		}
+
 		// Formats and writes headers with f function
 		var didUA bool
 		var kvs []HeaderKeyValues
 
-		if headerOrder, ok := hdrs[HeaderOrderKey]; ok {
-			order := make(map[string]int)
-			for i, v := range headerOrder {
-				order[v] = i
-			}
-			kvs, _ = hdrs.SortedKeyValuesBy(order, make(map[string]bool))
+		headerOrder, ok := hdrs[HeaderOrderKey]
+		if !ok && profile != nil && len(profile.HeaderOrder) > 0 {
+			headerOrder, ok = profile.HeaderOrder, true
+		}
+		if ok {
+			kvs = hdrs.OrderedKeyValues(headerOrder, nil)
 		} else {
 			kvs, _ = hdrs.SortedKeyValues(make(map[string]bool))
 		}
@@ -8482,6 +9045,9 @@ func (cc *http2ClientConn) encodeHeaders(req *Request, addGzipHeader bool, trail
 				// User-Agent. If set to nil or empty string,
 				// then omit it. Otherwise if not mentioned,
 				// include the default (below).
+				if didUA {
+					continue
+				}
 				didUA = true
 				if len(kv.Values) > 1 {
 					kv.Values = kv.Values[:1]
@@ -8520,6 +9086,7 @@ func (cc *http2ClientConn) encodeHeaders(req *Request, addGzipHeader bool, trail
 	traceHeaders := http2traceHasWroteHeaderField(trace)
 
 	// Header list size is ok. Write the headers.
+	sensitive := SensitiveHeadersFromContext(req.Context())
 	enumerateHeaders(func(name, value string) {
 		// skips over writing magic key headers
 		if name == PHeaderOrderKey || name == HeaderOrderKey {
@@ -8527,7 +9094,7 @@ func (cc *http2ClientConn) encodeHeaders(req *Request, addGzipHeader bool, trail
 		}
 
 		name = strings.ToLower(name)
-		cc.writeHeader(name, value)
+		cc.writeHeader(name, value, sensitive)
 		if traceHeaders {
 			http2traceWroteHeaderField(trace, name, value)
 		}
@@ -8573,22 +9140,32 @@ func (cc *http2ClientConn) encodeTrailers(req *Request) ([]byte, error) {
 		return nil, http2errRequestHeaderListSize
 	}
 
+	sensitive := SensitiveHeadersFromContext(req.Context())
 	for k, vv := range req.Trailer {
 		// Transfer-Encoding, etc.. have already been filtered at the
 		// start of RoundTrip
 		lowKey := strings.ToLower(k)
 		for _, v := range vv {
-			cc.writeHeader(lowKey, v)
+			cc.writeHeader(lowKey, v, sensitive)
 		}
 	}
 	return cc.hbuf.Bytes(), nil
 }
 
-func (cc *http2ClientConn) writeHeader(name, value string) {
+// writeHeader encodes the lowercase header field name: value. It is
+// encoded as never indexed if name is listed in sensitive.
+func (cc *http2ClientConn) writeHeader(name, value string, sensitive []string) {
 	if http2VerboseLogs {
 		log.Printf("http2: Transport encoding header %q = %q", name, value)
 	}
-	cc.henc.WriteField(hpack.HeaderField{Name: name, Value: value})
+	hf := hpack.HeaderField{Name: name, Value: value}
+	for _, s := range sensitive {
+		if s == name {
+			hf.Sensitive = true
+			break
+		}
+	}
+	cc.henc.WriteField(hf)
 }
 
 type http2resAndError struct {
@@ -8608,7 +9185,7 @@ func (cc *http2ClientConn) newStreamWithID(streamID uint32, incNext bool) *http2
 	}
 	cs.flow.add(int32(cc.initialWindowSize))
 	cs.flow.setConnFlow(&cc.flow)
-	cs.inflow.add(http2transportDefaultStreamFlow)
+	cs.inflow.add(cc.streamFlow)
 	cs.inflow.setConnFlow(&cc.inflow)
 	cc.streams[cs.ID] = cs
 
@@ -8897,6 +9474,10 @@ func (rl *http2clientConnReadLoop) handleResponse(cs *http2clientStream, f *http
 		Header:     header,
 		StatusCode: statusCode,
 		Status:     status + " " + StatusText(statusCode),
+		RawHeaders: make([]RawHeader, len(f.Fields)),
+	}
+	for i, hf := range f.Fields {
+		res.RawHeaders[i] = RawHeader{Name: hf.Name, Value: hf.Value}
 	}
 	for _, hf := range regularFields {
 		key := CanonicalHeaderKey(hf.Name)
@@ -9047,8 +9628,8 @@ func (b http2transportResponseBody) Read(p []byte) (n int, err error) {
 
 	var connAdd, streamAdd int32
 	// Check the conn-level first, before the stream-level.
-	if v := cc.inflow.available(); v < http2transportDefaultConnFlow/2 {
-		connAdd = http2transportDefaultConnFlow - v
+	if v := cc.inflow.available(); v < cc.connFlow/2 {
+		connAdd = cc.connFlow - v
 		cc.inflow.add(connAdd)
 	}
 	if err == nil { // No need to refresh if the stream is over or failed.
@@ -9056,8 +9637,8 @@ func (b http2transportResponseBody) Read(p []byte) (n int, err error) {
 		// consumed by the client) when computing flow control for this
 		// stream.
 		v := int(cs.inflow.available()) + cs.bufPipe.Len()
-		if v < http2transportDefaultStreamFlow-http2transportDefaultStreamMinRefresh {
-			streamAdd = int32(http2transportDefaultStreamFlow - v)
+		if v < int(cc.streamFlow)-http2transportDefaultStreamMinRefresh {
+			streamAdd = cc.streamFlow - int32(v)
 			cs.inflow.add(streamAdd)
 		}
 	}
@@ -9271,6 +9852,10 @@ func (rl *http2clientConnReadLoop) processSettings(f *http2SettingsFrame) error
 			cc.maxConcurrentStreams = s.Val
 		case http2SettingMaxHeaderListSize:
 			cc.peerMaxHeaderListSize = uint64(s.Val)
+		case http2SettingHeaderTableSize:
+			// RFC 7541, Section 4.2: the new size is signaled
+			// at the start of the next header block.
+			cc.henc.SetMaxDynamicTableSize(s.Val)
 		case http2SettingInitialWindowSize:
 			// Values above the maximum flow-control
 			// window size of 2^31-1 MUST be treated as a
@@ -9291,7 +9876,6 @@ func (rl *http2clientConnReadLoop) processSettings(f *http2SettingsFrame) error
 
 			cc.initialWindowSize = s.Val
 		default:
-			// TODO(bradfitz): handle more settings? SETTINGS_HEADER_TABLE_SIZE probably.
 			cc.vlogf("Unhandled Setting: %v", s)
 		}
 		return nil
@@ -9692,6 +10276,17 @@ func http2traceWroteHeaders(trace *httptrace.ClientTrace) {
 	}
 }
 
+func http2traceWroteHeadersPriority(trace *httptrace.ClientTrace, streamID uint32, p http2PriorityParam) {
+	if trace != nil && trace.WroteHeadersPriority != nil {
+		trace.WroteHeadersPriority(httptrace.HeadersPriorityInfo{
+			StreamID:  streamID,
+			StreamDep: p.StreamDep,
+			Exclusive: p.Exclusive,
+			Weight:    p.Weight,
+		})
+	}
+}
+
 func http2traceGot100Continue(trace *httptrace.ClientTrace) {
 	if trace != nil && trace.Got100Continue != nil {
 		trace.Got100Continue()
@@ -10310,6 +10905,188 @@ func (p *http2writeQueuePool) get() *http2writeQueue {
 	return q
 }
 
+// ExtensiblePriorityWriteScheduler is a WriteScheduler that schedules
+// streams by their RFC 9218 extensible priority. The Server parses the
+// "priority" request header and PRIORITY_UPDATE frames for schedulers
+// that implement it.
+type http2ExtensiblePriorityWriteScheduler interface {
+	http2WriteScheduler
+
+	// AdjustStreamExtensible sets the extensible priority of the
+	// given stream. It may be called on a stream that is not open,
+	// in which case it does nothing.
+	AdjustStreamExtensible(streamID uint32, priority ExtensiblePriority)
+}
+
+// NewExtensiblePriorityWriteScheduler constructs a WriteScheduler that
+// follows RFC 9218. Control frames are written first. Otherwise the
+// streams with the lowest urgency are served first; among those,
+// non-incremental streams are written one at a time in stream ID
+// order, and incremental streams share the connection round-robin.
+// RFC 7540 priorities are ignored.
+func http2NewExtensiblePriorityWriteScheduler() http2ExtensiblePriorityWriteScheduler {
+	return &http2extensibleWriteScheduler{sq: make(map[uint32]*http2extensibleStream)}
+}
+
+type http2extensibleStream struct {
+	id       uint32
+	priority ExtensiblePriority
+	q        *http2writeQueue
+	open     bool // false for idle or closed streams with a queued RST_STREAM
+}
+
+type http2extensibleWriteScheduler struct {
+	// zero are frames not associated with a specific stream.
+	zero http2writeQueue
+
+	// sq contains the open streams and streams with queued frames,
+	// keyed by stream ID.
+	sq map[uint32]*http2extensibleStream
+
+	// byUrgency holds the streams of sq per urgency, ordered by
+	// stream ID.
+	byUrgency [8][]*http2extensibleStream
+
+	// lastIncremental is, per urgency, the ID of the incremental
+	// stream written last, so the next one can be picked round-robin.
+	lastIncremental [8]uint32
+
+	// pool of empty queues for reuse.
+	queuePool http2writeQueuePool
+}
+
+func (ws *http2extensibleWriteScheduler) OpenStream(streamID uint32, options http2OpenStreamOptions) {
+	if st, ok := ws.sq[streamID]; ok {
+		st.open = true
+		return
+	}
+	st := &http2extensibleStream{
+		id:       streamID,
+		priority: DefaultExtensiblePriority,
+		q:        ws.queuePool.get(),
+		open:     true,
+	}
+	ws.sq[streamID] = st
+	ws.insert(st)
+}
+
+func (ws *http2extensibleWriteScheduler) CloseStream(streamID uint32) {
+	st, ok := ws.sq[streamID]
+	if !ok {
+		return
+	}
+	delete(ws.sq, streamID)
+	ws.remove(st)
+	ws.queuePool.put(st.q)
+}
+
+func (ws *http2extensibleWriteScheduler) AdjustStream(streamID uint32, priority http2PriorityParam) {
+	// no-op: RFC 7540 priorities are ignored
+}
+
+func (ws *http2extensibleWriteScheduler) AdjustStreamExtensible(streamID uint32, priority ExtensiblePriority) {
+	if st, ok := ws.sq[streamID]; ok {
+		if priority.Urgency > 7 {
+			priority.Urgency = 7
+		}
+		ws.remove(st)
+		st.priority = priority
+		ws.insert(st)
+	}
+}
+
+func (ws *http2extensibleWriteScheduler) Push(wr http2FrameWriteRequest) {
+	id := wr.StreamID()
+	if id == 0 {
+		ws.zero.push(wr)
+		return
+	}
+	st, ok := ws.sq[id]
+	if !ok {
+		// RST_STREAM on an idle or closed stream. Keep it until
+		// written; it's removed again once the queue drains.
+		st = &http2extensibleStream{
+			id:       id,
+			priority: DefaultExtensiblePriority,
+			q:        ws.queuePool.get(),
+		}
+		ws.sq[id] = st
+		ws.insert(st)
+	}
+	st.q.push(wr)
+}
+
+func (ws *http2extensibleWriteScheduler) Pop() (http2FrameWriteRequest, bool) {
+	// Control frames first.
+	if !ws.zero.empty() {
+		return ws.zero.shift(), true
+	}
+
+	for u, sts := range ws.byUrgency {
+		// Non-incremental streams are served sequentially.
+		for _, st := range sts {
+			if !st.priority.Incremental && !st.q.empty() {
+				if wr, ok := ws.consume(st); ok {
+					return wr, true
+				}
+			}
+		}
+
+		// Incremental streams take turns, starting after the one
+		// written last.
+		start := sort.Search(len(sts), func(i int) bool { return sts[i].id > ws.lastIncremental[u] })
+		for i := range sts {
+			st := sts[(start+i)%len(sts)]
+			if !st.priority.Incremental || st.q.empty() {
+				continue
+			}
+			if wr, ok := ws.consume(st); ok {
+				ws.lastIncremental[u] = st.id
+				return wr, true
+			}
+		}
+	}
+	return http2FrameWriteRequest{}, false
+}
+
+// consume pops the next frame of st, if flow control allows. Streams
+// that were never opened are dropped once their queue is drained.
+func (ws *http2extensibleWriteScheduler) consume(st *http2extensibleStream) (http2FrameWriteRequest, bool) {
+	wr, ok := st.q.consume(math.MaxInt32)
+	if !ok {
+		return http2FrameWriteRequest{}, false
+	}
+	if st.q.empty() && !st.open {
+		delete(ws.sq, st.id)
+		ws.remove(st)
+		ws.queuePool.put(st.q)
+	}
+	return wr, true
+}
+
+// insert adds st to the streams of its urgency, keeping them ordered
+// by stream ID.
+func (ws *http2extensibleWriteScheduler) insert(st *http2extensibleStream) {
+	sts := ws.byUrgency[st.priority.Urgency]
+	i := sort.Search(len(sts), func(i int) bool { return sts[i].id >= st.id })
+	sts = append(sts, nil)
+	copy(sts[i+1:], sts[i:])
+	sts[i] = st
+	ws.byUrgency[st.priority.Urgency] = sts
+}
+
+// remove deletes st from the streams of its urgency.
+func (ws *http2extensibleWriteScheduler) remove(st *http2extensibleStream) {
+	sts := ws.byUrgency[st.priority.Urgency]
+	i := sort.Search(len(sts), func(i int) bool { return sts[i].id >= st.id })
+	if i == len(sts) || sts[i] != st {
+		return
+	}
+	copy(sts[i:], sts[i+1:])
+	sts[len(sts)-1] = nil
+	ws.byUrgency[st.priority.Urgency] = sts[:len(sts)-1]
+}
+
 // RFC 7540, Section 5.3.5: the default weight is 16.
 const http2priorityDefaultWeight = 15 // 16 = 15 + 1
 
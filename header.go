@@ -5,6 +5,9 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"net/textproto"
 	"sort"
@@ -13,6 +16,7 @@ import (
 	"time"
 
 	"github.com/useflyent/fhttp/httptrace"
+	"golang.org/x/net/http/httpguts"
 )
 
 // A Header represents the Key-value pairs in an HTTP header.
@@ -40,6 +44,93 @@ const HeaderOrderKey = "Header-Order:"
 // Valid fields are :authority, :method, :path, :scheme
 const PHeaderOrderKey = "PHeader-Order:"
 
+var sensitiveHeadersContextKey = &contextKey{"sensitive-headers"}
+
+// WithSensitiveHeaders returns a copy of ctx that marks the named
+// request headers, such as "cookie" or "authorization", as sensitive.
+// HTTP/2 requests made with the returned context encode them with the
+// HPACK "never indexed" representation, so they are never added to
+// the compression table of the connection or of any intermediary.
+// Names are matched case-insensitively.
+func WithSensitiveHeaders(ctx context.Context, names ...string) context.Context {
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	return context.WithValue(ctx, sensitiveHeadersContextKey, lower)
+}
+
+// SensitiveHeadersFromContext returns the lowercase header names
+// marked as sensitive in ctx by WithSensitiveHeaders, if any.
+func SensitiveHeadersFromContext(ctx context.Context) []string {
+	names, _ := ctx.Value(sensitiveHeadersContextKey).([]string)
+	return names
+}
+
+// A RawHeader is a header field as it was received, with its name
+// spelled as sent.
+type RawHeader struct {
+	Name  string
+	Value string
+}
+
+// readMIMEHeaderRaw is like tp.ReadMIMEHeader, but also returns the
+// header lines as received, in order. Both are filled in one pass:
+// continuation lines are joined to the previous line with a space,
+// and a line without a colon or with an empty or invalid name or an
+// invalid value is an error.
+func readMIMEHeaderRaw(tp *textproto.Reader) (textproto.MIMEHeader, []RawHeader, error) {
+	m := make(textproto.MIMEHeader)
+	var raw []RawHeader
+
+	// The first line cannot start with a leading space.
+	if buf, err := tp.R.Peek(1); err == nil && (buf[0] == ' ' || buf[0] == '\t') {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return m, raw, err
+		}
+		return m, raw, textproto.ProtocolError("malformed MIME header initial line: " + line)
+	}
+
+	for {
+		kv, err := tp.ReadContinuedLineBytes()
+		if len(kv) == 0 {
+			return m, raw, err
+		}
+
+		// Key ends at first colon.
+		i := bytes.IndexByte(kv, ':')
+		if i < 0 {
+			return m, raw, textproto.ProtocolError(fmt.Sprintf("malformed MIME header line: %q", kv))
+		}
+		name := string(kv[:i])
+		value := string(bytes.TrimLeft(kv[i+1:], " \t"))
+		if name == "" || !validReceivedHeaderName(name) || !httpguts.ValidHeaderFieldValue(value) {
+			return m, raw, textproto.ProtocolError(fmt.Sprintf("malformed MIME header line: %q", kv))
+		}
+
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		m[key] = append(m[key], value)
+		raw = append(raw, RawHeader{Name: name, Value: value})
+
+		if err != nil {
+			return m, raw, err
+		}
+	}
+}
+
+// validReceivedHeaderName reports whether name is made of token
+// characters and spaces. As in textproto, a space before the colon
+// is accepted, and leaves the name uncanonicalized.
+func validReceivedHeaderName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c != ' ' && !httpguts.IsTokenRune(rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
 // Add adds the Key, value pair to the header.
 // It appends to any existing Values associated with Key.
 // The Key is case insensitive; it is canonicalized by
@@ -103,7 +194,7 @@ func (h Header) Write(w io.Writer) error {
 }
 
 func (h Header) write(w io.Writer, trace *httptrace.ClientTrace) error {
-	return h.writeSubset(w, nil, trace)
+	return h.writeSubset(w, nil, trace, false)
 }
 
 // Clone returns a copy of h or nil if h is nil.
@@ -196,8 +287,6 @@ var headerSorterPool = sync.Pool{
 	New: func() interface{} { return new(headerSorter) },
 }
 
-var mutex = &sync.RWMutex{}
-
 // SortedKeyValues returns h's keys sorted in the returned kvs
 // slice. The headerSorter used to sort is also returned, for possible
 // return to headerSorterCache.
@@ -208,11 +297,9 @@ func (h Header) SortedKeyValues(exclude map[string]bool) (kvs []HeaderKeyValues,
 	}
 	kvs = hs.kvs[:0]
 	for k, vv := range h {
-		mutex.RLock()
 		if !exclude[k] {
 			kvs = append(kvs, HeaderKeyValues{k, vv})
 		}
-		mutex.RUnlock()
 	}
 	hs.kvs = kvs
 	sort.Sort(hs)
@@ -226,11 +313,9 @@ func (h Header) SortedKeyValuesBy(order map[string]int, exclude map[string]bool)
 	}
 	kvs = hs.kvs[:0]
 	for k, vv := range h {
-		mutex.RLock()
 		if !exclude[k] {
 			kvs = append(kvs, HeaderKeyValues{k, vv})
 		}
-		mutex.RUnlock()
 	}
 	hs.kvs = kvs
 	hs.order = order
@@ -239,14 +324,77 @@ func (h Header) SortedKeyValuesBy(order map[string]int, exclude map[string]bool)
 	return kvs, hs
 }
 
+// OrderedKeyValues returns h's keys in the given order of header
+// names, which are matched case-insensitively. Keys not in order follow
+// the ordered ones, sorted lexicographically.
+//
+// A name may be listed more than once to interleave the values of a
+// multi-value header with other headers: the i-th listing of a name
+// gets its i-th value, and the last listing gets all remaining
+// values. Listings beyond the number of values are skipped. For
+// example, the order ["a", "b", "a"] with a: [1, 2] and b: [3]
+// yields a: [1], b: [3], a: [2]. A key may thus appear in several of
+// the returned HeaderKeyValues.
+func (h Header) OrderedKeyValues(order []string, exclude map[string]bool) []HeaderKeyValues {
+	positions := make(map[string][]int, len(order))
+	for i, name := range order {
+		name = strings.ToLower(name)
+		positions[name] = append(positions[name], i)
+	}
+
+	type entry struct {
+		pos int
+		kv  HeaderKeyValues
+	}
+	entries := make([]entry, 0, len(h))
+	for k, vv := range h {
+		if exclude[k] {
+			continue
+		}
+		pos, ok := positions[k]
+		if !ok {
+			pos = positions[strings.ToLower(k)]
+		}
+		if len(pos) == 0 {
+			entries = append(entries, entry{len(order), HeaderKeyValues{k, vv}})
+			continue
+		}
+		for i, p := range pos {
+			if i >= len(vv) {
+				break
+			}
+			if i == len(pos)-1 {
+				entries = append(entries, entry{p, HeaderKeyValues{k, vv[i:]}})
+			} else {
+				entries = append(entries, entry{p, HeaderKeyValues{k, vv[i : i+1]}})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].pos != entries[j].pos {
+			return entries[i].pos < entries[j].pos
+		}
+		return entries[i].kv.Key < entries[j].kv.Key
+	})
+
+	kvs := make([]HeaderKeyValues, len(entries))
+	for i, e := range entries {
+		kvs[i] = e.kv
+	}
+	return kvs
+}
+
 // WriteSubset writes a header in wire format.
 // If exclude is not nil, keys where exclude[Key] == true are not written.
 // Keys are not canonicalized before checking the exclude map.
 func (h Header) WriteSubset(w io.Writer, exclude map[string]bool) error {
-	return h.writeSubset(w, exclude, nil)
+	return h.writeSubset(w, exclude, nil, false)
 }
 
-func (h Header) writeSubset(w io.Writer, exclude map[string]bool, trace *httptrace.ClientTrace) error {
+// writeSubset is like WriteSubset. If preserveCase is set, header names
+// listed in h[HeaderOrderKey] are written as spelled there; a name
+// listed more than once is spelled as in each listing.
+func (h Header) writeSubset(w io.Writer, exclude map[string]bool, trace *httptrace.ClientTrace, preserveCase bool) error {
 	ws, ok := w.(io.StringWriter)
 	if !ok {
 		ws = stringWriter{w}
@@ -254,33 +402,50 @@ func (h Header) writeSubset(w io.Writer, exclude map[string]bool, trace *httptra
 
 	var kvs []HeaderKeyValues
 	var sorter *headerSorter
+	var wireNames map[string][]string // lowercase name -> names as written
+	var written map[string]int        // lowercase name -> listings used
 
 	// Check if the HeaderOrder is defined.
 	if headerOrder, ok := h[HeaderOrderKey]; ok {
-		order := make(map[string]int)
-		for i, v := range headerOrder {
-			order[v] = i
-		}
-		if exclude == nil {
-			exclude = make(map[string]bool)
+		if preserveCase {
+			wireNames = make(map[string][]string, len(headerOrder))
+			written = make(map[string]int, len(headerOrder))
+			for _, name := range headerOrder {
+				lower := strings.ToLower(name)
+				wireNames[lower] = append(wireNames[lower], name)
+			}
 		}
-		mutex.Lock()
-		exclude[HeaderOrderKey] = true
-		exclude[PHeaderOrderKey] = true
-		mutex.Unlock()
-		kvs, sorter = h.SortedKeyValuesBy(order, exclude)
+		kvs = h.OrderedKeyValues(headerOrder, exclude)
 	} else {
 		kvs, sorter = h.SortedKeyValues(exclude)
 	}
 
 	var formattedVals []string
 	for _, kv := range kvs {
+		if kv.Key == HeaderOrderKey || kv.Key == PHeaderOrderKey {
+			// Magic keys are never written.
+			continue
+		}
+		if wireNames != nil {
+			// OrderedKeyValues returns one kv per listing, in order.
+			lower := strings.ToLower(kv.Key)
+			if names := wireNames[lower]; len(names) > 0 {
+				i := written[lower]
+				if i >= len(names) {
+					i = len(names) - 1
+				}
+				kv.Key = names[i]
+				written[lower]++
+			}
+		}
 		for _, v := range kv.Values {
 			v = headerNewlineToSpace.Replace(v)
 			v = textproto.TrimString(v)
 			for _, s := range []string{kv.Key, ": ", v, "\r\n"} {
 				if _, err := ws.WriteString(s); err != nil {
-					headerSorterPool.Put(sorter)
+					if sorter != nil {
+						headerSorterPool.Put(sorter)
+					}
 					return err
 				}
 			}
@@ -293,7 +458,9 @@ func (h Header) writeSubset(w io.Writer, exclude map[string]bool, trace *httptra
 			formattedVals = nil
 		}
 	}
-	headerSorterPool.Put(sorter)
+	if sorter != nil {
+		headerSorterPool.Put(sorter)
+	}
 	return nil
 }
 
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"reflect"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -142,6 +143,17 @@ var headerWriteTests = []struct {
 			"Accept: application/json\r\nTransfer-Encoding: chunked\r\nHost: prod.jdgroupmesh.cloud\r\nConnection: Keep-Alive\r\n" +
 			"Accept-Encoding: gzip\r\n",
 	},
+	// Repeated names in Header-Order interleave multi-value headers.
+	{
+		Header{
+			"cookie":       {"a=1", "b=2", "c=3"},
+			"accept":       {"*/*"},
+			"x-one":        {"1"},
+			HeaderOrderKey: {"cookie", "accept", "cookie", "x-one"},
+		},
+		nil,
+		"cookie: a=1\r\naccept: */*\r\ncookie: b=2\r\ncookie: c=3\r\nx-one: 1\r\n",
+	},
 }
 
 func TestHeaderWrite(t *testing.T) {
@@ -155,6 +167,27 @@ func TestHeaderWrite(t *testing.T) {
 	}
 }
 
+func TestHeaderOrderedKeyValues(t *testing.T) {
+	h := Header{
+		"a": {"1", "2"},
+		"b": {"3"},
+		"c": {"4"},
+		"z": {"5"},
+	}
+	order := []string{"a", "b", "a", "c", "c", "a"}
+	got := h.OrderedKeyValues(order, map[string]bool{"z": false})
+	want := []HeaderKeyValues{
+		{"a", []string{"1"}},
+		{"b", []string{"3"}},
+		{"a", []string{"2"}},
+		{"c", []string{"4"}},
+		{"z", []string{"5"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OrderedKeyValues = %v; want %v", got, want)
+	}
+}
+
 var parseTimeTests = []struct {
 	h   Header
 	err bool
@@ -359,3 +392,103 @@ func TestHTTP1HeaderOrder(t *testing.T) {
 		t.Fatalf("got:\n%swant:\n%s", buf.String(), expected)
 	}
 }
+
+func TestHTTP1PreserveHeaderCase(t *testing.T) {
+	req, err := NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.PreserveHeaderCase = true
+	req.Header.Set("X-NewRelic-ID", "12345")
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("User-Agent", "ua")
+	req.Header[HeaderOrderKey] = []string{"Host", "X-NewRelic-ID", "accept", "USER-AGENT"}
+
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "GET / HTTP/1.1\r\nHost: example.com\r\nX-NewRelic-ID: 12345\r\naccept: */*\r\nUSER-AGENT: ua\r\nCache-Control: no-cache\r\n\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+
+	// Without PreserveHeaderCase, the order still applies but names
+	// are written as stored.
+	req.PreserveHeaderCase = false
+	buf.Reset()
+	if err := req.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want = "GET / HTTP/1.1\r\nHost: example.com\r\nX-Newrelic-Id: 12345\r\nAccept: */*\r\nUser-Agent: ua\r\nCache-Control: no-cache\r\n\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+
+	// Redirects keep the casing of the initial request.
+	req.PreserveHeaderCase = true
+	var wrote []string
+	c := &Client{Transport: writingTransport(func(req *Request) (*Response, error) {
+		var buf bytes.Buffer
+		if err := req.Write(&buf); err != nil {
+			return nil, err
+		}
+		wrote = append(wrote, buf.String())
+		res := &Response{StatusCode: StatusOK, Header: Header{}, Body: NoBody, Request: req}
+		if req.URL.Path == "/" {
+			res.StatusCode = StatusFound
+			res.Header.Set("Location", "/next")
+		}
+		return res, nil
+	})}
+	c.RedirectHeaders = func(req *Request, via []*Request) {}
+	if _, err := c.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	want = "GET /next HTTP/1.1\r\nHost: example.com\r\nX-NewRelic-ID: 12345\r\naccept: */*\r\nUSER-AGENT: ua\r\nCache-Control: no-cache\r\n\r\n"
+	if len(wrote) != 2 || wrote[1] != want {
+		t.Errorf("redirected request:\n%q\nwant:\n%q", wrote, want)
+	}
+}
+
+// writingTransport is a RoundTripper implemented by a function.
+type writingTransport func(*Request) (*Response, error)
+
+func (f writingTransport) RoundTrip(req *Request) (*Response, error) { return f(req) }
+
+func TestHeaderWriteSubsetSharedExclude(t *testing.T) {
+	h := Header{
+		"A":             {"1"},
+		"B":             {"2"},
+		"C":             {"3"},
+		HeaderOrderKey:  {"c", "a", "b"},
+		PHeaderOrderKey: {":method"},
+	}
+	exclude := map[string]bool{"B": true}
+	const want = "C: 3\r\nA: 1\r\n"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			for j := 0; j < 100; j++ {
+				buf.Reset()
+				if err := h.WriteSubset(&buf, exclude); err != nil {
+					t.Error(err)
+					return
+				}
+				if got := buf.String(); got != want {
+					t.Errorf("WriteSubset = %q; want %q", got, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(exclude) != 1 {
+		t.Errorf("exclude map was modified: %v", exclude)
+	}
+}
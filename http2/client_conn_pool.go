@@ -7,7 +7,8 @@
 package http2
 
 import (
-	"crypto/tls"
+	"context"
+	"errors"
 	"sync"
 
 	http "github.com/useflyent/fhttp"
@@ -79,49 +80,56 @@ func (p *clientConnPool) getClientConn(req *http.Request, addr string, dialOnMis
 		// It gets its own connection.
 		traceGetConn(req, addr)
 		const singleUse = true
-		cc, err := p.t.dialClientConn(addr, singleUse)
+		cc, err := p.t.dialRequestConn(req, addr, singleUse)
 		if err != nil {
 			return nil, err
 		}
 		return cc, nil
 	}
-	p.mu.Lock()
-	for _, cc := range p.conns[addr] {
-		if st := cc.idleState(); st.canTakeNewRequest {
-			if p.shouldTraceGetConn(st) {
-				traceGetConn(req, addr)
+	for {
+		p.mu.Lock()
+		for _, cc := range p.conns[addr] {
+			if st := cc.idleState(); st.canTakeNewRequest {
+				if p.shouldTraceGetConn(st) {
+					traceGetConn(req, addr)
+				}
+				p.mu.Unlock()
+				return cc, nil
 			}
+		}
+		if !dialOnMiss {
 			p.mu.Unlock()
-			return cc, nil
+			return nil, ErrNoCachedConn
 		}
-	}
-	if !dialOnMiss {
+		traceGetConn(req, addr)
+		call := p.getStartDialLocked(req, addr)
 		p.mu.Unlock()
-		return nil, ErrNoCachedConn
+		<-call.done
+		if shouldRetryDial(call, req) {
+			continue
+		}
+		return call.res, call.err
 	}
-	traceGetConn(req, addr)
-	call := p.getStartDialLocked(addr)
-	p.mu.Unlock()
-	<-call.done
-	return call.res, call.err
 }
 
 // dialCall is an in-flight Transport dial call to a host.
 type dialCall struct {
 	_    incomparable
 	p    *clientConnPool
-	done chan struct{} // closed when done
-	res  *ClientConn   // valid after done is closed
-	err  error         // valid after done is closed
+	req  *http.Request   // the request that started the dial
+	ctx  context.Context // context of req
+	done chan struct{}   // closed when done
+	res  *ClientConn     // valid after done is closed
+	err  error           // valid after done is closed
 }
 
 // requires p.mu is held.
-func (p *clientConnPool) getStartDialLocked(addr string) *dialCall {
+func (p *clientConnPool) getStartDialLocked(req *http.Request, addr string) *dialCall {
 	if call, ok := p.dialing[addr]; ok {
 		// A dial is already in-flight. Don't start another.
 		return call
 	}
-	call := &dialCall{p: p, done: make(chan struct{})}
+	call := &dialCall{p: p, req: req, ctx: req.Context(), done: make(chan struct{})}
 	if p.dialing == nil {
 		p.dialing = make(map[string]*dialCall)
 	}
@@ -133,7 +141,7 @@ func (p *clientConnPool) getStartDialLocked(addr string) *dialCall {
 // run in its own goroutine.
 func (c *dialCall) dial(addr string) {
 	const singleUse = false // shared conn
-	c.res, c.err = c.p.t.dialClientConn(addr, singleUse)
+	c.res, c.err = c.p.t.dialRequestConn(c.req, addr, singleUse)
 	close(c.done)
 
 	c.p.mu.Lock()
@@ -144,6 +152,19 @@ func (c *dialCall) dial(addr string) {
 	c.p.mu.Unlock()
 }
 
+// shouldRetryDial reports whether req, which waited on call, should
+// start a dial of its own because call failed only as the request
+// that started it was canceled.
+func shouldRetryDial(call *dialCall, req *http.Request) bool {
+	if call.err == nil || call.ctx == req.Context() {
+		return false
+	}
+	if !errors.Is(call.err, context.Canceled) && !errors.Is(call.err, context.DeadlineExceeded) {
+		return false
+	}
+	return call.ctx.Err() != nil
+}
+
 // addConnIfNeeded makes a NewClientConn out of c if a connection for key doesn't
 // already exist. It coalesces concurrent calls with the same key.
 // This is used by the http1 Transport code when it creates a new connection. Because
@@ -152,7 +173,7 @@ func (c *dialCall) dial(addr string) {
 // This code decides which ones live or die.
 // The return value used is whether c was used.
 // c is never closed.
-func (p *clientConnPool) addConnIfNeeded(key string, t *Transport, c *tls.Conn) (used bool, err error) {
+func (p *clientConnPool) addConnIfNeeded(key string, t *Transport, c http.TLSConn) (used bool, err error) {
 	p.mu.Lock()
 	for _, cc := range p.conns[key] {
 		if cc.CanTakeNewRequest() {
@@ -188,7 +209,7 @@ type addConnCall struct {
 	err  error
 }
 
-func (c *addConnCall) run(t *Transport, key string, tc *tls.Conn) {
+func (c *addConnCall) run(t *Transport, key string, tc http.TLSConn) {
 	cc, err := t.NewClientConn(tc)
 
 	p := c.p
@@ -37,6 +37,8 @@ const (
 	FrameGoAway       FrameType = 0x7
 	FrameWindowUpdate FrameType = 0x8
 	FrameContinuation FrameType = 0x9
+
+	FramePriorityUpdate FrameType = 0x10 // RFC 9218
 )
 
 var frameName = map[FrameType]string{
@@ -50,6 +52,8 @@ var frameName = map[FrameType]string{
 	FrameGoAway:       "GOAWAY",
 	FrameWindowUpdate: "WINDOW_UPDATE",
 	FrameContinuation: "CONTINUATION",
+
+	FramePriorityUpdate: "PRIORITY_UPDATE",
 }
 
 func (t FrameType) String() string {
@@ -136,6 +140,8 @@ var frameParsers = map[FrameType]frameParser{
 	FrameGoAway:       parseGoAwayFrame,
 	FrameWindowUpdate: parseWindowUpdateFrame,
 	FrameContinuation: parseContinuationFrame,
+
+	FramePriorityUpdate: parsePriorityUpdateFrame,
 }
 
 func typeFrameParser(t FrameType) frameParser {
@@ -1056,6 +1062,10 @@ type HeadersFrameParam struct {
 	// Priority, if non-zero, includes stream priority information
 	// in the HEADER frame.
 	Priority PriorityParam
+
+	// HasPriority, if true, includes Priority in the HEADERS frame
+	// even when it is the zero value.
+	HasPriority bool
 }
 
 // WriteHeaders writes a single HEADERS frame.
@@ -1080,14 +1090,15 @@ func (f *Framer) WriteHeaders(p HeadersFrameParam) error {
 	if p.EndHeaders {
 		flags |= FlagHeadersEndHeaders
 	}
-	if !p.Priority.IsZero() {
+	hasPriority := p.HasPriority || !p.Priority.IsZero()
+	if hasPriority {
 		flags |= FlagHeadersPriority
 	}
 	f.startWrite(FrameHeaders, flags, p.StreamID)
 	if p.PadLength != 0 {
 		f.writeByte(p.PadLength)
 	}
-	if !p.Priority.IsZero() {
+	if hasPriority {
 		v := p.Priority.StreamDep
 		if !validStreamIDOrZero(v) && !f.AllowIllegalWrites {
 			return errDepStreamID
@@ -1171,6 +1182,53 @@ func (f *Framer) WritePriority(streamID uint32, p PriorityParam) error {
 	return f.endWrite()
 }
 
+// A PriorityUpdateFrame carries the RFC 9218 extensible priority of a
+// request stream. It is sent by clients on stream 0.
+// See https://www.rfc-editor.org/rfc/rfc9218.html#section-7.1
+type PriorityUpdateFrame struct {
+	FrameHeader
+
+	// PrioritizedStreamID is the stream whose priority is updated.
+	PrioritizedStreamID uint32
+
+	// PriorityFieldValue is the priority, in the format of the
+	// "priority" header field, such as "u=0, i".
+	PriorityFieldValue string
+}
+
+func parsePriorityUpdateFrame(_ *frameCache, fh FrameHeader, payload []byte) (Frame, error) {
+	if fh.StreamID != 0 {
+		return nil, connError{ErrCodeProtocol, "PRIORITY_UPDATE frame with non-zero stream ID"}
+	}
+	if len(payload) < 4 {
+		return nil, connError{ErrCodeFrameSize, fmt.Sprintf("PRIORITY_UPDATE frame payload size was %d; want at least 4", len(payload))}
+	}
+	id := binary.BigEndian.Uint32(payload[:4]) & 0x7fffffff
+	if id == 0 {
+		return nil, connError{ErrCodeProtocol, "PRIORITY_UPDATE frame for stream 0"}
+	}
+	return &PriorityUpdateFrame{
+		FrameHeader:         fh,
+		PrioritizedStreamID: id,
+		PriorityFieldValue:  string(payload[4:]),
+	}, nil
+}
+
+// WritePriorityUpdate writes a PRIORITY_UPDATE frame carrying the
+// priority field value for the given stream.
+//
+// It will perform exactly one Write to the underlying Writer.
+// It is the caller's responsibility to not call other Write methods concurrently.
+func (f *Framer) WritePriorityUpdate(streamID uint32, priority string) error {
+	if !validStreamID(streamID) && !f.AllowIllegalWrites {
+		return errStreamID
+	}
+	f.startWrite(FramePriorityUpdate, 0, 0)
+	f.writeUint32(streamID)
+	f.writeBytes([]byte(priority))
+	return f.endWrite()
+}
+
 // A RSTStreamFrame allows for abnormal termination of a stream.
 // See http://http2.github.io/http2-spec/#rfc.section.6.4
 type RSTStreamFrame struct {
@@ -1379,3 +1379,47 @@ func TestSettingsDuplicates(t *testing.T) {
 	}
 
 }
+
+func TestWritePriorityUpdate(t *testing.T) {
+	fr, buf := testFramer()
+	fr.WritePriorityUpdate(3, "u=0, i")
+	const wantEnc = "\x00\x00\x0a\x10\x00\x00\x00\x00\x00\x00\x00\x00\x03u=0, i"
+	if buf.String() != wantEnc {
+		t.Errorf("encoded as %q; want %q", buf.Bytes(), wantEnc)
+	}
+	f, err := fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &PriorityUpdateFrame{
+		FrameHeader: FrameHeader{
+			valid:  true,
+			Type:   FramePriorityUpdate,
+			Length: 10,
+		},
+		PrioritizedStreamID: 3,
+		PriorityFieldValue:  "u=0, i",
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("parsed back %#v; want %#v", f, want)
+	}
+}
+
+func TestReadPriorityUpdateFrameErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr error
+	}{
+		{"nonzero stream", "\x00\x00\x04\x10\x00\x00\x00\x00\x01\x00\x00\x00\x03", ConnectionError(ErrCodeProtocol)},
+		{"short payload", "\x00\x00\x02\x10\x00\x00\x00\x00\x00\x00\x03", ConnectionError(ErrCodeFrameSize)},
+		{"zero prioritized stream", "\x00\x00\x04\x10\x00\x00\x00\x00\x00\x00\x00\x00\x00", ConnectionError(ErrCodeProtocol)},
+	}
+	for _, tt := range tests {
+		fr, buf := testFramer()
+		buf.WriteString(tt.raw)
+		if _, err := fr.ReadFrame(); err != tt.wantErr {
+			t.Errorf("%s: ReadFrame error = %v; want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -28,6 +28,53 @@ type Encoder struct {
 	tableSizeUpdate bool
 	w               io.Writer
 	buf             []byte
+	// policy, if non-nil, chooses the encoding of each field
+	// written with WriteField.
+	policy func(HeaderField) FieldEncoding
+}
+
+// Indexing selects the representation of a header field that is not
+// encoded as a full match in the static or dynamic table.
+type Indexing uint8
+
+const (
+	// IndexingDefault adds a field to the dynamic table unless it
+	// is sensitive or larger than the table.
+	IndexingDefault Indexing = iota
+
+	// IndexingIncremental always uses "Literal Header Field with
+	// Incremental Indexing".
+	IndexingIncremental
+
+	// IndexingNone uses "Literal Header Field without Indexing",
+	// even if the field is already in a table.
+	IndexingNone
+
+	// IndexingNever uses "Literal Header Field Never Indexed",
+	// even if the field is already in a table.
+	IndexingNever
+)
+
+// Huffman selects how string literals are encoded.
+type Huffman uint8
+
+const (
+	// HuffmanDefault uses Huffman coding only when it produces a
+	// strictly shorter string.
+	HuffmanDefault Huffman = iota
+
+	// HuffmanAlways always uses Huffman coding.
+	HuffmanAlways
+
+	// HuffmanNever always writes raw octets.
+	HuffmanNever
+)
+
+// FieldEncoding controls how a single header field is encoded. The
+// zero value is the encoder's default behavior.
+type FieldEncoding struct {
+	Indexing Indexing
+	Huffman  Huffman
 }
 
 // NewEncoder returns a new Encoder which performs HPACK encoding. An
@@ -44,10 +91,28 @@ func NewEncoder(w io.Writer) *Encoder {
 	return e
 }
 
+// SetEncodingPolicy sets the function that chooses the encoding of
+// each field written with WriteField. A nil policy restores the
+// default encoding.
+func (e *Encoder) SetEncodingPolicy(policy func(f HeaderField) FieldEncoding) {
+	e.policy = policy
+}
+
 // WriteField encodes f into a single Write to e's underlying Writer.
 // This function may also produce bytes for "Header Table Size Update"
 // if necessary. If produced, it is done before encoding f.
 func (e *Encoder) WriteField(f HeaderField) error {
+	var enc FieldEncoding
+	if e.policy != nil {
+		enc = e.policy(f)
+	}
+	return e.WriteFieldEncoding(f, enc)
+}
+
+// WriteFieldEncoding is like WriteField, but encodes f as enc says
+// instead of consulting the encoding policy. A field with Sensitive
+// set is always encoded as never indexed.
+func (e *Encoder) WriteFieldEncoding(f HeaderField, enc FieldEncoding) error {
 	e.buf = e.buf[:0]
 
 	if e.tableSizeUpdate {
@@ -59,19 +124,28 @@ func (e *Encoder) WriteField(f HeaderField) error {
 		e.buf = appendTableSize(e.buf, e.dynTab.maxSize)
 	}
 
+	if enc.Indexing == IndexingNever {
+		f.Sensitive = true
+	}
 	idx, nameValueMatch := e.searchTable(f)
-	if nameValueMatch {
+	if nameValueMatch && (enc.Indexing == IndexingDefault || enc.Indexing == IndexingIncremental) {
 		e.buf = appendIndexed(e.buf, idx)
 	} else {
-		indexing := e.shouldIndex(f)
+		var indexing bool
+		switch enc.Indexing {
+		case IndexingDefault:
+			indexing = e.shouldIndex(f)
+		case IndexingIncremental:
+			indexing = !f.Sensitive
+		}
 		if indexing {
 			e.dynTab.add(f)
 		}
 
 		if idx == 0 {
-			e.buf = appendNewName(e.buf, f, indexing)
+			e.buf = appendNewName(e.buf, f, indexing, enc.Huffman)
 		} else {
-			e.buf = appendIndexedName(e.buf, f, idx, indexing)
+			e.buf = appendIndexedName(e.buf, f, idx, indexing, enc.Huffman)
 		}
 	}
 	n, err := e.w.Write(e.buf)
@@ -104,11 +178,16 @@ func (e *Encoder) searchTable(f HeaderField) (i uint64, nameValueMatch bool) {
 
 // SetMaxDynamicTableSize changes the dynamic header table size to v.
 // The actual size is bounded by the value passed to
-// SetMaxDynamicTableSizeLimit.
+// SetMaxDynamicTableSizeLimit. If the size changes, a "Header Table
+// Size Update" is written before the next field.
 func (e *Encoder) SetMaxDynamicTableSize(v uint32) {
 	if v > e.maxSizeLimit {
 		v = e.maxSizeLimit
 	}
+	if v == e.dynTab.maxSize && !e.tableSizeUpdate {
+		// Nothing to signal.
+		return
+	}
 	if v < e.minSize {
 		e.minSize = v
 	}
@@ -131,6 +210,38 @@ func (e *Encoder) SetMaxDynamicTableSizeLimit(v uint32) {
 	}
 }
 
+// TableState describes the dynamic table of an Encoder.
+type TableState struct {
+	// Size is the sum of the sizes of the entries, as defined in
+	// RFC 7541, Section 4.1.
+	Size uint32
+
+	// MaxSize is the maximum size of the table.
+	MaxSize uint32
+
+	// MaxSizeLimit is the upper bound for MaxSize, as set by
+	// SetMaxDynamicTableSizeLimit.
+	MaxSizeLimit uint32
+
+	// Entries is the number of entries in the table.
+	Entries int
+
+	// PendingUpdate is whether a "Header Table Size Update" will be
+	// written before the next field.
+	PendingUpdate bool
+}
+
+// TableState returns the current state of e's dynamic table.
+func (e *Encoder) TableState() TableState {
+	return TableState{
+		Size:          e.dynTab.size,
+		MaxSize:       e.dynTab.maxSize,
+		MaxSizeLimit:  e.maxSizeLimit,
+		Entries:       e.dynTab.table.len(),
+		PendingUpdate: e.tableSizeUpdate,
+	}
+}
+
 // shouldIndex reports whether f should be indexed.
 func (e *Encoder) shouldIndex(f HeaderField) bool {
 	return !f.Sensitive && f.Size() <= e.dynTab.maxSize
@@ -152,10 +263,10 @@ func appendIndexed(dst []byte, i uint64) []byte {
 // If f.Sensitive is true, "Never Indexed" representation is used. If
 // f.Sensitive is false and indexing is true, "Incremental Indexing"
 // representation is used.
-func appendNewName(dst []byte, f HeaderField, indexing bool) []byte {
+func appendNewName(dst []byte, f HeaderField, indexing bool, huffman Huffman) []byte {
 	dst = append(dst, encodeTypeByte(indexing, f.Sensitive))
-	dst = appendHpackString(dst, f.Name)
-	return appendHpackString(dst, f.Value)
+	dst = appendHpackStringHuffman(dst, f.Name, huffman)
+	return appendHpackStringHuffman(dst, f.Value, huffman)
 }
 
 // appendIndexedName appends f and index i referring indexed name
@@ -165,7 +276,7 @@ func appendNewName(dst []byte, f HeaderField, indexing bool) []byte {
 // If f.Sensitive is true, "Never Indexed" representation is used. If
 // f.Sensitive is false and indexing is true, "Incremental Indexing"
 // representation is used.
-func appendIndexedName(dst []byte, f HeaderField, i uint64, indexing bool) []byte {
+func appendIndexedName(dst []byte, f HeaderField, i uint64, indexing bool, huffman Huffman) []byte {
 	first := len(dst)
 	var n byte
 	if indexing {
@@ -175,7 +286,7 @@ func appendIndexedName(dst []byte, f HeaderField, i uint64, indexing bool) []byt
 	}
 	dst = appendVarInt(dst, n, i)
 	dst[first] |= encodeTypeByte(indexing, f.Sensitive)
-	return appendHpackString(dst, f.Value)
+	return appendHpackStringHuffman(dst, f.Value, huffman)
 }
 
 // appendTableSize appends v, as encoded in "Header Table Size Update"
@@ -211,8 +322,14 @@ func appendVarInt(dst []byte, n byte, i uint64) []byte {
 // s will be encoded in Huffman codes only when it produces strictly
 // shorter byte string.
 func appendHpackString(dst []byte, s string) []byte {
+	return appendHpackStringHuffman(dst, s, HuffmanDefault)
+}
+
+// appendHpackStringHuffman is like appendHpackString, but uses Huffman
+// codes as huffman says.
+func appendHpackStringHuffman(dst []byte, s string, huffman Huffman) []byte {
 	huffmanLength := HuffmanEncodeLength(s)
-	if huffmanLength < uint64(len(s)) {
+	if huffman == HuffmanAlways || (huffman == HuffmanDefault && huffmanLength < uint64(len(s))) {
 		first := len(dst)
 		dst = appendVarInt(dst, 7, huffmanLength)
 		dst = AppendHuffmanString(dst, s)
@@ -217,7 +217,7 @@ func TestAppendNewName(t *testing.T) {
 	}
 	for _, tt := range tests {
 		want := removeSpace(tt.wantHex)
-		buf := appendNewName(nil, tt.f, tt.indexing)
+		buf := appendNewName(nil, tt.f, tt.indexing, HuffmanDefault)
 		if got := hex.EncodeToString(buf); want != got {
 			t.Errorf("appendNewName(nil, %+v, %v) = %q; want %q", tt.f, tt.indexing, got, want)
 		}
@@ -243,7 +243,7 @@ func TestAppendIndexedName(t *testing.T) {
 	}
 	for _, tt := range tests {
 		want := removeSpace(tt.wantHex)
-		buf := appendIndexedName(nil, tt.f, tt.i, tt.indexing)
+		buf := appendIndexedName(nil, tt.f, tt.i, tt.indexing, HuffmanDefault)
 		if got := hex.EncodeToString(buf); want != got {
 			t.Errorf("appendIndexedName(nil, %+v, %v) = %q; want %q", tt.f, tt.indexing, got, want)
 		}
@@ -330,6 +330,29 @@ func TestEncoderSetMaxDynamicTableSizeLimit(t *testing.T) {
 	}
 }
 
+func TestEncoderSetMaxDynamicTableSizeUnchanged(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	// The default size needs no update.
+	e.SetMaxDynamicTableSize(initialHeaderTableSize)
+	if got := e.TableState(); got.PendingUpdate {
+		t.Errorf("PendingUpdate after setting the current size; state %+v", got)
+	}
+	e.SetMaxDynamicTableSize(100)
+	e.SetMaxDynamicTableSize(100)
+	if err := e.WriteField(pair("custom-key", "custom-value")); err != nil {
+		t.Fatal(err)
+	}
+	// One update to 100, then the field.
+	if got, want := hex.EncodeToString(buf.Bytes()[:2]), "3f45"; got != want {
+		t.Errorf("encoded prefix %s; want %s", got, want)
+	}
+	want := TableState{Size: 54, MaxSize: 100, MaxSizeLimit: initialHeaderTableSize, Entries: 1}
+	if got := e.TableState(); got != want {
+		t.Errorf("TableState = %+v; want %+v", got, want)
+	}
+}
+
 func removeSpace(s string) string {
 	return strings.Replace(s, " ", "", -1)
 }
@@ -384,3 +407,59 @@ func BenchmarkEncoderSearchTable(b *testing.B) {
 		}
 	}
 }
+
+func TestEncoderFieldEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		f        HeaderField
+		enc      FieldEncoding
+		wantHex  string // prefix of the encoding
+		wantDyn  int    // dynamic table entries afterwards
+		sameAsWF bool   // also check WriteField through SetEncodingPolicy
+	}{
+		{"default", pair("custom-key", "custom-value"), FieldEncoding{}, "4088", 1, false},
+		{"incremental", pair("custom-key", "custom-value"), FieldEncoding{Indexing: IndexingIncremental}, "4088", 1, true},
+		{"without indexing", pair("custom-key", "custom-value"), FieldEncoding{Indexing: IndexingNone}, "0088", 0, true},
+		{"never indexed", pair("custom-key", "custom-value"), FieldEncoding{Indexing: IndexingNever}, "1088", 0, true},
+		{"sensitive stays never indexed", HeaderField{Name: "custom-key", Value: "v", Sensitive: true}, FieldEncoding{Indexing: IndexingIncremental}, "1088", 0, false},
+		{"raw strings", pair("custom-key", "custom-value"), FieldEncoding{Huffman: HuffmanNever}, "400a637573746f6d2d6b6579", 1, true},
+		{"forced huffman", pair("a", "b"), FieldEncoding{Indexing: IndexingNone, Huffman: HuffmanAlways}, "0081", 0, true},
+		{"static match without indexing", pair(":method", "GET"), FieldEncoding{Indexing: IndexingNone}, "02", 0, true},
+		{"static match never indexed", pair(":method", "GET"), FieldEncoding{Indexing: IndexingNever}, "13", 0, true},
+		{"static match default", pair(":method", "GET"), FieldEncoding{}, "82", 0, false},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		if err := e.WriteFieldEncoding(tt.f, tt.enc); err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(buf.Bytes()); !strings.HasPrefix(got, tt.wantHex) {
+			t.Errorf("%s: encoded as %s; want prefix %s", tt.name, got, tt.wantHex)
+		}
+		if got := e.dynTab.table.len(); got != tt.wantDyn {
+			t.Errorf("%s: dynamic table has %d entries; want %d", tt.name, got, tt.wantDyn)
+		}
+		want := buf.String()
+
+		var fields []HeaderField
+		d := NewDecoder(4<<10, func(f HeaderField) { fields = append(fields, f) })
+		if _, err := d.Write(buf.Bytes()); err != nil {
+			t.Errorf("%s: Decoder Write = %v", tt.name, err)
+		} else if len(fields) != 1 || fields[0].Name != tt.f.Name || fields[0].Value != tt.f.Value {
+			t.Errorf("%s: decoded %+v; want %+v", tt.name, fields, tt.f)
+		}
+
+		if tt.sameAsWF {
+			buf.Reset()
+			e := NewEncoder(&buf)
+			e.SetEncodingPolicy(func(HeaderField) FieldEncoding { return tt.enc })
+			if err := e.WriteField(tt.f); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != want {
+				t.Errorf("%s: WriteField with policy encoded as %x; want %x", tt.name, got, want)
+			}
+		}
+	}
+}
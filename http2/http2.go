@@ -140,6 +140,10 @@ func (s Setting) Valid() error {
 		if s.Val < 16384 || s.Val > 1<<24-1 {
 			return ConnectionError(ErrCodeProtocol)
 		}
+	case SettingNoRFC7540Priorities:
+		if s.Val != 1 && s.Val != 0 {
+			return ConnectionError(ErrCodeProtocol)
+		}
 	}
 	return nil
 }
@@ -155,6 +159,7 @@ const (
 	SettingInitialWindowSize    SettingID = 0x4
 	SettingMaxFrameSize         SettingID = 0x5
 	SettingMaxHeaderListSize    SettingID = 0x6
+	SettingNoRFC7540Priorities  SettingID = 0x9 // RFC 9218
 )
 
 var settingName = map[SettingID]string{
@@ -164,6 +169,7 @@ var settingName = map[SettingID]string{
 	SettingInitialWindowSize:    "INITIAL_WINDOW_SIZE",
 	SettingMaxFrameSize:         "MAX_FRAME_SIZE",
 	SettingMaxHeaderListSize:    "MAX_HEADER_LIST_SIZE",
+	SettingNoRFC7540Priorities:  "NO_RFC7540_PRIORITIES",
 }
 
 func (s SettingID) String() string {
@@ -4,6 +4,7 @@
 package http2
 
 import (
+	"context"
 	"errors"
 	"net/url"
 	"reflect"
@@ -195,7 +196,7 @@ func TestHandlePushNoActionCancel(t *testing.T) {
 			defer st.Close()
 			tr := &Transport{TLSClientConfig: tlsConfigInsecure}
 			defer tr.CloseIdleConnections()
-			cc, err := tr.dialClientConn(st.ts.Listener.Addr().String(), false)
+			cc, err := tr.dialClientConn(context.Background(), st.ts.Listener.Addr().String(), nil, false)
 			if err != nil {
 				t.Fatal(err)
 			}
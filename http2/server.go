@@ -540,6 +540,17 @@ type serverConn struct {
 	shutdownTimer               *time.Timer // nil until used
 	idleTimer                   *time.Timer // nil if unused
 
+	// pendingPriorityUpdates are PRIORITY_UPDATE frames received for
+	// idle streams, applied when the stream opens. Owned by serve.
+	pendingPriorityUpdates map[uint32]http.ExtensiblePriority
+
+	// fingerprint is what the client revealed about itself before
+	// its first request: its initial SETTINGS, connection
+	// WINDOW_UPDATE and PRIORITY frames. Owned by serve.
+	fingerprint       http.HTTP2Fingerprint
+	sawClientSettings bool
+	sawClientHeaders  bool // a HEADERS frame was received; stop recording
+
 	// Owned by the writeFrameAsync goroutine:
 	headerWriteBuf bytes.Buffer
 	hpackEncoder   *hpack.Encoder
@@ -817,14 +828,17 @@ func (sc *serverConn) serve() {
 		sc.vlogf("http2: server connection from %v on %p", sc.conn.RemoteAddr(), sc.hs)
 	}
 
-	sc.writeFrame(FrameWriteRequest{
-		write: writeSettings{
-			{SettingMaxFrameSize, sc.srv.maxReadFrameSize()},
-			{SettingMaxConcurrentStreams, sc.advMaxStreams},
-			{SettingMaxHeaderListSize, sc.maxHeaderListSize()},
-			{SettingInitialWindowSize, uint32(sc.srv.initialStreamRecvWindowSize())},
-		},
-	})
+	settings := writeSettings{
+		{SettingMaxFrameSize, sc.srv.maxReadFrameSize()},
+		{SettingMaxConcurrentStreams, sc.advMaxStreams},
+		{SettingMaxHeaderListSize, sc.maxHeaderListSize()},
+		{SettingInitialWindowSize, uint32(sc.srv.initialStreamRecvWindowSize())},
+	}
+	if _, ok := sc.writeSched.(ExtensiblePriorityWriteScheduler); ok {
+		// Tell the client that RFC 9218 priorities are used instead.
+		settings = append(settings, Setting{SettingNoRFC7540Priorities, 1})
+	}
+	sc.writeFrame(FrameWriteRequest{write: settings})
 	sc.unackedSettings++
 
 	// Each connection starts with intialWindowSize inflow tokens.
@@ -1419,6 +1433,8 @@ func (sc *serverConn) processFrame(f Frame) error {
 		return sc.processResetStream(f)
 	case *PriorityFrame:
 		return sc.processPriority(f)
+	case *PriorityUpdateFrame:
+		return sc.processPriorityUpdate(f)
 	case *GoAwayFrame:
 		return sc.processGoAway(f)
 	case *MetaPushPromiseFrame:
@@ -1480,6 +1496,9 @@ func (sc *serverConn) processWindowUpdate(f *WindowUpdateFrame) error {
 		if !sc.flow.add(int32(f.Increment)) {
 			return goAwayFlowError{}
 		}
+		if !sc.sawClientHeaders && sc.fingerprint.WindowUpdate == 0 {
+			sc.fingerprint.WindowUpdate = f.Increment
+		}
 	}
 	sc.scheduleFrameWrite()
 	return nil
@@ -1560,6 +1579,13 @@ func (sc *serverConn) processSettings(f *SettingsFrame) error {
 	if err := f.ForeachSetting(sc.processSetting); err != nil {
 		return err
 	}
+	if !sc.sawClientSettings {
+		sc.sawClientSettings = true
+		f.ForeachSetting(func(s Setting) error {
+			sc.fingerprint.Settings = append(sc.fingerprint.Settings, http.ProfileSetting{ID: uint16(s.ID), Val: s.Val})
+			return nil
+		})
+	}
 	// TODO: judging by RFC 7540, Section 6.5.3 each SETTINGS frame should be
 	// acknowledged individually, even if multiple are received before the ACK.
 	sc.needToSendSettingsAck = true
@@ -1849,6 +1875,24 @@ func (sc *serverConn) processHeaders(f *MetaHeadersFrame) error {
 		}
 		sc.writeSched.AdjustStream(st.id, f.Priority)
 	}
+	if ws, ok := sc.writeSched.(ExtensiblePriorityWriteScheduler); ok {
+		// RFC 9218, Section 7.1: a PRIORITY_UPDATE frame received
+		// before the request takes precedence over its header.
+		if p, ok := sc.pendingPriorityUpdates[id]; ok {
+			delete(sc.pendingPriorityUpdates, id)
+			ws.AdjustStreamExtensible(id, p)
+		} else {
+			for _, hf := range f.RegularFields() {
+				if hf.Name == "priority" {
+					ws.AdjustStreamExtensible(id, http.ParseExtensiblePriority(hf.Value))
+					break
+				}
+			}
+		}
+	}
+
+	sc.sawClientHeaders = true
+	st.ctx = http.WithHTTP2Fingerprint(st.ctx, sc.streamFingerprint(f))
 
 	rw, req, err := sc.newWriterAndRequest(st, f)
 	if err != nil {
@@ -1914,6 +1958,28 @@ func (st *stream) processTrailerHeaders(f *MetaHeadersFrame) error {
 	return nil
 }
 
+// streamFingerprint returns the client's fingerprint as of the
+// request sent in f.
+func (sc *serverConn) streamFingerprint(f *MetaHeadersFrame) *http.HTTP2Fingerprint {
+	fp := &http.HTTP2Fingerprint{
+		Settings:            append([]http.ProfileSetting(nil), sc.fingerprint.Settings...),
+		WindowUpdate:        sc.fingerprint.WindowUpdate,
+		Priorities:          append([]http.ProfilePriority(nil), sc.fingerprint.Priorities...),
+		PrioritiesTruncated: sc.fingerprint.PrioritiesTruncated,
+	}
+	for _, hf := range f.PseudoFields() {
+		fp.PseudoHeaderOrder = append(fp.PseudoHeaderOrder, hf.Name)
+	}
+	if f.HasPriority() {
+		fp.HeaderPriority = &http.StreamPriority{
+			StreamDep: f.Priority.StreamDep,
+			Exclusive: f.Priority.Exclusive,
+			Weight:    f.Priority.Weight,
+		}
+	}
+	return fp
+}
+
 func checkPriority(streamID uint32, p PriorityParam) error {
 	if streamID == p.StreamDep {
 		// Section 5.3.1: "A stream cannot depend on itself. An endpoint MUST treat
@@ -1932,10 +1998,62 @@ func (sc *serverConn) processPriority(f *PriorityFrame) error {
 	if err := checkPriority(f.StreamID, f.PriorityParam); err != nil {
 		return err
 	}
+	if !sc.sawClientHeaders {
+		if len(sc.fingerprint.Priorities) < maxFingerprintPriorities {
+			sc.fingerprint.Priorities = append(sc.fingerprint.Priorities, http.ProfilePriority{
+				StreamID:  f.StreamID,
+				StreamDep: f.StreamDep,
+				Exclusive: f.Exclusive,
+				Weight:    f.Weight,
+			})
+		} else {
+			sc.fingerprint.PrioritiesTruncated = true
+		}
+	}
 	sc.writeSched.AdjustStream(f.StreamID, f.PriorityParam)
 	return nil
 }
 
+// maxFingerprintPriorities is the maximum number of PRIORITY frames
+// recorded in a connection's fingerprint. Browsers send a handful at
+// most; the rest are counted as truncation.
+const maxFingerprintPriorities = 16
+
+// maxPendingPriorityUpdates is the maximum number of PRIORITY_UPDATE
+// frames for idle streams remembered per connection.
+const maxPendingPriorityUpdates = 100
+
+func (sc *serverConn) processPriorityUpdate(f *PriorityUpdateFrame) error {
+	sc.serveG.check()
+	if sc.inGoAway {
+		return nil
+	}
+	ws, ok := sc.writeSched.(ExtensiblePriorityWriteScheduler)
+	if !ok {
+		return nil
+	}
+	id := f.PrioritizedStreamID
+	if id%2 != 1 {
+		// RFC 9218, Section 7.1: servers only accept updates for
+		// client-initiated request streams.
+		return ConnectionError(ErrCodeProtocol)
+	}
+	p := http.ParseExtensiblePriority(f.PriorityFieldValue)
+	if id > sc.maxClientStreamID {
+		// The stream is idle; apply the update once it opens.
+		if sc.pendingPriorityUpdates == nil {
+			sc.pendingPriorityUpdates = make(map[uint32]http.ExtensiblePriority)
+		}
+		if _, ok := sc.pendingPriorityUpdates[id]; !ok && len(sc.pendingPriorityUpdates) >= maxPendingPriorityUpdates {
+			return nil
+		}
+		sc.pendingPriorityUpdates[id] = p
+		return nil
+	}
+	ws.AdjustStreamExtensible(id, p)
+	return nil
+}
+
 func (sc *serverConn) newStream(id, pusherID uint32, state streamState) *stream {
 	sc.serveG.check()
 	if id == 0 {
@@ -2020,6 +2138,10 @@ func (sc *serverConn) newWriterAndRequest(st *stream, f *MetaHeadersFrame) (*res
 	if err != nil {
 		return nil, nil, err
 	}
+	req.RawHeaders = make([]http.RawHeader, len(f.Fields))
+	for i, hf := range f.Fields {
+		req.RawHeaders[i] = http.RawHeader{Name: hf.Name, Value: hf.Value}
+	}
 	if bodyOpen {
 		if vv, ok := rp.header["Content-Length"]; ok {
 			if cl, err := strconv.ParseUint(vv[0], 10, 63); err == nil {
@@ -4315,3 +4315,207 @@ func TestServerWindowUpdateOnBodyClose(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+type recordingExtensibleScheduler struct {
+	ExtensiblePriorityWriteScheduler
+	adjusted chan http.ExtensiblePriority
+}
+
+func (ws recordingExtensibleScheduler) AdjustStreamExtensible(streamID uint32, p http.ExtensiblePriority) {
+	ws.adjusted <- p
+	ws.ExtensiblePriorityWriteScheduler.AdjustStreamExtensible(streamID, p)
+}
+
+func TestServerExtensiblePriority(t *testing.T) {
+	adjusted := make(chan http.ExtensiblePriority, 10)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {}, func(s *Server) {
+		s.NewWriteScheduler = func() WriteScheduler {
+			return recordingExtensibleScheduler{NewExtensiblePriorityWriteScheduler(), adjusted}
+		}
+	})
+	defer st.Close()
+
+	var sawNoRFC7540 bool
+	st.greetAndCheckSettings(func(s Setting) error {
+		if s.ID == SettingNoRFC7540Priorities && s.Val == 1 {
+			sawNoRFC7540 = true
+		}
+		return nil
+	})
+	if !sawNoRFC7540 {
+		t.Errorf("server didn't send SETTINGS_NO_RFC7540_PRIORITIES=1")
+	}
+
+	// A PRIORITY_UPDATE for an idle stream takes precedence over the
+	// priority header of the request that opens it.
+	if err := st.fr.WritePriorityUpdate(1, "u=1"); err != nil {
+		t.Fatal(err)
+	}
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader("priority", "u=6, i"),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	if got, want := <-adjusted, (http.ExtensiblePriority{Urgency: 1}); got != want {
+		t.Errorf("stream 1 priority = %+v; want %+v", got, want)
+	}
+
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      3,
+		BlockFragment: st.encodeHeader("priority", "u=6, i"),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	if got, want := <-adjusted, (http.ExtensiblePriority{Urgency: 6, Incremental: true}); got != want {
+		t.Errorf("stream 3 priority = %+v; want %+v", got, want)
+	}
+}
+
+func TestServerHTTP2Fingerprint(t *testing.T) {
+	fps := make(chan string, 2)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		fp, ok := http.HTTP2FingerprintFromContext(r.Context())
+		if !ok {
+			fps <- "no fingerprint"
+			return
+		}
+		fps <- fp.String()
+	})
+	defer st.Close()
+
+	st.writePreface()
+	if err := st.fr.WriteSettings(
+		Setting{SettingHeaderTableSize, 65536},
+		Setting{SettingEnablePush, 0},
+		Setting{SettingInitialWindowSize, 6291456},
+		Setting{SettingMaxHeaderListSize, 262144},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.fr.WriteWindowUpdate(0, 15663105); err != nil {
+		t.Fatal(err)
+	}
+	st.writePriority(3, PriorityParam{StreamDep: 0, Weight: 200})
+	st.writePriority(5, PriorityParam{StreamDep: 3, Exclusive: true, Weight: 100})
+	st.wantSettings()
+	st.writeSettingsAck()
+
+	st.writeHeaders(HeadersFrameParam{
+		StreamID: 7,
+		BlockFragment: st.encodeHeaderRaw(
+			":method", "GET",
+			":authority", "example.com",
+			":scheme", "https",
+			":path", "/",
+		),
+		EndStream:  true,
+		EndHeaders: true,
+	})
+	// PRIORITY frames after the first request aren't part of the
+	// fingerprint, but each request has its own pseudo-header order.
+	st.writePriority(11, PriorityParam{StreamDep: 0, Weight: 10})
+	st.writeHeaders(HeadersFrameParam{
+		StreamID: 9,
+		BlockFragment: st.encodeHeaderRaw(
+			":method", "GET",
+			":path", "/",
+			":authority", "example.com",
+			":scheme", "https",
+		),
+		EndStream:  true,
+		EndHeaders: true,
+	})
+
+	for _, want := range []string{
+		"1:65536;2:0;4:6291456;6:262144|15663105|3:0:0:201,5:1:3:101|m,a,s,p",
+		"1:65536;2:0;4:6291456;6:262144|15663105|3:0:0:201,5:1:3:101|m,p,a,s",
+	} {
+		select {
+		case got := <-fps:
+			if got != want {
+				t.Errorf("fingerprint = %q; want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for handler")
+		}
+	}
+}
+
+func TestServerHTTP2FingerprintPriorityFlood(t *testing.T) {
+	fps := make(chan *http.HTTP2Fingerprint, 1)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		fp, _ := http.HTTP2FingerprintFromContext(r.Context())
+		fps <- fp
+	})
+	defer st.Close()
+	st.greet()
+
+	const n = 1000
+	for i := uint32(0); i < n; i++ {
+		st.writePriority(3+2*i, PriorityParam{Weight: 15})
+	}
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      3 + 2*n,
+		BlockFragment: st.encodeHeader(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+
+	select {
+	case fp := <-fps:
+		if fp == nil {
+			t.Fatal("no fingerprint")
+		}
+		if got := len(fp.Priorities); got != maxFingerprintPriorities {
+			t.Errorf("recorded %d PRIORITY frames; want %d", got, maxFingerprintPriorities)
+		}
+		if !fp.PrioritiesTruncated {
+			t.Error("PrioritiesTruncated = false; want true")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for handler")
+	}
+}
+
+func TestServerRawHeaders(t *testing.T) {
+	got := make(chan []http.RawHeader, 1)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		got <- r.RawHeaders
+	})
+	defer st.Close()
+	st.greet()
+
+	st.writeHeaders(HeadersFrameParam{
+		StreamID: 1,
+		BlockFragment: st.encodeHeaderRaw(
+			":method", "GET",
+			":authority", "example.com",
+			":scheme", "https",
+			":path", "/",
+			"cookie", "a=1",
+			"user-agent", "foo",
+			"cookie", "b=2",
+		),
+		EndStream:  true,
+		EndHeaders: true,
+	})
+
+	want := []http.RawHeader{
+		{Name: ":method", Value: "GET"},
+		{Name: ":authority", Value: "example.com"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":path", Value: "/"},
+		{Name: "cookie", Value: "a=1"},
+		{Name: "user-agent", Value: "foo"},
+		{Name: "cookie", Value: "b=2"},
+	}
+	select {
+	case raw := <-got:
+		if !reflect.DeepEqual(raw, want) {
+			t.Errorf("RawHeaders = %q; want %q", raw, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for handler")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	mathrand "math/rand"
 	"net"
 	"net/textproto"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -58,15 +59,52 @@ const (
 // A Transport internally caches connections to servers. It is safe
 // for concurrent use by multiple goroutines.
 type Transport struct {
-	// DialTLS specifies an optional dial function for creating
-	// TLS connections for requests.
+	// DialTLSContext specifies an optional dial function with context
+	// for creating TLS connections for requests. The context is that
+	// of the request that caused the dial.
 	//
-	// If DialTLS is nil, tls.Dial is used.
+	// If DialTLSContext is nil, DialTLS is used. If both are nil, a
+	// TCP connection is dialed with DialContext, through the proxy
+	// chosen by Proxy if any, and TLS is set up over it.
 	//
 	// If the returned net.Conn has a ConnectionState method like tls.Conn,
-	// it will be used to set http.Response.TLS.
+	// it will be used to set http.Response.TLS. Connections implementing
+	// http.TLSConn are accepted as well as *tls.Conn.
+	DialTLSContext func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error)
+
+	// DialTLS specifies an optional dial function for creating
+	// TLS connections for requests.
+	//
+	// Deprecated: Use DialTLSContext instead, which allows the dial
+	// to be canceled. If both are set, DialTLSContext takes priority.
 	DialTLS func(network, addr string, cfg *tls.Config) (net.Conn, error)
 
+	// DialContext specifies an optional dial function for the TCP
+	// connections that TLS is set up over, to servers or to proxies.
+	// It is not used if DialTLSContext or DialTLS is set.
+	//
+	// If DialContext is nil, a net.Dialer is used.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Proxy optionally specifies a function to return a proxy for a
+	// request, as for http.Transport. The "http", "https" and
+	// SOCKS schemes are supported, as by http.ProxyDialer; a nil
+	// URL or error means no proxy is used. The proxy's TLS
+	// configuration is taken from TLSClientConfig, without its
+	// ServerName.
+	//
+	// Connections are pooled by target address, so the proxy chosen
+	// for the request that dials a connection is used by all the
+	// requests sharing it.
+	//
+	// Proxy is not used if DialTLSContext or DialTLS is set. Such
+	// functions can use http.ProxyDialer themselves.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// ProxyConnectHeader optionally specifies headers to send to
+	// proxies with CONNECT requests.
+	ProxyConnectHeader http.Header
+
 	// TLSClientConfig specifies the TLS configuration to use with
 	// tls.Client. If nil, the default configuration is used.
 	TLSClientConfig *tls.Config
@@ -98,6 +136,12 @@ type Transport struct {
 	// to mean no limit.
 	MaxHeaderListSize uint32
 
+	// MaxEncoderHeaderTableSize is the upper limit of the HPACK
+	// dynamic table used to encode request headers. The table size
+	// follows the server's SETTINGS_HEADER_TABLE_SIZE, capped at this
+	// value. If zero, the default of 4096 from RFC 7541 is used.
+	MaxEncoderHeaderTableSize uint32
+
 	// StrictMaxConcurrentStreams controls whether the server's
 	// SETTINGS_MAX_CONCURRENT_STREAMS should be respected
 	// globally. If false, new TCP connections are created to the
@@ -143,10 +187,116 @@ type Transport struct {
 	connPoolOnce  sync.Once
 	connPoolOrDef ClientConnPool // non-nil version of ConnPool
 
-	// Settings should not include InitialWindowSize or HeaderTableSize, set that in Transport
-	Settings          []Setting
-	InitialWindowSize uint32 // if nil, will use global initialWindowSize
-	HeaderTableSize   uint32 // if nil, will use global initialHeaderTableSize
+	// Settings, if non-nil, are the parameters of the initial
+	// SETTINGS frame. They are written exactly in this order and
+	// nothing else is added; in particular SETTINGS_ENABLE_PUSH is
+	// only sent if it is listed. The connection's flow control and
+	// HPACK decoder state are derived from the values listed here,
+	// using the spec defaults for the settings that are left out.
+	//
+	// If nil, the Transport sends SETTINGS_ENABLE_PUSH,
+	// SETTINGS_INITIAL_WINDOW_SIZE, SETTINGS_HEADER_TABLE_SIZE and
+	// SETTINGS_MAX_HEADER_LIST_SIZE, in that order.
+	Settings []Setting
+
+	// InitialWindowSize and HeaderTableSize are the values of
+	// SETTINGS_INITIAL_WINDOW_SIZE and SETTINGS_HEADER_TABLE_SIZE
+	// sent when Settings is nil. Zero means the Transport's default.
+	// They are ignored if Settings is non-nil.
+	InitialWindowSize uint32
+	HeaderTableSize   uint32
+
+	// HeaderEncodings, if non-nil, sets the HPACK encoding of request
+	// header fields by lowercase name: whether they are added to the
+	// dynamic table and whether their strings are Huffman coded.
+	// Fields not listed use the encoder's default. Headers marked
+	// with http.WithSensitiveHeaders are always never indexed.
+	HeaderEncodings map[string]hpack.FieldEncoding
+
+	// ConnectionFlow is the increment of the connection-level
+	// WINDOW_UPDATE frame written after the initial SETTINGS frame.
+	// If zero, the Profile's ConnectionFlow is used, or 1<<30 if
+	// there is no profile. Values that would grow the connection
+	// window past 2^31-1 are rejected when a connection is created.
+	ConnectionFlow uint32
+
+	// PriorityFrames, if non-nil, are PRIORITY frames written after
+	// the connection-level WINDOW_UPDATE, in order. Some browsers
+	// use them to build a dependency tree out of idle streams that
+	// their requests then depend on. Requests are sent on stream
+	// IDs above the highest client stream ID used here.
+	// If nil, the Profile's PriorityFrames are used.
+	PriorityFrames []PriorityFrameParam
+
+	// Profile optionally specifies the client profile used for new
+	// connections and requests. If non-nil and Settings is nil, its
+	// settings are sent instead of the Transport's defaults. Its
+	// ConnectionFlow is used as the connection-level WINDOW_UPDATE
+	// increment, and its header orders are used for requests
+	// that don't set HeaderOrderKey or PHeaderOrderKey.
+	//
+	// If nil, the ClientProfile of the http.Transport this Transport
+	// was configured from is used, if any.
+	Profile *http.ClientProfile
+}
+
+func (t *Transport) profile() *http.ClientProfile {
+	if t.Profile != nil {
+		return t.Profile
+	}
+	if t.t1 != nil {
+		return t.t1.ClientProfile
+	}
+	return nil
+}
+
+func (t *Transport) connectionFlow() uint32 {
+	if t.ConnectionFlow != 0 {
+		return t.ConnectionFlow
+	}
+	if p := t.profile(); p != nil && p.ConnectionFlow != 0 {
+		return p.ConnectionFlow
+	}
+	return transportDefaultConnFlow
+}
+
+// maxConnFlow is the largest connection-level WINDOW_UPDATE increment
+// the preface may carry: the window starts at initialWindowSize and
+// must stay within 2^31-1 (RFC 7540, 6.9.1).
+const maxConnFlow = 1<<31 - 1 - initialWindowSize
+
+var errConnFlow = errors.New("http2: connection flow increment grows the connection window past 2^31-1")
+
+func (t *Transport) priorityFrames() []PriorityFrameParam {
+	if t.PriorityFrames != nil {
+		return t.PriorityFrames
+	}
+	p := t.profile()
+	if p == nil {
+		return nil
+	}
+	frames := make([]PriorityFrameParam, len(p.PriorityFrames))
+	for i, f := range p.PriorityFrames {
+		frames[i] = PriorityFrameParam{
+			StreamID: f.StreamID,
+			PriorityParam: PriorityParam{
+				StreamDep: f.StreamDep,
+				Exclusive: f.Exclusive,
+				Weight:    f.Weight,
+			},
+		}
+	}
+	return frames
+}
+
+// PriorityFrameParam describes a PRIORITY frame written by the
+// Transport right after the connection preface.
+type PriorityFrameParam struct {
+	// StreamID is the stream whose priority is set. It is usually
+	// an idle stream used only as a node of the dependency tree.
+	StreamID uint32
+
+	PriorityParam
 }
 
 func (t *Transport) maxHeaderListSize() uint32 {
@@ -159,6 +309,13 @@ func (t *Transport) maxHeaderListSize() uint32 {
 	return t.MaxHeaderListSize
 }
 
+func (t *Transport) maxEncoderHeaderTableSize() uint32 {
+	if t.MaxEncoderHeaderTableSize == 0 {
+		return initialHeaderTableSize
+	}
+	return t.MaxEncoderHeaderTableSize
+}
+
 func (t *Transport) disableCompression() bool {
 	return t.DisableCompression || (t.t1 != nil && t.t1.DisableCompression)
 }
@@ -207,7 +364,7 @@ func configureTransports(t1 *http.Transport) (*Transport, error) {
 	if !strSliceContains(t1.TLSClientConfig.NextProtos, "http/1.1") {
 		t1.TLSClientConfig.NextProtos = append(t1.TLSClientConfig.NextProtos, "http/1.1")
 	}
-	upgradeFn := func(authority string, c *tls.Conn) http.RoundTripper {
+	upgradeFn := func(authority string, c http.TLSConn) http.RoundTripper {
 		addr := authorityAddr("https", authority)
 		if used, err := connPool.addConnIfNeeded(addr, t2, c); err != nil {
 			go c.Close()
@@ -222,7 +379,7 @@ func configureTransports(t1 *http.Transport) (*Transport, error) {
 		return t2
 	}
 	if m := t1.TLSNextProto; len(m) == 0 {
-		t1.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{
+		t1.TLSNextProto = map[string]func(string, http.TLSConn) http.RoundTripper{
 			"h2": upgradeFn,
 		}
 	} else {
@@ -280,6 +437,8 @@ type ClientConn struct {
 	cond             *sync.Cond // hold mu; broadcast on flow/closed changes
 	flow             flow       // our conn-level flow control quota (cs.flow is per stream)
 	inflow           flow       // peer's conn-level flow control
+	connFlow         int32      // conn-level window increment we announced in the preface
+	streamFlow       int32      // stream-level window we announced in SETTINGS_INITIAL_WINDOW_SIZE
 	closing          bool
 	closed           bool
 	wantSettingsAck  bool                     // we sent a SETTINGS frame and haven't heard back
@@ -555,10 +714,9 @@ func (t *Transport) CloseIdleConnections() {
 }
 
 var (
-	errClientConnClosed               = errors.New("http2: client conn is closed")
-	errClientConnUnusable             = errors.New("http2: client conn not usable")
-	errClientConnGotGoAway            = errors.New("http2: Transport received Server's graceful shutdown GOAWAY")
-	errSettingsIncludeIllegalSettings = errors.New("http2: Settings contains either SettingInitialWindowSize or SettingHeaderTableSize, which should be specified in transport instead")
+	errClientConnClosed    = errors.New("http2: client conn is closed")
+	errClientConnUnusable  = errors.New("http2: client conn not usable")
+	errClientConnGotGoAway = errors.New("http2: Transport received Server's graceful shutdown GOAWAY")
 )
 
 // shouldRetryRequest is called by RoundTrip when a request fails to get
@@ -610,12 +768,25 @@ func canRetryError(err error) bool {
 	return false
 }
 
-func (t *Transport) dialClientConn(addr string, singleUse bool) (*ClientConn, error) {
+// dialRequestConn dials a connection to addr for req, through the
+// proxy that Proxy returns for req, if any.
+func (t *Transport) dialRequestConn(req *http.Request, addr string, singleUse bool) (*ClientConn, error) {
+	var proxyURL *url.URL
+	if t.Proxy != nil && t.DialTLSContext == nil && t.DialTLS == nil {
+		var err error
+		if proxyURL, err = t.Proxy(req); err != nil {
+			return nil, err
+		}
+	}
+	return t.dialClientConn(req.Context(), addr, proxyURL, singleUse)
+}
+
+func (t *Transport) dialClientConn(ctx context.Context, addr string, proxyURL *url.URL, singleUse bool) (*ClientConn, error) {
 	host, _, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
 	}
-	tconn, err := t.dialTLS()("tcp", addr, t.newTLSConfig(host))
+	tconn, err := t.dialTLS(ctx, "tcp", addr, proxyURL, t.newTLSConfig(host))
 	if err != nil {
 		return nil, err
 	}
@@ -636,36 +807,79 @@ func (t *Transport) newTLSConfig(host string) *tls.Config {
 	return cfg
 }
 
-func (t *Transport) dialTLS() func(string, string, *tls.Config) (net.Conn, error) {
+func (t *Transport) dialTLS(ctx context.Context, network, addr string, proxyURL *url.URL, cfg *tls.Config) (net.Conn, error) {
+	if t.DialTLSContext != nil {
+		return t.DialTLSContext(ctx, network, addr, cfg)
+	}
 	if t.DialTLS != nil {
-		return t.DialTLS
+		return t.DialTLS(network, addr, cfg)
 	}
-	return t.dialTLSDefault
+	return t.dialTLSDefault(ctx, network, addr, proxyURL, cfg)
 }
 
-func (t *Transport) dialTLSDefault(network, addr string, cfg *tls.Config) (net.Conn, error) {
-	cn, err := tls.Dial(network, addr, cfg)
+func (t *Transport) dialTLSDefault(ctx context.Context, network, addr string, proxyURL *url.URL, cfg *tls.Config) (net.Conn, error) {
+	dial := t.DialContext
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	if proxyURL != nil {
+		var proxyTLS *tls.Config
+		if t.TLSClientConfig != nil {
+			proxyTLS = t.TLSClientConfig.Clone()
+			proxyTLS.ServerName = ""
+		}
+		pd := &http.ProxyDialer{
+			ProxyURL:        proxyURL,
+			ConnectHeader:   t.ProxyConnectHeader,
+			DialProxy:       dial,
+			TLSClientConfig: proxyTLS,
+		}
+		dial = pd.DialContext
+	}
+	conn, err := dial(ctx, network, addr)
 	if err != nil {
 		return nil, err
 	}
-	if err := cn.Handshake(); err != nil {
+	cn := tls.Client(conn, cfg)
+	if err := tlsHandshake(ctx, cn); err != nil {
+		cn.Close()
 		return nil, err
 	}
 	if !cfg.InsecureSkipVerify {
 		if err := cn.VerifyHostname(cfg.ServerName); err != nil {
+			cn.Close()
 			return nil, err
 		}
 	}
 	state := cn.ConnectionState()
 	if p := state.NegotiatedProtocol; p != NextProtoTLS {
+		cn.Close()
 		return nil, fmt.Errorf("http2: unexpected ALPN protocol %q; want %q", p, NextProtoTLS)
 	}
 	if !state.NegotiatedProtocolIsMutual {
+		cn.Close()
 		return nil, errors.New("http2: could not negotiate protocol mutually")
 	}
 	return cn, nil
 }
 
+// tlsHandshake runs the handshake of cn, giving up when ctx is done.
+func tlsHandshake(ctx context.Context, cn *tls.Conn) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- cn.Handshake()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		cn.Close()
+		<-errc
+		return ctx.Err()
+	}
+}
+
 // disableKeepAlives reports whether connections should be closed as
 // soon as possible after handling the first request.
 func (t *Transport) disableKeepAlives() bool {
@@ -684,6 +898,26 @@ func (t *Transport) NewClientConn(c net.Conn) (*ClientConn, error) {
 }
 
 func (t *Transport) newClientConn(c net.Conn, addr string, singleUse bool) (*ClientConn, error) {
+	initialSettings := t.initialSettings()
+	for _, s := range initialSettings {
+		if err := s.Valid(); err != nil {
+			return nil, err
+		}
+	}
+	priorityFrames := t.priorityFrames()
+	for _, p := range priorityFrames {
+		if !validStreamID(p.StreamID) {
+			return nil, errStreamID
+		}
+		if !validStreamIDOrZero(p.StreamDep) || p.StreamDep == p.StreamID {
+			return nil, errDepStreamID
+		}
+	}
+	connFlow := t.connectionFlow()
+	if connFlow > maxConnFlow {
+		return nil, errConnFlow
+	}
+
 	cc := &ClientConn{
 		t:                     t,
 		tconn:                 c,
@@ -692,6 +926,7 @@ func (t *Transport) newClientConn(c net.Conn, addr string, singleUse bool) (*Cli
 		nextStreamID:          1,
 		maxFrameSize:          16 << 10,           // spec default
 		initialWindowSize:     65535,              // spec default
+		streamFlow:            65535,              // spec default
 		maxConcurrentStreams:  1000,               // "infinite", per spec. 1000 seems good enough.
 		peerMaxHeaderListSize: 0xffffffffffffffff, // "infinite", per spec. Use 2^64-1 instead.
 		streams:               make(map[uint32]*clientStream),
@@ -715,16 +950,18 @@ func (t *Transport) newClientConn(c net.Conn, addr string, singleUse bool) (*Cli
 	cc.bw = bufio.NewWriter(stickyErrWriter{c, &cc.werr})
 	cc.br = bufio.NewReader(c)
 	cc.fr = NewFramer(cc.bw, cc.br)
-	if t.HeaderTableSize != 0 {
-		cc.fr.ReadMetaHeaders = hpack.NewDecoder(t.HeaderTableSize, nil)
-	} else {
-		cc.fr.ReadMetaHeaders = hpack.NewDecoder(initialHeaderTableSize, nil)
-	}
 	cc.fr.MaxHeaderListSize = t.maxHeaderListSize()
 
-	// TODO: SetMaxDynamicTableSize, SetMaxDynamicTableSizeLimit on
-	// henc in response to SETTINGS frames?
+	// The encoder's table starts at the spec default of 4096 and
+	// follows the server's SETTINGS_HEADER_TABLE_SIZE, up to the
+	// Transport's limit.
 	cc.henc = hpack.NewEncoder(&cc.hbuf)
+	cc.henc.SetMaxDynamicTableSizeLimit(t.maxEncoderHeaderTableSize())
+	if encs := t.HeaderEncodings; encs != nil {
+		cc.henc.SetEncodingPolicy(func(f hpack.HeaderField) hpack.FieldEncoding {
+			return encs[f.Name]
+		})
+	}
 
 	if t.AllowHTTP {
 		cc.nextStreamID = 3
@@ -735,26 +972,75 @@ func (t *Transport) newClientConn(c net.Conn, addr string, singleUse bool) (*Cli
 		cc.tlsState = &state
 	}
 
-	initialSettings := []Setting{}
+	// Derive our flow control and HPACK decoder state from the
+	// settings we announce, falling back to the spec defaults for
+	// the ones we leave out.
+	headerTableSize := uint32(initialHeaderTableSize)
+	for _, s := range initialSettings {
+		switch s.ID {
+		case SettingHeaderTableSize:
+			headerTableSize = s.Val
+		case SettingInitialWindowSize:
+			cc.streamFlow = int32(s.Val)
+		case SettingMaxFrameSize:
+			cc.fr.SetMaxReadFrameSize(s.Val)
+		case SettingMaxHeaderListSize:
+			cc.fr.MaxHeaderListSize = s.Val
+		}
+	}
+	cc.fr.ReadMetaHeaders = hpack.NewDecoder(headerTableSize, nil)
+	cc.connFlow = int32(connFlow)
 
-	var pushEnabled uint32
-	if t.PushHandler != nil {
-		pushEnabled = 1
+	_, err := cc.bw.Write(clientPreface)
+	if err == nil {
+		err = cc.fr.WriteSettings(initialSettings...)
 	}
-	initialSettings = append(initialSettings, Setting{ID: SettingEnablePush, Val: pushEnabled})
+	if err == nil {
+		err = cc.fr.WriteWindowUpdate(0, uint32(cc.connFlow))
+	}
+	cc.inflow.add(cc.connFlow + initialWindowSize)
+	for _, p := range priorityFrames {
+		if err != nil {
+			break
+		}
+		err = cc.fr.WritePriority(p.StreamID, p.PriorityParam)
+		// Idle streams named in PRIORITY frames can't be opened
+		// later on, so new streams start above them.
+		if p.StreamID%2 == 1 && p.StreamID >= cc.nextStreamID {
+			cc.nextStreamID = p.StreamID + 2
+		}
+	}
+	if err == nil {
+		err = cc.bw.Flush()
+	}
+	if err != nil {
+		cc.Close()
+		return nil, err
+	}
+
+	go cc.readLoop()
+	return cc, nil
+}
 
-	setMaxHeader := false
+// initialSettings returns the parameters of the SETTINGS frame written
+// after the client preface, in the order they are written.
+func (t *Transport) initialSettings() []Setting {
 	if t.Settings != nil {
-		for _, setting := range t.Settings {
-			if setting.ID == SettingMaxHeaderListSize {
-				setMaxHeader = true
-			}
-			if setting.ID == SettingHeaderTableSize || setting.ID == SettingInitialWindowSize {
-				return nil, errSettingsIncludeIllegalSettings
-			}
-			initialSettings = append(initialSettings, setting)
+		return t.Settings
+	}
+	if p := t.profile(); p != nil && len(p.Settings) > 0 {
+		initialSettings := make([]Setting, len(p.Settings))
+		for i, s := range p.Settings {
+			initialSettings[i] = Setting{ID: SettingID(s.ID), Val: s.Val}
 		}
+		return initialSettings
+	}
+
+	var pushEnabled uint32
+	if t.PushHandler != nil {
+		pushEnabled = 1
 	}
+	initialSettings := []Setting{{ID: SettingEnablePush, Val: pushEnabled}}
 	if t.InitialWindowSize != 0 {
 		initialSettings = append(initialSettings, Setting{ID: SettingInitialWindowSize, Val: t.InitialWindowSize})
 	} else {
@@ -765,22 +1051,10 @@ func (t *Transport) newClientConn(c net.Conn, addr string, singleUse bool) (*Cli
 	} else {
 		initialSettings = append(initialSettings, Setting{ID: SettingHeaderTableSize, Val: initialHeaderTableSize})
 	}
-	if max := t.maxHeaderListSize(); max != 0 && !setMaxHeader {
+	if max := t.maxHeaderListSize(); max != 0 {
 		initialSettings = append(initialSettings, Setting{ID: SettingMaxHeaderListSize, Val: max})
 	}
-
-	cc.bw.Write(clientPreface)
-	cc.fr.WriteSettings(initialSettings...)
-	cc.fr.WriteWindowUpdate(0, transportDefaultConnFlow)
-	cc.inflow.add(transportDefaultConnFlow + initialWindowSize)
-	cc.bw.Flush()
-	if cc.werr != nil {
-		cc.Close()
-		return nil, cc.werr
-	}
-
-	go cc.readLoop()
-	return cc, nil
+	return initialSettings
 }
 
 func (cc *ClientConn) healthCheck() {
@@ -830,6 +1104,14 @@ func (cc *ClientConn) CanTakeNewRequest() bool {
 	return cc.canTakeNewRequestLocked()
 }
 
+// HeaderEncoderState returns the state of the HPACK dynamic table
+// used to encode request headers on cc. It is meant for debugging.
+func (cc *ClientConn) HeaderEncoderState() hpack.TableState {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.henc.TableState()
+}
+
 // clientConnIdleState describes the suitability of a client
 // connection to initiate a new RoundTrip request.
 type clientConnIdleState struct {
@@ -1158,8 +1440,21 @@ func (cc *ClientConn) roundTrip(req *http.Request) (res *http.Response, gotErrAf
 
 	cc.wmu.Lock()
 	endStream := !hasBody && !hasTrailers
-	werr := cc.writeHeaders(cs.ID, endStream, int(cc.maxFrameSize), hdrs)
+	priority, hasPriority := cc.headersPriority(req)
+	var pp *PriorityParam
+	if hasPriority {
+		pp = &priority
+	}
+	werr := cc.writeHeaders(cs.ID, endStream, int(cc.maxFrameSize), pp, hdrs)
+	if p, ok := http.PriorityUpdateFromContext(req.Context()); ok && werr == nil {
+		cc.fr.WritePriorityUpdate(cs.ID, p.String())
+		cc.bw.Flush()
+		werr = cc.werr
+	}
 	cc.wmu.Unlock()
+	if hasPriority {
+		traceWroteHeadersPriority(cs.trace, cs.ID, priority)
+	}
 	traceWroteHeaders(cs.trace)
 	cc.mu.Unlock()
 
@@ -1206,6 +1501,10 @@ func (cc *ClientConn) roundTrip(req *http.Request) (res *http.Response, gotErrAf
 			bodyWriter.cancel()
 			cs.abortRequestBodyWrite(errStopReqBodyWrite)
 			if hasBody && !bodyWritten {
+				// The body write may be blocked in a Read
+				// that only returns once the body is closed,
+				// as with a pipe streaming to the server.
+				go req.Body.Close()
 				<-bodyWriter.resc
 			}
 		}
@@ -1321,23 +1620,54 @@ func (cc *ClientConn) awaitOpenSlotForRequest(req *http.Request) error {
 	}
 }
 
+// headersPriority returns the priority to send in the HEADERS frame of
+// req: the StreamPriority of its context, or else the HeaderPriority of
+// the Transport's profile. It reports false if neither is set, in which
+// case the HEADERS frame carries no priority.
+func (cc *ClientConn) headersPriority(req *http.Request) (PriorityParam, bool) {
+	p, ok := http.StreamPriorityFromContext(req.Context())
+	if !ok && cc.t != nil {
+		if profile := cc.t.profile(); profile != nil && profile.HeaderPriority != nil {
+			p, ok = *profile.HeaderPriority, true
+		}
+	}
+	if !ok {
+		return PriorityParam{}, false
+	}
+	return PriorityParam{
+		StreamDep: p.StreamDep,
+		Exclusive: p.Exclusive,
+		Weight:    p.Weight,
+	}, true
+}
+
+// writeHeaders writes hdrs as a HEADERS frame and any CONTINUATION
+// frames it needs. The HEADERS frame carries priority if it is non-nil.
 // requires cc.wmu be held
-func (cc *ClientConn) writeHeaders(streamID uint32, endStream bool, maxFrameSize int, hdrs []byte) error {
+func (cc *ClientConn) writeHeaders(streamID uint32, endStream bool, maxFrameSize int, priority *PriorityParam, hdrs []byte) error {
 	first := true // first frame written (HEADERS is first, then CONTINUATION)
 	for len(hdrs) > 0 && cc.werr == nil {
 		chunk := hdrs
-		if len(chunk) > maxFrameSize {
-			chunk = chunk[:maxFrameSize]
+		max := maxFrameSize
+		if first && priority != nil {
+			max -= 5 // priority fields take 5 bytes of the HEADERS payload
+		}
+		if len(chunk) > max {
+			chunk = chunk[:max]
 		}
 		hdrs = hdrs[len(chunk):]
 		endHeaders := len(hdrs) == 0
 		if first {
-			cc.fr.WriteHeaders(HeadersFrameParam{
+			p := HeadersFrameParam{
 				StreamID:      streamID,
 				BlockFragment: chunk,
 				EndStream:     endStream,
 				EndHeaders:    endHeaders,
-			})
+			}
+			if priority != nil {
+				p.Priority, p.HasPriority = *priority, true
+			}
+			cc.fr.WriteHeaders(p)
 			first = false
 		} else {
 			cc.fr.WriteContinuation(streamID, endHeaders, chunk)
@@ -1502,7 +1832,7 @@ func (cs *clientStream) writeRequestBody(body io.Reader, bodyCloser io.Closer) (
 	// Two ways to send END_STREAM: either with trailers, or
 	// with an empty DATA frame.
 	if len(trls) > 0 {
-		err = cc.writeHeaders(cs.ID, true, maxFrameSize, trls)
+		err = cc.writeHeaders(cs.ID, true, maxFrameSize, nil, trls)
 	} else {
 		err = cc.fr.WriteData(cs.ID, true, nil)
 	}
@@ -1595,6 +1925,10 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 		}
 	}
 
+	var profile *http.ClientProfile
+	if cc.t != nil {
+		profile = cc.t.profile()
+	}
 	enumerateHeaders := func(f func(name, value string)) {
 		// 8.1.2.3 Request Pseudo-Header Fields
 		// The :path pseudo-header field includes the path and query parts of the
@@ -1603,6 +1937,9 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 		// [RFC3986]).
 
 		pHeaderOrder, ok := req.Header[http.PHeaderOrderKey]
+		if !ok && profile != nil && len(profile.PHeaderOrder) > 0 {
+			pHeaderOrder, ok = profile.PHeaderOrder, true
+		}
 		m := req.Method
 		if m == "" {
 			m = http.MethodGet
@@ -1654,16 +1991,25 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 			hdrs["accept-encoding"] = []string{"gzip, deflate, br"}
 		}
 
+		// RFC 9218 priority, unless the request sets its own header.
+		if p, ok := http.ExtensiblePriorityFromContext(req.Context()); ok {
+			if _, ok := hdrs["priority"]; !ok && hdrs.Get("Priority") == "" {
+				if v := p.String(); v != "" {
+					hdrs["priority"] = []string{v}
+				}
+			}
+		}
+
 		// Formats and writes headers with f function
 		var didUA bool
 		var kvs []http.HeaderKeyValues
 
-		if headerOrder, ok := hdrs[http.HeaderOrderKey]; ok {
-			order := make(map[string]int)
-			for i, v := range headerOrder {
-				order[v] = i
-			}
-			kvs, _ = hdrs.SortedKeyValuesBy(order, make(map[string]bool))
+		headerOrder, ok := hdrs[http.HeaderOrderKey]
+		if !ok && profile != nil && len(profile.HeaderOrder) > 0 {
+			headerOrder, ok = profile.HeaderOrder, true
+		}
+		if ok {
+			kvs = hdrs.OrderedKeyValues(headerOrder, nil)
 		} else {
 			kvs, _ = hdrs.SortedKeyValues(make(map[string]bool))
 		}
@@ -1708,6 +2054,9 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 				// User-Agent. If set to nil or empty string,
 				// then omit it. Otherwise if not mentioned,
 				// include the default (below).
+				if didUA {
+					continue
+				}
 				didUA = true
 				if len(kv.Values) > 1 {
 					kv.Values = kv.Values[:1]
@@ -1746,6 +2095,7 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 	traceHeaders := traceHasWroteHeaderField(trace)
 
 	// Header list size is ok. Write the headers.
+	sensitive := http.SensitiveHeadersFromContext(req.Context())
 	enumerateHeaders(func(name, value string) {
 		// skips over writing magic key headers
 		if name == http.PHeaderOrderKey || name == http.HeaderOrderKey {
@@ -1753,7 +2103,7 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 		}
 
 		name = strings.ToLower(name)
-		cc.writeHeader(name, value)
+		cc.writeHeader(name, value, sensitive)
 		if traceHeaders {
 			traceWroteHeaderField(trace, name, value)
 		}
@@ -1799,22 +2149,32 @@ func (cc *ClientConn) encodeTrailers(req *http.Request) ([]byte, error) {
 		return nil, errRequestHeaderListSize
 	}
 
+	sensitive := http.SensitiveHeadersFromContext(req.Context())
 	for k, vv := range req.Trailer {
 		// Transfer-Encoding, etc.. have already been filtered at the
 		// start of RoundTrip
 		lowKey := strings.ToLower(k)
 		for _, v := range vv {
-			cc.writeHeader(lowKey, v)
+			cc.writeHeader(lowKey, v, sensitive)
 		}
 	}
 	return cc.hbuf.Bytes(), nil
 }
 
-func (cc *ClientConn) writeHeader(name, value string) {
+// writeHeader encodes the lowercase header field name: value. It is
+// encoded as never indexed if name is listed in sensitive.
+func (cc *ClientConn) writeHeader(name, value string, sensitive []string) {
 	if VerboseLogs {
 		log.Printf("http2: Transport encoding header %q = %q", name, value)
 	}
-	cc.henc.WriteField(hpack.HeaderField{Name: name, Value: value})
+	hf := hpack.HeaderField{Name: name, Value: value}
+	for _, s := range sensitive {
+		if s == name {
+			hf.Sensitive = true
+			break
+		}
+	}
+	cc.henc.WriteField(hf)
 }
 
 type resAndError struct {
@@ -1834,7 +2194,7 @@ func (cc *ClientConn) newStreamWithID(streamID uint32, incNext bool) *clientStre
 	}
 	cs.flow.add(int32(cc.initialWindowSize))
 	cs.flow.setConnFlow(&cc.flow)
-	cs.inflow.add(transportDefaultStreamFlow)
+	cs.inflow.add(cc.streamFlow)
 	cs.inflow.setConnFlow(&cc.inflow)
 	cc.streams[cs.ID] = cs
 
@@ -2123,6 +2483,10 @@ func (rl *clientConnReadLoop) handleResponse(cs *clientStream, f *MetaHeadersFra
 		Header:     header,
 		StatusCode: statusCode,
 		Status:     status + " " + http.StatusText(statusCode),
+		RawHeaders: make([]http.RawHeader, len(f.Fields)),
+	}
+	for i, hf := range f.Fields {
+		res.RawHeaders[i] = http.RawHeader{Name: hf.Name, Value: hf.Value}
 	}
 	for _, hf := range regularFields {
 		key := http.CanonicalHeaderKey(hf.Name)
@@ -2273,8 +2637,8 @@ func (b transportResponseBody) Read(p []byte) (n int, err error) {
 
 	var connAdd, streamAdd int32
 	// Check the conn-level first, before the stream-level.
-	if v := cc.inflow.available(); v < transportDefaultConnFlow/2 {
-		connAdd = transportDefaultConnFlow - v
+	if v := cc.inflow.available(); v < cc.connFlow/2 {
+		connAdd = cc.connFlow - v
 		cc.inflow.add(connAdd)
 	}
 	if err == nil { // No need to refresh if the stream is over or failed.
@@ -2282,8 +2646,8 @@ func (b transportResponseBody) Read(p []byte) (n int, err error) {
 		// consumed by the client) when computing flow control for this
 		// stream.
 		v := int(cs.inflow.available()) + cs.bufPipe.Len()
-		if v < transportDefaultStreamFlow-transportDefaultStreamMinRefresh {
-			streamAdd = int32(transportDefaultStreamFlow - v)
+		if v < int(cc.streamFlow)-transportDefaultStreamMinRefresh {
+			streamAdd = cc.streamFlow - int32(v)
 			cs.inflow.add(streamAdd)
 		}
 	}
@@ -2497,6 +2861,10 @@ func (rl *clientConnReadLoop) processSettings(f *SettingsFrame) error {
 			cc.maxConcurrentStreams = s.Val
 		case SettingMaxHeaderListSize:
 			cc.peerMaxHeaderListSize = uint64(s.Val)
+		case SettingHeaderTableSize:
+			// RFC 7541, Section 4.2: the new size is signaled
+			// at the start of the next header block.
+			cc.henc.SetMaxDynamicTableSize(s.Val)
 		case SettingInitialWindowSize:
 			// Values above the maximum flow-control
 			// window size of 2^31-1 MUST be treated as a
@@ -2517,7 +2885,6 @@ func (rl *clientConnReadLoop) processSettings(f *SettingsFrame) error {
 
 			cc.initialWindowSize = s.Val
 		default:
-			// TODO(bradfitz): handle more settings? SETTINGS_HEADER_TABLE_SIZE probably.
 			cc.vlogf("Unhandled Setting: %v", s)
 		}
 		return nil
@@ -2917,6 +3284,17 @@ func traceWroteHeaders(trace *httptrace.ClientTrace) {
 	}
 }
 
+func traceWroteHeadersPriority(trace *httptrace.ClientTrace, streamID uint32, p PriorityParam) {
+	if trace != nil && trace.WroteHeadersPriority != nil {
+		trace.WroteHeadersPriority(httptrace.HeadersPriorityInfo{
+			StreamID:  streamID,
+			StreamDep: p.StreamDep,
+			Exclusive: p.Exclusive,
+			Weight:    p.Weight,
+		})
+	}
+}
+
 func traceGot100Continue(trace *httptrace.ClientTrace) {
 	if trace != nil && trace.Got100Continue != nil {
 		trace.Got100Continue()
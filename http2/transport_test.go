@@ -3261,7 +3261,7 @@ func TestClientConnPing(t *testing.T) {
 	defer st.Close()
 	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
 	defer tr.CloseIdleConnections()
-	cc, err := tr.dialClientConn(st.ts.Listener.Addr().String(), false)
+	cc, err := tr.dialClientConn(context.Background(), st.ts.Listener.Addr().String(), nil, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -4760,7 +4760,7 @@ func testClientConnClose(t *testing.T, closeMode closeMode) {
 	defer st.Close()
 	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
 	defer tr.CloseIdleConnections()
-	cc, err := tr.dialClientConn(st.ts.Listener.Addr().String(), false)
+	cc, err := tr.dialClientConn(context.Background(), st.ts.Listener.Addr().String(), nil, false)
 	req, err := http.NewRequest("GET", st.ts.URL, nil)
 	if err != nil {
 		t.Fatal(err)
@@ -5270,7 +5270,7 @@ func TestTransportRoundtripCloseOnWriteError(t *testing.T) {
 
 	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
 	defer tr.CloseIdleConnections()
-	cc, err := tr.dialClientConn(st.ts.Listener.Addr().String(), false)
+	cc, err := tr.dialClientConn(context.Background(), st.ts.Listener.Addr().String(), nil, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -5373,3 +5373,696 @@ func TestTransportServerResetStreamAtHeaders(t *testing.T) {
 	}
 	res.Body.Close()
 }
+
+func TestTransportClientProfile(t *testing.T) {
+	ct := newClientTester(t)
+	ct.tr.Profile = http.ProfileFirefox133
+	ct.client = func() error {
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		req.Header.Set("Accept", "*/*")
+		req.Header.Set("User-Agent", "ua")
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+	ct.server = func() error {
+		got, err := ct.readClientSettings()
+		if err != nil {
+			return err
+		}
+		want := []Setting{
+			{ID: SettingHeaderTableSize, Val: 65536},
+			{ID: SettingEnablePush, Val: 0},
+			{ID: SettingInitialWindowSize, Val: 131072},
+			{ID: SettingMaxFrameSize, Val: 16384},
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("settings = %v; want %v", got, want)
+		}
+		f, err := ct.fr.ReadFrame()
+		if err != nil {
+			return err
+		}
+		if wuf, ok := f.(*WindowUpdateFrame); !ok || wuf.StreamID != 0 || wuf.Increment != 12517377 {
+			return fmt.Errorf("got %v; want conn WINDOW_UPDATE of 12517377", f)
+		}
+		if err := ct.fr.WriteSettings(); err != nil {
+			return err
+		}
+		hf, err := ct.firstHeaders()
+		if err != nil {
+			return err
+		}
+		var names []string
+		dec := hpack.NewDecoder(initialHeaderTableSize, func(f hpack.HeaderField) {
+			names = append(names, f.Name)
+		})
+		if _, err := dec.Write(hf.HeaderBlockFragment()); err != nil {
+			return err
+		}
+		wantNames := []string{":method", ":path", ":authority", ":scheme", "user-agent", "accept", "accept-encoding"}
+		if !reflect.DeepEqual(names, wantNames) {
+			return fmt.Errorf("header order = %q; want %q", names, wantNames)
+		}
+		var buf2 bytes.Buffer
+		enc := hpack.NewEncoder(&buf2)
+		enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+		return ct.fr.WriteHeaders(HeadersFrameParam{
+			StreamID:      hf.StreamID,
+			EndHeaders:    true,
+			EndStream:     true,
+			BlockFragment: buf2.Bytes(),
+		})
+	}
+	ct.run()
+}
+
+// readClientSettings reads the client preface and the settings of the
+// initial SETTINGS frame, in the order they were written.
+func (ct *clientTester) readClientSettings() ([]Setting, error) {
+	buf := make([]byte, len(ClientPreface))
+	if _, err := io.ReadFull(ct.sc, buf); err != nil {
+		return nil, fmt.Errorf("reading client preface: %v", err)
+	}
+	f, err := ct.fr.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	sf, ok := f.(*SettingsFrame)
+	if !ok {
+		return nil, fmt.Errorf("got %v; want SETTINGS", f)
+	}
+	var settings []Setting
+	sf.ForeachSetting(func(s Setting) error {
+		settings = append(settings, s)
+		return nil
+	})
+	return settings, nil
+}
+
+func TestTransportSettingsExactOrder(t *testing.T) {
+	ct := newClientTester(t)
+	ct.tr.Settings = []Setting{
+		{ID: SettingHeaderTableSize, Val: 65536},
+		{ID: SettingMaxConcurrentStreams, Val: 1000},
+		{ID: SettingInitialWindowSize, Val: 6291456},
+		{ID: SettingMaxHeaderListSize, Val: 262144},
+	}
+	ct.client = func() error {
+		cc, err := ct.tr.NewClientConn(ct.cc)
+		if err != nil {
+			return err
+		}
+		cc.mu.Lock()
+		cs := cc.newStream()
+		got := cs.inflow.available()
+		cc.mu.Unlock()
+		if got != 6291456 {
+			return fmt.Errorf("stream inflow = %d; want 6291456", got)
+		}
+		return nil
+	}
+	ct.server = func() error {
+		got, err := ct.readClientSettings()
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got, ct.tr.Settings) {
+			return fmt.Errorf("settings = %v; want %v", got, ct.tr.Settings)
+		}
+		return nil
+	}
+	ct.run()
+}
+
+func TestTransportPrefacePriorityFrames(t *testing.T) {
+	ct := newClientTester(t)
+	ct.tr.ConnectionFlow = 12517377
+	ct.tr.PriorityFrames = []PriorityFrameParam{
+		{StreamID: 3, PriorityParam: PriorityParam{Weight: 200}},
+		{StreamID: 5, PriorityParam: PriorityParam{Weight: 100}},
+		{StreamID: 7, PriorityParam: PriorityParam{Weight: 0}},
+		{StreamID: 9, PriorityParam: PriorityParam{StreamDep: 7, Weight: 0}},
+		{StreamID: 11, PriorityParam: PriorityParam{StreamDep: 3, Weight: 0}},
+		{StreamID: 13, PriorityParam: PriorityParam{Weight: 240}},
+	}
+	ct.client = func() error {
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+	ct.server = func() error {
+		if _, err := ct.readClientSettings(); err != nil {
+			return err
+		}
+		f, err := ct.fr.ReadFrame()
+		if err != nil {
+			return err
+		}
+		if wuf, ok := f.(*WindowUpdateFrame); !ok || wuf.StreamID != 0 || wuf.Increment != ct.tr.ConnectionFlow {
+			return fmt.Errorf("got %v; want conn WINDOW_UPDATE of %d", f, ct.tr.ConnectionFlow)
+		}
+		for _, want := range ct.tr.PriorityFrames {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				return err
+			}
+			pf, ok := f.(*PriorityFrame)
+			if !ok || pf.StreamID != want.StreamID || pf.PriorityParam != want.PriorityParam {
+				return fmt.Errorf("got %v; want PRIORITY %+v", f, want)
+			}
+		}
+		if err := ct.fr.WriteSettings(); err != nil {
+			return err
+		}
+		hf, err := ct.firstHeaders()
+		if err != nil {
+			return err
+		}
+		if hf.StreamID != 15 {
+			return fmt.Errorf("request sent on stream %d; want 15", hf.StreamID)
+		}
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+		return ct.fr.WriteHeaders(HeadersFrameParam{
+			StreamID:      hf.StreamID,
+			EndHeaders:    true,
+			EndStream:     true,
+			BlockFragment: buf.Bytes(),
+		})
+	}
+	ct.run()
+}
+
+func TestTransportConnectionFlowTooLarge(t *testing.T) {
+	for _, flow := range []uint32{maxConnFlow + 1, 1<<31 - 1, 1<<32 - 1} {
+		c1, c2 := net.Pipe()
+		tr := &Transport{ConnectionFlow: flow}
+		if _, err := tr.NewClientConn(c1); err != errConnFlow {
+			t.Errorf("ConnectionFlow %d: err = %v; want %v", flow, err, errConnFlow)
+		}
+		c1.Close()
+		c2.Close()
+	}
+}
+
+func TestTransportPrefaceWriteError(t *testing.T) {
+	c1, c2 := net.Pipe()
+	c2.Close()
+	tr := &Transport{ConnectionFlow: maxConnFlow}
+	if _, err := tr.NewClientConn(c1); err == nil {
+		t.Fatal("NewClientConn succeeded on a closed conn; want preface write error")
+	}
+}
+
+func TestTransportHeadersPriority(t *testing.T) {
+	ct := newClientTester(t)
+	ct.tr.Profile = http.ProfileChrome131
+	want := PriorityParam{StreamDep: 0, Exclusive: false, Weight: 41}
+	ct.client = func() error {
+		var traced httptrace.HeadersPriorityInfo
+		trace := &httptrace.ClientTrace{
+			WroteHeadersPriority: func(info httptrace.HeadersPriorityInfo) { traced = info },
+		}
+		ctx := httptrace.WithClientTrace(context.Background(), trace)
+		ctx = http.WithStreamPriority(ctx, http.StreamPriority{Weight: 41})
+		req, _ := http.NewRequestWithContext(ctx, "GET", "https://dummy.tld/", nil)
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		if traced.StreamID != 1 || traced.Weight != 41 || traced.Exclusive {
+			return fmt.Errorf("traced priority = %+v", traced)
+		}
+		return res.Body.Close()
+	}
+	ct.server = func() error {
+		ct.greet()
+		hf, err := ct.firstHeaders()
+		if err != nil {
+			return err
+		}
+		if !hf.HasPriority() || hf.Priority != want {
+			return fmt.Errorf("HEADERS priority = %+v (flag %v); want %+v", hf.Priority, hf.HasPriority(), want)
+		}
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+		return ct.fr.WriteHeaders(HeadersFrameParam{
+			StreamID:      hf.StreamID,
+			EndHeaders:    true,
+			EndStream:     true,
+			BlockFragment: buf.Bytes(),
+		})
+	}
+	ct.run()
+}
+
+// An explicit zero StreamPriority is sent as such, overriding the
+// profile's HeaderPriority rather than being treated as unset.
+func TestTransportHeadersPriorityZero(t *testing.T) {
+	ct := newClientTester(t)
+	ct.tr.Profile = http.ProfileChrome131
+	ct.client = func() error {
+		var traced bool
+		trace := &httptrace.ClientTrace{
+			WroteHeadersPriority: func(httptrace.HeadersPriorityInfo) { traced = true },
+		}
+		ctx := httptrace.WithClientTrace(context.Background(), trace)
+		ctx = http.WithStreamPriority(ctx, http.StreamPriority{})
+		req, _ := http.NewRequestWithContext(ctx, "GET", "https://dummy.tld/", nil)
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		if !traced {
+			return errors.New("WroteHeadersPriority not called")
+		}
+		return res.Body.Close()
+	}
+	ct.server = func() error {
+		ct.greet()
+		hf, err := ct.firstHeaders()
+		if err != nil {
+			return err
+		}
+		if !hf.HasPriority() || !hf.Priority.IsZero() {
+			return fmt.Errorf("HEADERS priority = %+v (flag %v); want zero priority with flag", hf.Priority, hf.HasPriority())
+		}
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+		return ct.fr.WriteHeaders(HeadersFrameParam{
+			StreamID:      hf.StreamID,
+			EndHeaders:    true,
+			EndStream:     true,
+			BlockFragment: buf.Bytes(),
+		})
+	}
+	ct.run()
+}
+
+func TestTransportExtensiblePriority(t *testing.T) {
+	ct := newClientTester(t)
+	ct.client = func() error {
+		ctx := http.WithExtensiblePriority(context.Background(), http.ExtensiblePriority{Urgency: 0, Incremental: true})
+		ctx = http.WithPriorityUpdate(ctx, http.ExtensiblePriority{Urgency: 5})
+		req, _ := http.NewRequestWithContext(ctx, "GET", "https://dummy.tld/", nil)
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+	ct.server = func() error {
+		ct.greet()
+		hf, err := ct.firstHeaders()
+		if err != nil {
+			return err
+		}
+		dec := hpack.NewDecoder(initialHeaderTableSize, nil)
+		hfs, err := dec.DecodeFull(hf.HeaderBlockFragment())
+		if err != nil {
+			return err
+		}
+		var got string
+		for _, f := range hfs {
+			if f.Name == "priority" {
+				got = f.Value
+			}
+		}
+		if want := "u=0, i"; got != want {
+			return fmt.Errorf("priority header = %q; want %q", got, want)
+		}
+		f, err := ct.fr.ReadFrame()
+		if err != nil {
+			return err
+		}
+		pu, ok := f.(*PriorityUpdateFrame)
+		if !ok {
+			return fmt.Errorf("got %v; want PRIORITY_UPDATE", summarizeFrame(f))
+		}
+		if pu.PrioritizedStreamID != hf.StreamID || pu.PriorityFieldValue != "u=5" {
+			return fmt.Errorf("PRIORITY_UPDATE = stream %d %q; want stream %d %q",
+				pu.PrioritizedStreamID, pu.PriorityFieldValue, hf.StreamID, "u=5")
+		}
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+		return ct.fr.WriteHeaders(HeadersFrameParam{
+			StreamID:      hf.StreamID,
+			EndHeaders:    true,
+			EndStream:     true,
+			BlockFragment: buf.Bytes(),
+		})
+	}
+	ct.run()
+}
+
+func TestTransportHeaderEncodings(t *testing.T) {
+	const ua = "fhttp-test"
+	ct := newClientTester(t)
+	ct.tr.HeaderEncodings = map[string]hpack.FieldEncoding{
+		"user-agent": {Indexing: hpack.IndexingNone, Huffman: hpack.HuffmanNever},
+	}
+	ct.client = func() error {
+		ctx := http.WithSensitiveHeaders(context.Background(), "Cookie")
+		req, _ := http.NewRequestWithContext(ctx, "GET", "https://dummy.tld/", nil)
+		req.Header.Set("User-Agent", ua)
+		req.Header.Set("Cookie", "a=b")
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+	ct.server = func() error {
+		ct.greet()
+		hf, err := ct.firstHeaders()
+		if err != nil {
+			return err
+		}
+		block := hf.HeaderBlockFragment()
+		// user-agent is static table entry 58, written as a literal
+		// without indexing and a raw string value.
+		if want := "\x0f\x2b" + string(rune(len(ua))) + ua; !bytes.Contains(block, []byte(want)) {
+			return fmt.Errorf("header block %q doesn't contain %q", block, want)
+		}
+		dec := hpack.NewDecoder(initialHeaderTableSize, nil)
+		hfs, err := dec.DecodeFull(block)
+		if err != nil {
+			return err
+		}
+		for _, f := range hfs {
+			if f.Name == "cookie" && !f.Sensitive {
+				return errors.New("cookie wasn't encoded as never indexed")
+			}
+		}
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+		return ct.fr.WriteHeaders(HeadersFrameParam{
+			StreamID:      hf.StreamID,
+			EndHeaders:    true,
+			EndStream:     true,
+			BlockFragment: buf.Bytes(),
+		})
+	}
+	ct.run()
+}
+
+func TestTransportHeaderTableSizeUpdate(t *testing.T) {
+	ct := newClientTester(t)
+	ct.client = func() error {
+		cc, err := ct.tr.NewClientConn(ct.cc)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+			res, err := cc.RoundTrip(req)
+			if err != nil {
+				return err
+			}
+			res.Body.Close()
+		}
+		want := hpack.TableState{MaxSize: 0, MaxSizeLimit: initialHeaderTableSize}
+		if got := cc.HeaderEncoderState(); got != want {
+			return fmt.Errorf("HeaderEncoderState = %+v; want %+v", got, want)
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet(Setting{SettingHeaderTableSize, 0})
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+		for i := 0; i < 2; i++ {
+			hf, err := ct.firstHeaders()
+			if err != nil {
+				return err
+			}
+			// The server's SETTINGS are read before the first
+			// response, so the second request must start with a
+			// Dynamic Table Size Update to 0.
+			if i == 1 {
+				if block := hf.HeaderBlockFragment(); len(block) == 0 || block[0] != 0x20 {
+					return fmt.Errorf("second header block starts with %x; want a size update to 0", block)
+				}
+			}
+			if err := ct.fr.WriteHeaders(HeadersFrameParam{
+				StreamID:      hf.StreamID,
+				EndHeaders:    true,
+				EndStream:     true,
+				BlockFragment: buf.Bytes(),
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	ct.run()
+}
+
+func TestTransportEncodeInterleavedHeaders(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+	req.Header = http.Header{
+		"accept":            {"text/html", "*/*"},
+		"x-a":               {"1"},
+		"user-agent":        {"ua"},
+		http.HeaderOrderKey: {"accept", "x-a", "accept", "user-agent"},
+	}
+	cc := &ClientConn{peerMaxHeaderListSize: 0xffffffffffffffff}
+	cc.henc = hpack.NewEncoder(&cc.hbuf)
+	cc.mu.Lock()
+	hdrs, err := cc.encodeHeaders(req, false, "", -1)
+	cc.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	dec := hpack.NewDecoder(initialHeaderTableSize, func(f hpack.HeaderField) {
+		if !strings.HasPrefix(f.Name, ":") {
+			got = append(got, f.Name+": "+f.Value)
+		}
+	})
+	if _, err := dec.Write(hdrs); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"accept: text/html", "x-a: 1", "accept: */*", "user-agent: ua"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("headers = %q; want %q", got, want)
+	}
+}
+
+func TestTransportResponseRawHeaders(t *testing.T) {
+	ct := newClientTester(t)
+	ct.client = func() error {
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		want := []http.RawHeader{
+			{Name: ":status", Value: "200"},
+			{Name: "server", Value: "cdn"},
+			{Name: "set-cookie", Value: "a=1"},
+			{Name: "x-cache", Value: "HIT"},
+			{Name: "set-cookie", Value: "b=2"},
+		}
+		if !reflect.DeepEqual(res.RawHeaders, want) {
+			return fmt.Errorf("RawHeaders = %q; want %q", res.RawHeaders, want)
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		hf, err := ct.firstHeaders()
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		for _, kv := range [][2]string{
+			{":status", "200"},
+			{"server", "cdn"},
+			{"set-cookie", "a=1"},
+			{"x-cache", "HIT"},
+			{"set-cookie", "b=2"},
+		} {
+			enc.WriteField(hpack.HeaderField{Name: kv[0], Value: kv[1]})
+		}
+		return ct.fr.WriteHeaders(HeadersFrameParam{
+			StreamID:      hf.StreamID,
+			EndHeaders:    true,
+			EndStream:     true,
+			BlockFragment: buf.Bytes(),
+		})
+	}
+	ct.run()
+}
+
+func TestTransportDialTLSContext(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {}, optOnlyServer)
+	defer st.Close()
+
+	type ctxKey struct{}
+	var gotValue interface{}
+	tr := &Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			gotValue = ctx.Value(ctxKey{})
+			cfg.InsecureSkipVerify = true
+			var d tls.Dialer
+			d.Config = cfg
+			return d.DialContext(ctx, network, addr)
+		},
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			t.Error("DialTLS called; want DialTLSContext")
+			return nil, errors.New("unexpected DialTLS")
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("GET", st.ts.URL, nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "v"))
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if gotValue != "v" {
+		t.Errorf("dial context value = %v; want %q", gotValue, "v")
+	}
+}
+
+func TestTransportDialContextCanceled(t *testing.T) {
+	dialing := make(chan struct{})
+	tr := &Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			close(dialing)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+	req = req.WithContext(ctx)
+	go func() {
+		<-dialing
+		cancel()
+	}()
+	_, err := tr.RoundTrip(req)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("RoundTrip error = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestTransportProxyConnect(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}, optOnlyServer)
+	defer st.Close()
+
+	connectc := make(chan *http.Request, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connectc <- r
+		if r.Method != "CONNECT" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		target, err := net.Dial("tcp", st.ts.Listener.Addr().String())
+		if err != nil {
+			t.Errorf("proxy dial: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\n\r\n")
+		go io.Copy(target, brw)
+		io.Copy(conn, target)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "pass")
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		Proxy: func(*http.Request) (*url.URL, error) {
+			return proxyURL, nil
+		},
+		ProxyConnectHeader: http.Header{"X-Proxy": {"1"}},
+	}
+	defer tr.CloseIdleConnections()
+
+	req, _ := http.NewRequest("GET", "https://example.com:443/", nil)
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "example.com:443" {
+		t.Errorf("body = %q; want %q", body, "example.com:443")
+	}
+
+	r := <-connectc
+	if r.Method != "CONNECT" || r.Host != "example.com:443" {
+		t.Errorf("proxy got %s %s; want CONNECT example.com:443", r.Method, r.Host)
+	}
+	if got, want := r.Header.Get("Proxy-Authorization"), "Basic dXNlcjpwYXNz"; got != want {
+		t.Errorf("Proxy-Authorization = %q; want %q", got, want)
+	}
+	if got := r.Header.Get("X-Proxy"); got != "1" {
+		t.Errorf("X-Proxy = %q; want %q", got, "1")
+	}
+}
+
+// A non-2xx response must not wait for a request body that is still
+// being streamed and won't end on its own.
+func TestTransportNon2xxResponseStreamingBody(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}, optOnlyServer)
+	defer st.Close()
+
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
+	defer tr.CloseIdleConnections()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	req, _ := http.NewRequest("POST", st.ts.URL, pr)
+	errc := make(chan error, 1)
+	go func() {
+		res, err := tr.RoundTrip(req)
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode != http.StatusForbidden {
+				err = fmt.Errorf("status = %d; want %d", res.StatusCode, http.StatusForbidden)
+			}
+		}
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RoundTrip blocked on the request body")
+	}
+}
@@ -0,0 +1,190 @@
+package http2
+
+import (
+	"math"
+	"sort"
+
+	http "github.com/useflyent/fhttp"
+)
+
+// ExtensiblePriorityWriteScheduler is a WriteScheduler that schedules
+// streams by their RFC 9218 extensible priority. The Server parses the
+// "priority" request header and PRIORITY_UPDATE frames for schedulers
+// that implement it.
+type ExtensiblePriorityWriteScheduler interface {
+	WriteScheduler
+
+	// AdjustStreamExtensible sets the extensible priority of the
+	// given stream. It may be called on a stream that is not open,
+	// in which case it does nothing.
+	AdjustStreamExtensible(streamID uint32, priority http.ExtensiblePriority)
+}
+
+// NewExtensiblePriorityWriteScheduler constructs a WriteScheduler that
+// follows RFC 9218. Control frames are written first. Otherwise the
+// streams with the lowest urgency are served first; among those,
+// non-incremental streams are written one at a time in stream ID
+// order, and incremental streams share the connection round-robin.
+// RFC 7540 priorities are ignored.
+func NewExtensiblePriorityWriteScheduler() ExtensiblePriorityWriteScheduler {
+	return &extensibleWriteScheduler{sq: make(map[uint32]*extensibleStream)}
+}
+
+type extensibleStream struct {
+	id       uint32
+	priority http.ExtensiblePriority
+	q        *writeQueue
+	open     bool // false for idle or closed streams with a queued RST_STREAM
+}
+
+type extensibleWriteScheduler struct {
+	// zero are frames not associated with a specific stream.
+	zero writeQueue
+
+	// sq contains the open streams and streams with queued frames,
+	// keyed by stream ID.
+	sq map[uint32]*extensibleStream
+
+	// byUrgency holds the streams of sq per urgency, ordered by
+	// stream ID.
+	byUrgency [8][]*extensibleStream
+
+	// lastIncremental is, per urgency, the ID of the incremental
+	// stream written last, so the next one can be picked round-robin.
+	lastIncremental [8]uint32
+
+	// pool of empty queues for reuse.
+	queuePool writeQueuePool
+}
+
+func (ws *extensibleWriteScheduler) OpenStream(streamID uint32, options OpenStreamOptions) {
+	if st, ok := ws.sq[streamID]; ok {
+		st.open = true
+		return
+	}
+	st := &extensibleStream{
+		id:       streamID,
+		priority: http.DefaultExtensiblePriority,
+		q:        ws.queuePool.get(),
+		open:     true,
+	}
+	ws.sq[streamID] = st
+	ws.insert(st)
+}
+
+func (ws *extensibleWriteScheduler) CloseStream(streamID uint32) {
+	st, ok := ws.sq[streamID]
+	if !ok {
+		return
+	}
+	delete(ws.sq, streamID)
+	ws.remove(st)
+	ws.queuePool.put(st.q)
+}
+
+func (ws *extensibleWriteScheduler) AdjustStream(streamID uint32, priority PriorityParam) {
+	// no-op: RFC 7540 priorities are ignored
+}
+
+func (ws *extensibleWriteScheduler) AdjustStreamExtensible(streamID uint32, priority http.ExtensiblePriority) {
+	if st, ok := ws.sq[streamID]; ok {
+		if priority.Urgency > 7 {
+			priority.Urgency = 7
+		}
+		ws.remove(st)
+		st.priority = priority
+		ws.insert(st)
+	}
+}
+
+func (ws *extensibleWriteScheduler) Push(wr FrameWriteRequest) {
+	id := wr.StreamID()
+	if id == 0 {
+		ws.zero.push(wr)
+		return
+	}
+	st, ok := ws.sq[id]
+	if !ok {
+		// RST_STREAM on an idle or closed stream. Keep it until
+		// written; it's removed again once the queue drains.
+		st = &extensibleStream{
+			id:       id,
+			priority: http.DefaultExtensiblePriority,
+			q:        ws.queuePool.get(),
+		}
+		ws.sq[id] = st
+		ws.insert(st)
+	}
+	st.q.push(wr)
+}
+
+func (ws *extensibleWriteScheduler) Pop() (FrameWriteRequest, bool) {
+	// Control frames first.
+	if !ws.zero.empty() {
+		return ws.zero.shift(), true
+	}
+
+	for u, sts := range ws.byUrgency {
+		// Non-incremental streams are served sequentially.
+		for _, st := range sts {
+			if !st.priority.Incremental && !st.q.empty() {
+				if wr, ok := ws.consume(st); ok {
+					return wr, true
+				}
+			}
+		}
+
+		// Incremental streams take turns, starting after the one
+		// written last.
+		start := sort.Search(len(sts), func(i int) bool { return sts[i].id > ws.lastIncremental[u] })
+		for i := range sts {
+			st := sts[(start+i)%len(sts)]
+			if !st.priority.Incremental || st.q.empty() {
+				continue
+			}
+			if wr, ok := ws.consume(st); ok {
+				ws.lastIncremental[u] = st.id
+				return wr, true
+			}
+		}
+	}
+	return FrameWriteRequest{}, false
+}
+
+// consume pops the next frame of st, if flow control allows. Streams
+// that were never opened are dropped once their queue is drained.
+func (ws *extensibleWriteScheduler) consume(st *extensibleStream) (FrameWriteRequest, bool) {
+	wr, ok := st.q.consume(math.MaxInt32)
+	if !ok {
+		return FrameWriteRequest{}, false
+	}
+	if st.q.empty() && !st.open {
+		delete(ws.sq, st.id)
+		ws.remove(st)
+		ws.queuePool.put(st.q)
+	}
+	return wr, true
+}
+
+// insert adds st to the streams of its urgency, keeping them ordered
+// by stream ID.
+func (ws *extensibleWriteScheduler) insert(st *extensibleStream) {
+	sts := ws.byUrgency[st.priority.Urgency]
+	i := sort.Search(len(sts), func(i int) bool { return sts[i].id >= st.id })
+	sts = append(sts, nil)
+	copy(sts[i+1:], sts[i:])
+	sts[i] = st
+	ws.byUrgency[st.priority.Urgency] = sts
+}
+
+// remove deletes st from the streams of its urgency.
+func (ws *extensibleWriteScheduler) remove(st *extensibleStream) {
+	sts := ws.byUrgency[st.priority.Urgency]
+	i := sort.Search(len(sts), func(i int) bool { return sts[i].id >= st.id })
+	if i == len(sts) || sts[i] != st {
+		return
+	}
+	copy(sts[i:], sts[i+1:])
+	sts[len(sts)-1] = nil
+	ws.byUrgency[st.priority.Urgency] = sts[:len(sts)-1]
+}
@@ -0,0 +1,84 @@
+package http2
+
+import (
+	"reflect"
+	"testing"
+
+	http "github.com/useflyent/fhttp"
+)
+
+func TestExtensiblePriorityScheduler(t *testing.T) {
+	ws := NewExtensiblePriorityWriteScheduler()
+	for _, id := range []uint32{1, 3, 5, 7, 9} {
+		ws.OpenStream(id, OpenStreamOptions{})
+	}
+	ws.AdjustStreamExtensible(1, http.ExtensiblePriority{Urgency: 5})
+	ws.AdjustStreamExtensible(3, http.ExtensiblePriority{Urgency: 1, Incremental: true})
+	ws.AdjustStreamExtensible(5, http.ExtensiblePriority{Urgency: 1, Incremental: true})
+	ws.AdjustStreamExtensible(7, http.ExtensiblePriority{Urgency: 1})
+	// Stream 9 keeps the default urgency 3.
+
+	for _, id := range []uint32{1, 9, 7, 5, 3} {
+		ws.Push(makeWriteHeadersRequest(id))
+		ws.Push(makeWriteHeadersRequest(id))
+	}
+	ws.Push(makeWriteNonStreamRequest())
+
+	var got []uint32
+	for {
+		wr, ok := ws.Pop()
+		if !ok {
+			break
+		}
+		got = append(got, wr.StreamID())
+	}
+	// Control frames first, then urgency 1 with the non-incremental
+	// stream 7 before the incremental streams 3 and 5 taking turns,
+	// then urgency 3 and finally urgency 5.
+	want := []uint32{0, 7, 7, 3, 5, 3, 5, 9, 9, 1, 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got order %v; want %v", got, want)
+	}
+}
+
+func TestExtensiblePrioritySchedulerIdleRST(t *testing.T) {
+	ws := NewExtensiblePriorityWriteScheduler()
+	ws.Push(FrameWriteRequest{write: streamError(123, ErrCodeInternal)})
+	ews := ws.(*extensibleWriteScheduler)
+	if got, want := len(ews.sq), 1; got != want {
+		t.Fatalf("len(sq) = %v; want %v", got, want)
+	}
+	if _, ok := ws.Pop(); !ok {
+		t.Fatal("expected to be able to Pop")
+	}
+	if got, want := len(ews.sq), 0; got != want {
+		t.Fatalf("len(sq) = %v; want %v", got, want)
+	}
+	if got := ews.byUrgency[http.DefaultExtensiblePriority.Urgency]; len(got) != 0 {
+		t.Fatalf("byUrgency still holds %d streams", len(got))
+	}
+}
+
+func TestExtensiblePrioritySchedulerQueues(t *testing.T) {
+	ws := NewExtensiblePriorityWriteScheduler()
+	ews := ws.(*extensibleWriteScheduler)
+	for _, id := range []uint32{9, 3, 7, 1, 5} {
+		ws.OpenStream(id, OpenStreamOptions{})
+	}
+	ws.AdjustStreamExtensible(7, http.ExtensiblePriority{Urgency: 0})
+	ws.AdjustStreamExtensible(1, http.ExtensiblePriority{Urgency: 9})
+	ws.CloseStream(5)
+
+	ids := func(u int) []uint32 {
+		var ids []uint32
+		for _, st := range ews.byUrgency[u] {
+			ids = append(ids, st.id)
+		}
+		return ids
+	}
+	for u, want := range map[int][]uint32{0: {7}, 3: {3, 9}, 7: {1}} {
+		if got := ids(u); !reflect.DeepEqual(got, want) {
+			t.Errorf("urgency %d streams = %v; want %v", u, got, want)
+		}
+	}
+}
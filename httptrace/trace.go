@@ -152,6 +152,10 @@ type ClientTrace struct {
 	// all request headers.
 	WroteHeaders func()
 
+	// WroteHeadersPriority is called after the HTTP/2 Transport
+	// has written a HEADERS frame that carries a stream priority.
+	WroteHeadersPriority func(HeadersPriorityInfo)
+
 	// Wait100Continue is called if the Request specified
 	// "Expect: 100-continue" and the Transport has written the
 	// request headers but is waiting for "100 Continue" from the
@@ -171,6 +175,19 @@ type WroteRequestInfo struct {
 	Err error
 }
 
+// HeadersPriorityInfo contains information provided to the
+// WroteHeadersPriority hook.
+type HeadersPriorityInfo struct {
+	// StreamID is the stream the HEADERS frame was written on.
+	StreamID uint32
+
+	// StreamDep, Exclusive and Weight are the priority fields of
+	// the HEADERS frame. Weight is zero-indexed.
+	StreamDep uint32
+	Exclusive bool
+	Weight    uint8
+}
+
 // compose modifies t such that it respects the previously-registered hooks in old,
 // subject to the composition policy requested in t.Compose.
 func (t *ClientTrace) compose(old *ClientTrace) {
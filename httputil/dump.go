@@ -305,12 +305,18 @@ func (failureToReadBody) Close() error             { return nil }
 // emptyBody is an instance of empty reader.
 var emptyBody = io.NopCloser(strings.NewReader(""))
 
-// DumpResponse is like DumpRequest but dumps a response.
+// DumpResponse is like DumpRequest but dumps a response. If
+// resp.RawHeaders is set, as for responses read by a Transport or
+// ReadResponse, the headers are dumped in that order and with their
+// names spelled as received, unless resp.Header has a HeaderOrderKey
+// entry.
 func DumpResponse(resp *http.Response, body bool) ([]byte, error) {
 	var b bytes.Buffer
 	var err error
 	save := resp.Body
 	savecl := resp.ContentLength
+	savereplay := resp.ReplayRawHeaders
+	resp.ReplayRawHeaders = true
 
 	if !body {
 		// For content length of zero. Make sure the body is an empty
@@ -334,6 +340,7 @@ func DumpResponse(resp *http.Response, body bool) ([]byte, error) {
 	}
 	resp.Body = save
 	resp.ContentLength = savecl
+	resp.ReplayRawHeaders = savereplay
 	if err != nil {
 		return nil, err
 	}
@@ -479,6 +479,31 @@ func TestDumpResponse(t *testing.T) {
 	}
 }
 
+func TestDumpResponseReceivedHeaderOrder(t *testing.T) {
+	const raw = "HTTP/1.1 200 OK\r\n" +
+		"server: cdn\r\n" +
+		"Set-Cookie: a=1\r\n" +
+		"Content-Length: 5\r\n" +
+		"x-cache: HIT\r\n" +
+		"set-cookie: b=2\r\n" +
+		"\r\n" +
+		"Hello"
+	res, err := http.ReadResponse(bufio.NewReader(strings.NewReader(raw)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DumpResponse(res, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != raw {
+		t.Errorf("DumpResponse:\n got: %q\nwant: %q", got, raw)
+	}
+	if res.ReplayRawHeaders {
+		t.Error("DumpResponse left ReplayRawHeaders set")
+	}
+}
+
 // Issue 38352: Check for deadlock on cancelled requests.
 func TestDumpRequestOutIssue38352(t *testing.T) {
 	if testing.Short() {
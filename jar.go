@@ -5,7 +5,11 @@
 package http
 
 import (
+	"context"
+	"net/textproto"
 	"net/url"
+	"sort"
+	"strings"
 )
 
 // A CookieJar manages storage and use of cookies in HTTP requests.
@@ -25,3 +29,194 @@ type CookieJar interface {
 	// restrictions such as in RFC 6265.
 	Cookies(u *url.URL) []*Cookie
 }
+
+// A RequestCookieJar is a CookieJar that chooses cookies by the whole
+// request rather than its URL alone, so that it can apply rules like
+// SameSite that depend on where a request comes from. The Client uses
+// these methods instead of Cookies and SetCookies when its Jar has
+// them.
+type RequestCookieJar interface {
+	CookieJar
+
+	// RequestCookies returns the cookies to send in req. The
+	// CookieSite in req's context, if any, describes where req is
+	// made from.
+	RequestCookies(req *Request) []*Cookie
+
+	// SetRequestCookies handles the receipt of the cookies in a reply
+	// to req.
+	SetRequestCookies(req *Request, cookies []*Cookie)
+}
+
+// A CookieSite describes the browsing context a request is made from,
+// for the rules of RFC 6265bis that depend on it: which SameSite
+// cookies are sent and accepted, and which partition Partitioned
+// cookies belong to. A request without a CookieSite is treated as a
+// same-site top-level navigation, like one typed in the address bar.
+type CookieSite struct {
+	// TopLevel is the URL of the top-level document the request is
+	// made for, which decides the partition of Partitioned cookies.
+	// For a subresource or a frame it is the page's URL. Nil means the
+	// request is for the top-level document itself.
+	TopLevel *url.URL
+
+	// Initiator is the URL of the document that made the request,
+	// such as the page with the link followed or the form submitted.
+	// Nil means the user made the request directly.
+	Initiator *url.URL
+
+	// Navigation reports whether the request loads a top-level
+	// document. Cross-site navigations with a safe method still carry
+	// SameSite=Lax cookies and may set them.
+	Navigation bool
+
+	// PublicSuffixList, if non-nil, tells sites apart by registrable
+	// domain for BrowserRedirectHeaders, so that www.example.com and
+	// api.example.com are same-site. If nil, different hosts are
+	// cross-site. Cookie jars use their own list.
+	PublicSuffixList PublicSuffixList
+}
+
+// A PublicSuffixList provides the public suffix of a domain, such as
+// "co.uk" for "www.example.co.uk". It is a subset of
+// cookiejar.PublicSuffixList, so golang.org/x/net/publicsuffix.List
+// implements it.
+type PublicSuffixList interface {
+	PublicSuffix(domain string) string
+}
+
+var cookieSiteContextKey = &contextKey{"cookie-site"}
+
+// WithCookieSite returns a copy of ctx carrying site, which the
+// Client's RequestCookieJar uses for requests made with it.
+func WithCookieSite(ctx context.Context, site CookieSite) context.Context {
+	return context.WithValue(ctx, cookieSiteContextKey, site)
+}
+
+// CookieSiteFromContext returns the CookieSite stored in ctx by
+// WithCookieSite, if any.
+func CookieSiteFromContext(ctx context.Context) (CookieSite, bool) {
+	site, ok := ctx.Value(cookieSiteContextKey).(CookieSite)
+	return site, ok
+}
+
+// A CookieMerge is a policy for combining the cookies from a Client's
+// Jar with those in a Cookie header already set on a request. Either
+// way, the Client sends all of them in a single Cookie header, which
+// HTTP/2 then splits into one field per cookie.
+type CookieMerge struct {
+	// Order is the order of the cookies in the merged header.
+	Order CookieOrder
+
+	// Dedup sends only the first cookie of each name, in Order, so
+	// that with CookieOrderJarFirst the jar's cookie wins.
+	Dedup bool
+}
+
+// A CookieOrder orders the cookies of a request's own Cookie header
+// and the cookies from a Jar. The Jar's cookies keep the order it
+// gives them, which for the cookiejar package is the order of RFC 6265
+// browsers use: longest path first, then oldest first.
+type CookieOrder int
+
+const (
+	// CookieOrderRequestFirst puts the request's own cookies before
+	// the Jar's. It is the default.
+	CookieOrderRequestFirst CookieOrder = iota
+
+	// CookieOrderJarFirst puts the Jar's cookies before the request's
+	// own.
+	CookieOrderJarFirst
+
+	// CookieOrderBrowser orders all the cookies as a browser would
+	// if the request's own cookies were in its store with path "/",
+	// set before any in the Jar: after the Jar's cookies with longer
+	// paths, and before those with path "/". It needs a Jar that
+	// returns cookies with their Path, as the cookiejar package does.
+	CookieOrderBrowser
+)
+
+// mergeCookies adds cookies, from a Jar, to the Cookie header of req
+// according to m.
+func (m CookieMerge) mergeCookies(req *Request, cookies []*Cookie) {
+	if len(cookies) == 0 && !m.Dedup {
+		return
+	}
+
+	// The request's own cookies may be in several Cookie header
+	// fields, spelled differently to control their case.
+	var keys []string
+	for k := range req.Header {
+		if strings.EqualFold(k, "Cookie") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	key := "Cookie"
+	if len(keys) > 0 {
+		key = keys[0]
+	}
+
+	type pair struct {
+		name, text string
+		pathLen    int
+	}
+	var own, jar []pair
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			for _, p := range strings.Split(v, ";") {
+				if p = textproto.TrimString(p); p == "" {
+					continue
+				}
+				name := p
+				if i := strings.Index(p, "="); i >= 0 {
+					name = p[:i]
+				}
+				own = append(own, pair{name, p, 1})
+			}
+		}
+	}
+	for _, c := range cookies {
+		name := sanitizeCookieName(c.Name)
+		pathLen := len(c.Path)
+		if pathLen == 0 {
+			pathLen = 1
+		}
+		jar = append(jar, pair{name, name + "=" + sanitizeCookieValue(c.Value), pathLen})
+	}
+
+	var all []pair
+	switch m.Order {
+	case CookieOrderJarFirst:
+		all = append(jar, own...)
+	case CookieOrderBrowser:
+		all = append(own, jar...)
+		sort.SliceStable(all, func(i, j int) bool {
+			return all[i].pathLen > all[j].pathLen
+		})
+	default:
+		all = append(own, jar...)
+	}
+
+	seen := make(map[string]bool)
+	texts := make([]string, 0, len(all))
+	for _, p := range all {
+		if m.Dedup {
+			if seen[p.name] {
+				continue
+			}
+			seen[p.name] = true
+		}
+		texts = append(texts, p.text)
+	}
+
+	if req.Header == nil {
+		req.Header = make(Header)
+	}
+	for _, k := range keys {
+		delete(req.Header, k)
+	}
+	if len(texts) > 0 {
+		req.Header[key] = []string{strings.Join(texts, "; ")}
+	}
+}
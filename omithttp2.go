@@ -47,6 +47,8 @@ type http2clientConnPool struct {
 
 func http2configureTransports(*Transport) (*http2Transport, error) { panic(noHTTP2) }
 
+func http2configureTransportsALPN(*Transport, bool) (*http2Transport, error) { panic(noHTTP2) }
+
 func http2isNoCachedConnError(err error) bool {
 	_, ok := err.(interface{ IsHTTP2NoCachedConnError() })
 	return ok
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"context"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// A StreamPriority is the RFC 7540 priority of an HTTP/2 request stream,
+// sent in the priority fields of the stream's HEADERS frame.
+type StreamPriority struct {
+	// StreamDep is the stream this stream depends on. Zero means
+	// the root of the dependency tree.
+	StreamDep uint32
+
+	// Exclusive is whether the dependency is exclusive.
+	Exclusive bool
+
+	// Weight is the zero-indexed weight, as on the wire: add one
+	// to obtain a weight between 1 and 256.
+	Weight uint8
+}
+
+var streamPriorityContextKey = &contextKey{"stream-priority"}
+
+// WithStreamPriority returns a copy of ctx carrying p. HTTP/2 requests
+// made with the returned context send p in their HEADERS frame,
+// taking precedence over the HeaderPriority of the Transport's
+// ClientProfile. The zero StreamPriority is sent too, as a dependency
+// on the root with weight 1.
+func WithStreamPriority(ctx context.Context, p StreamPriority) context.Context {
+	return context.WithValue(ctx, streamPriorityContextKey, p)
+}
+
+// StreamPriorityFromContext returns the StreamPriority stored in ctx by
+// WithStreamPriority, if any.
+func StreamPriorityFromContext(ctx context.Context) (p StreamPriority, ok bool) {
+	p, ok = ctx.Value(streamPriorityContextKey).(StreamPriority)
+	return p, ok
+}
+
+// An ExtensiblePriority is an RFC 9218 extensible priority, as carried
+// by the "priority" header field and the HTTP/2 PRIORITY_UPDATE frame.
+type ExtensiblePriority struct {
+	// Urgency is the urgency level, from 0 (highest) to 7 (lowest).
+	// The default is 3.
+	Urgency uint8
+
+	// Incremental is whether the response can be processed
+	// incrementally, so that it can share bandwidth with other
+	// responses of the same urgency.
+	Incremental bool
+}
+
+// DefaultExtensiblePriority is the priority of requests that don't
+// specify one.
+var DefaultExtensiblePriority = ExtensiblePriority{Urgency: 3}
+
+// ParseExtensiblePriority parses a "priority" header field value such
+// as "u=0, i". Unknown parameters and invalid values are ignored, as
+// RFC 9218 requires, so the defaults are kept for them.
+func ParseExtensiblePriority(v string) ExtensiblePriority {
+	p := DefaultExtensiblePriority
+	for _, member := range strings.Split(v, ",") {
+		if i := strings.IndexByte(member, ';'); i >= 0 {
+			member = member[:i] // parameters of members are ignored
+		}
+		key, val := textproto.TrimString(member), ""
+		if i := strings.IndexByte(key, '='); i >= 0 {
+			key, val = textproto.TrimString(key[:i]), textproto.TrimString(key[i+1:])
+		}
+		switch key {
+		case "u":
+			if u, err := strconv.Atoi(val); err == nil && u >= 0 && u <= 7 {
+				p.Urgency = uint8(u)
+			}
+		case "i":
+			switch val {
+			case "", "?1":
+				p.Incremental = true
+			case "?0":
+				p.Incremental = false
+			}
+		}
+	}
+	return p
+}
+
+// String returns p as a "priority" header field value. Parameters that
+// have their default value are left out. Urgencies above 7 are written
+// as 7.
+func (p ExtensiblePriority) String() string {
+	var parts []string
+	u := p.Urgency
+	if u > 7 {
+		u = 7
+	}
+	if u != DefaultExtensiblePriority.Urgency {
+		parts = append(parts, "u="+strconv.Itoa(int(u)))
+	}
+	if p.Incremental {
+		parts = append(parts, "i")
+	}
+	return strings.Join(parts, ", ")
+}
+
+var (
+	extensiblePriorityContextKey = &contextKey{"extensible-priority"}
+	priorityUpdateContextKey     = &contextKey{"priority-update"}
+)
+
+// WithExtensiblePriority returns a copy of ctx carrying p. HTTP/2
+// requests made with the returned context send p in a "priority"
+// header, unless the request already sets that header.
+func WithExtensiblePriority(ctx context.Context, p ExtensiblePriority) context.Context {
+	return context.WithValue(ctx, extensiblePriorityContextKey, p)
+}
+
+// ExtensiblePriorityFromContext returns the ExtensiblePriority stored
+// in ctx by WithExtensiblePriority, if any.
+func ExtensiblePriorityFromContext(ctx context.Context) (p ExtensiblePriority, ok bool) {
+	p, ok = ctx.Value(extensiblePriorityContextKey).(ExtensiblePriority)
+	return p, ok
+}
+
+// WithPriorityUpdate returns a copy of ctx carrying p. HTTP/2 requests
+// made with the returned context send p in a PRIORITY_UPDATE frame
+// right after their HEADERS frame.
+func WithPriorityUpdate(ctx context.Context, p ExtensiblePriority) context.Context {
+	return context.WithValue(ctx, priorityUpdateContextKey, p)
+}
+
+// PriorityUpdateFromContext returns the ExtensiblePriority stored in
+// ctx by WithPriorityUpdate, if any.
+func PriorityUpdateFromContext(ctx context.Context) (p ExtensiblePriority, ok bool) {
+	p, ok = ctx.Value(priorityUpdateContextKey).(ExtensiblePriority)
+	return p, ok
+}
@@ -0,0 +1,41 @@
+package http
+
+import "testing"
+
+func TestParseExtensiblePriority(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ExtensiblePriority
+	}{
+		{"", ExtensiblePriority{Urgency: 3}},
+		{"u=0", ExtensiblePriority{Urgency: 0}},
+		{"u=5, i", ExtensiblePriority{Urgency: 5, Incremental: true}},
+		{"i=?1,u=1", ExtensiblePriority{Urgency: 1, Incremental: true}},
+		{"i, i=?0", ExtensiblePriority{Urgency: 3}},
+		{"u=8, i=1", ExtensiblePriority{Urgency: 3}},
+		{"u=2;foo=bar, x=y", ExtensiblePriority{Urgency: 2}},
+	}
+	for _, tt := range tests {
+		if got := ParseExtensiblePriority(tt.in); got != tt.want {
+			t.Errorf("ParseExtensiblePriority(%q) = %+v; want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExtensiblePriorityString(t *testing.T) {
+	tests := []struct {
+		p    ExtensiblePriority
+		want string
+	}{
+		{DefaultExtensiblePriority, ""},
+		{ExtensiblePriority{Urgency: 0}, "u=0"},
+		{ExtensiblePriority{Urgency: 3, Incremental: true}, "i"},
+		{ExtensiblePriority{Urgency: 1, Incremental: true}, "u=1, i"},
+		{ExtensiblePriority{Urgency: 9}, "u=7"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q; want %q", tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package http
+
+// A ClientProfile describes how a client presents itself on an HTTP/2
+// connection: the SETTINGS it announces and their order, the
+// connection-level WINDOW_UPDATE it sends after the client preface, and
+// the order in which it encodes pseudo-headers and regular headers.
+//
+// Setting Transport.ClientProfile applies the profile to every HTTP/2
+// connection made by the Transport. A request's own HeaderOrderKey and
+// PHeaderOrderKey entries take precedence over the profile's orders.
+//
+// A ClientProfile must not be modified after it is in use by a
+// Transport. The built-in profiles must never be modified; use Clone to
+// derive a custom profile from one of them.
+type ClientProfile struct {
+	// Name identifies the profile, such as "chrome131".
+	Name string
+
+	// Settings are the parameters of the initial SETTINGS frame,
+	// written exactly in this order.
+	Settings []ProfileSetting
+
+	// ConnectionFlow is the increment of the connection-level
+	// WINDOW_UPDATE frame sent after the initial SETTINGS frame.
+	// If zero, the HTTP/2 Transport's default is used. It must leave
+	// the connection window within 2^31-1, that is at most 2147418112.
+	ConnectionFlow uint32
+
+	// PriorityFrames are PRIORITY frames written after the
+	// connection-level WINDOW_UPDATE, in order.
+	PriorityFrames []ProfilePriority
+
+	// HeaderPriority, if non-nil, is the priority sent in the
+	// HEADERS frame of requests that don't carry their own
+	// StreamPriority in their context.
+	HeaderPriority *StreamPriority
+
+	// PHeaderOrder is the pseudo-header order used when a request
+	// has no PHeaderOrderKey entry.
+	PHeaderOrder []string
+
+	// HeaderOrder is the lowercase header order used when a
+	// request has no HeaderOrderKey entry.
+	HeaderOrder []string
+}
+
+// A ProfileSetting is a single HTTP/2 SETTINGS parameter. ID is the
+// setting identifier as defined in RFC 7540, Section 6.5.2, and has the
+// same values as the http2 package's SettingID constants.
+type ProfileSetting struct {
+	ID  uint16
+	Val uint32
+}
+
+// A ProfilePriority is an HTTP/2 PRIORITY frame sent as part of the
+// connection preface, usually to add an idle stream to the dependency
+// tree. Weight is zero-indexed, as on the wire.
+type ProfilePriority struct {
+	StreamID  uint32
+	StreamDep uint32
+	Exclusive bool
+	Weight    uint8
+}
+
+// HTTP/2 setting identifiers used by the built-in profiles.
+const (
+	profileHeaderTableSize      uint16 = 0x1
+	profileEnablePush           uint16 = 0x2
+	profileMaxConcurrentStreams uint16 = 0x3
+	profileInitialWindowSize    uint16 = 0x4
+	profileMaxFrameSize         uint16 = 0x5
+	profileMaxHeaderListSize    uint16 = 0x6
+	profileNoRFC7540Priorities  uint16 = 0x9
+)
+
+// Clone returns a deep copy of p.
+func (p *ClientProfile) Clone() *ClientProfile {
+	if p == nil {
+		return nil
+	}
+	p2 := *p
+	p2.Settings = append([]ProfileSetting(nil), p.Settings...)
+	p2.PriorityFrames = append([]ProfilePriority(nil), p.PriorityFrames...)
+	p2.PHeaderOrder = append([]string(nil), p.PHeaderOrder...)
+	p2.HeaderOrder = append([]string(nil), p.HeaderOrder...)
+	if p.HeaderPriority != nil {
+		hp := *p.HeaderPriority
+		p2.HeaderPriority = &hp
+	}
+	return &p2
+}
+
+// ProfileChrome131 is the HTTP/2 profile of Chrome 131 on desktop.
+var ProfileChrome131 = &ClientProfile{
+	Name: "chrome131",
+	Settings: []ProfileSetting{
+		{ID: profileHeaderTableSize, Val: 65536},
+		{ID: profileEnablePush, Val: 0},
+		{ID: profileInitialWindowSize, Val: 6291456},
+		{ID: profileMaxHeaderListSize, Val: 262144},
+	},
+	ConnectionFlow: 15663105,
+	HeaderPriority: &StreamPriority{Exclusive: true, Weight: 255},
+	PHeaderOrder:   []string{":method", ":authority", ":scheme", ":path"},
+	HeaderOrder: []string{
+		"content-length",
+		"cache-control",
+		"sec-ch-ua-platform",
+		"sec-ch-ua",
+		"sec-ch-ua-mobile",
+		"origin",
+		"content-type",
+		"upgrade-insecure-requests",
+		"user-agent",
+		"accept",
+		"sec-fetch-site",
+		"sec-fetch-mode",
+		"sec-fetch-user",
+		"sec-fetch-dest",
+		"referer",
+		"accept-encoding",
+		"accept-language",
+		"cookie",
+		"priority",
+	},
+}
+
+// ProfileFirefox133 is the HTTP/2 profile of Firefox 133 on desktop.
+var ProfileFirefox133 = &ClientProfile{
+	Name: "firefox133",
+	Settings: []ProfileSetting{
+		{ID: profileHeaderTableSize, Val: 65536},
+		{ID: profileEnablePush, Val: 0},
+		{ID: profileInitialWindowSize, Val: 131072},
+		{ID: profileMaxFrameSize, Val: 16384},
+	},
+	ConnectionFlow: 12517377,
+	HeaderPriority: &StreamPriority{Weight: 41},
+	PHeaderOrder:   []string{":method", ":path", ":authority", ":scheme"},
+	HeaderOrder: []string{
+		"user-agent",
+		"accept",
+		"accept-language",
+		"accept-encoding",
+		"content-type",
+		"content-length",
+		"origin",
+		"referer",
+		"cookie",
+		"upgrade-insecure-requests",
+		"sec-fetch-dest",
+		"sec-fetch-mode",
+		"sec-fetch-site",
+		"sec-fetch-user",
+		"priority",
+		"te",
+	},
+}
+
+// ProfileSafari18 is the HTTP/2 profile of Safari 18 on macOS.
+var ProfileSafari18 = &ClientProfile{
+	Name: "safari18",
+	Settings: []ProfileSetting{
+		{ID: profileEnablePush, Val: 0},
+		{ID: profileMaxConcurrentStreams, Val: 100},
+		{ID: profileInitialWindowSize, Val: 2097152},
+		{ID: profileNoRFC7540Priorities, Val: 1},
+	},
+	ConnectionFlow: 10420225,
+	PHeaderOrder:   []string{":method", ":scheme", ":authority", ":path"},
+	HeaderOrder: []string{
+		"content-type",
+		"accept",
+		"sec-fetch-site",
+		"origin",
+		"cookie",
+		"sec-fetch-dest",
+		"content-length",
+		"accept-language",
+		"sec-fetch-mode",
+		"user-agent",
+		"referer",
+		"accept-encoding",
+		"priority",
+	},
+}
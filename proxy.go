@@ -0,0 +1,745 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A ProxyDialer dials connections through a proxy, the way Transport
+// does when its Proxy function returns a URL. It lets transports that
+// dial for themselves, such as http2.Transport, share that logic.
+type ProxyDialer struct {
+	// ProxyURL is the proxy to connect through. The "http" and
+	// "https" schemes open a tunnel with a CONNECT request; "https"
+	// first sets up TLS with the proxy. The "socks4", "socks4a",
+	// "socks5" and "socks5h" schemes use SOCKS, as for
+	// Transport.Proxy. User info in the URL is sent as Basic
+	// Proxy-Authorization for CONNECT, as SOCKS5 username and
+	// password, or its username as SOCKS4 user ID.
+	ProxyURL *url.URL
+
+	// ConnectHeader optionally specifies headers to send with
+	// CONNECT requests. HeaderOrderKey orders them as for Transport's
+	// ProxyConnectHeader.
+	ConnectHeader Header
+
+	// DialProxy optionally specifies the dial function for the TCP
+	// connection to the proxy. If nil, a net.Dialer is used.
+	DialProxy func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// TLSClientConfig optionally specifies the TLS configuration for
+	// connections to "https" proxies. The proxy's host name is used
+	// as ServerName if the config has none.
+	TLSClientConfig *tls.Config
+}
+
+// DialContext connects to the proxy and asks it to connect to addr.
+// The returned connection carries the bytes to and from addr. Only the
+// "tcp" network is supported.
+func (d *ProxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" {
+		return nil, fmt.Errorf("net/http: ProxyDialer: unsupported network %q", network)
+	}
+	if d.ProxyURL == nil {
+		return nil, errors.New("net/http: ProxyDialer: nil ProxyURL")
+	}
+	switch d.ProxyURL.Scheme {
+	case "http", "https", "socks4", "socks4a", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("net/http: ProxyDialer: unsupported proxy scheme %q", d.ProxyURL.Scheme)
+	}
+
+	dial := d.DialProxy
+	if dial == nil {
+		dial = zeroDialer.DialContext
+	}
+	conn, err := dial(ctx, "tcp", canonicalAddr(d.ProxyURL))
+	if err != nil {
+		return nil, err
+	}
+	if isSOCKSScheme(d.ProxyURL.Scheme) {
+		if err := socksConnect(ctx, conn, d.ProxyURL, addr); err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	if d.ProxyURL.Scheme == "https" {
+		cfg := cloneTLSConfig(d.TLSClientConfig)
+		if cfg.ServerName == "" {
+			cfg.ServerName = d.ProxyURL.Hostname()
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := handshakeContext(ctx, tlsConn); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	hdr := d.ConnectHeader
+	if pa := proxyAuthorization(d.ProxyURL); pa != "" {
+		hdr = hdr.Clone()
+		if hdr == nil {
+			hdr = make(Header)
+		}
+		hdr.Set("Proxy-Authorization", pa)
+	}
+	if err := httpConnect(ctx, conn, addr, hdr); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// proxyAuthorization returns the Proxy-Authorization header to send
+// for the user info of proxyURL, or "" if it has none.
+func proxyAuthorization(proxyURL *url.URL) string {
+	if u := proxyURL.User; u != nil {
+		username := u.Username()
+		password, _ := u.Password()
+		return "Basic " + basicAuth(username, password)
+	}
+	return ""
+}
+
+// handshakeContext runs the TLS handshake of conn, closing conn if ctx
+// is done first or the handshake fails.
+func handshakeContext(ctx context.Context, conn TLSConn) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- conn.Handshake()
+	}()
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		conn.Close()
+		<-errc
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+	}
+	return err
+}
+
+// isSOCKSScheme reports whether scheme names a SOCKS proxy.
+func isSOCKSScheme(scheme string) bool {
+	switch scheme {
+	case "socks4", "socks4a", "socks5", "socks5h":
+		return true
+	}
+	return false
+}
+
+// socksConnect asks the SOCKS proxy at the other end of conn to
+// connect to addr, with the protocol version of proxyURL's scheme. The
+// "socks4" and "socks5" schemes resolve host names locally, and
+// "socks4a" and "socks5h" have the proxy resolve them. It closes conn
+// on failure.
+func socksConnect(ctx context.Context, conn net.Conn, proxyURL *url.URL, addr string) error {
+	var err error
+	switch proxyURL.Scheme {
+	case "socks4", "socks5":
+		addr, err = resolveSOCKSAddr(ctx, addr, proxyURL.Scheme == "socks4")
+	}
+	if err == nil {
+		switch proxyURL.Scheme {
+		case "socks4", "socks4a":
+			var userID string
+			if u := proxyURL.User; u != nil {
+				userID = u.Username()
+			}
+			err = socks4Connect(ctx, conn, addr, userID, proxyURL.Scheme == "socks4a")
+		default:
+			err = socks5Connect(ctx, conn, proxyURL, addr)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+// resolveSOCKSAddr replaces the host name in addr with one of its IP
+// addresses, or an IPv4 address if ipv4 is set.
+func resolveSOCKSAddr(ctx context.Context, addr string, ipv4 bool) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	for _, ip := range ips {
+		if !ipv4 || ip.IP.To4() != nil {
+			return net.JoinHostPort(ip.IP.String(), port), nil
+		}
+	}
+	return "", &net.DNSError{Err: "no IPv4 address", Name: host}
+}
+
+func socks5Connect(ctx context.Context, conn net.Conn, proxyURL *url.URL, addr string) error {
+	d := socksNewDialer("tcp", conn.RemoteAddr().String())
+	if u := proxyURL.User; u != nil {
+		auth := &socksUsernamePassword{
+			Username: u.Username(),
+		}
+		auth.Password, _ = u.Password()
+		d.AuthMethods = []socksAuthMethod{
+			socksAuthMethodNotRequired,
+			socksAuthMethodUsernamePassword,
+		}
+		d.Authenticate = auth.Authenticate
+	}
+	_, err := d.DialWithConn(ctx, conn, "tcp", addr)
+	return err
+}
+
+// httpConnect asks the HTTP proxy at the other end of conn to open a
+// tunnel to addr, sending hdr with the CONNECT request. It closes conn
+// on failure.
+func httpConnect(ctx context.Context, conn net.Conn, addr string, hdr Header) error {
+	// Writing the request adds Host and User-Agent to its Header,
+	// which mustn't change hdr.
+	hdr = hdr.Clone()
+	if hdr == nil {
+		hdr = make(Header)
+	}
+	_, ordered := hdr[HeaderOrderKey]
+	connectReq := &Request{
+		Method:             "CONNECT",
+		URL:                &url.URL{Opaque: addr},
+		Host:               addr,
+		Header:             hdr,
+		PreserveHeaderCase: ordered,
+	}
+
+	// If there's no done channel (no deadline or cancellation
+	// from the caller possible), at least set some (long)
+	// timeout here. This will make sure we don't block forever
+	// and leak a goroutine if the connection stops replying
+	// after the TCP connect.
+	connectCtx := ctx
+	if ctx.Done() == nil {
+		newCtx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+		defer cancel()
+		connectCtx = newCtx
+	}
+
+	didReadResponse := make(chan struct{}) // closed after CONNECT write+read is done or fails
+	var (
+		resp *Response
+		err  error // write or read error
+	)
+	// Write the CONNECT request & read the response.
+	go func() {
+		defer close(didReadResponse)
+		err = connectReq.Write(conn)
+		if err != nil {
+			return
+		}
+		// Okay to use and discard buffered reader here, because
+		// TLS server will not speak until spoken to.
+		br := bufio.NewReader(conn)
+		resp, err = ReadResponse(br, connectReq)
+		if err == nil && resp.StatusCode != 200 {
+			err = newProxyConnectError(resp)
+		}
+	}()
+	select {
+	case <-connectCtx.Done():
+		conn.Close()
+		<-didReadResponse
+		return connectCtx.Err()
+	case <-didReadResponse:
+		// resp or err now set
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+// maxProxyConnectErrorBody is the most of a failed CONNECT response's
+// body that a ProxyConnectError keeps.
+const maxProxyConnectErrorBody = 4 << 10
+
+// A ProxyConnectError is returned when a proxy answers a CONNECT
+// request with a status other than 200. Its Error method returns the
+// status text, such as "Proxy Authentication Required".
+type ProxyConnectError struct {
+	StatusCode int    // e.g. 407
+	Status     string // e.g. "407 Proxy Authentication Required"
+	Header     Header
+
+	// Body is the start of the response body, up to 4 KB.
+	Body []byte
+}
+
+// newProxyConnectError returns the error for the failed CONNECT
+// response resp, reading the start of its body and closing it.
+func newProxyConnectError(resp *Response) *ProxyConnectError {
+	e := &ProxyConnectError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+	}
+	if resp.Body != nil {
+		e.Body, _ = io.ReadAll(io.LimitReader(resp.Body, maxProxyConnectErrorBody))
+		resp.Body.Close()
+	}
+	return e
+}
+
+func (e *ProxyConnectError) Error() string {
+	f := strings.SplitN(e.Status, " ", 2)
+	if len(f) < 2 {
+		return "unknown status code"
+	}
+	return f[1]
+}
+
+// proxyConnectHeader returns the headers to send with the CONNECT
+// request for cm.
+func (t *Transport) proxyConnectHeader(ctx context.Context, cm connectMethod) (Header, error) {
+	var hdr Header
+	if t.GetProxyConnectHeader != nil {
+		var err error
+		hdr, err = t.GetProxyConnectHeader(ctx, cm.proxyURL, cm.targetAddr)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		hdr = t.ProxyConnectHeader
+	}
+	if hdr == nil {
+		hdr = make(Header)
+	}
+	if pa := cm.proxyAuth(); pa != "" {
+		hdr = hdr.Clone()
+		hdr.Set("Proxy-Authorization", pa)
+	}
+	return hdr, nil
+}
+
+// proxyNextProtos returns the ALPN protocols to offer to the proxy of
+// cm, or nil if the first hop isn't a TLS connection to a proxy.
+func (t *Transport) proxyNextProtos(cm connectMethod) []string {
+	if cm.proxyURL == nil || cm.proxyURL.Scheme != "https" {
+		return nil
+	}
+	if t.ProxyHTTP2 && cm.targetScheme == "https" {
+		return []string{"h2", "http/1.1"}
+	}
+	// The proxy must not pick the protocols offered to targets:
+	// the request or CONNECT request it gets is HTTP/1.1.
+	return []string{"http/1.1"}
+}
+
+// errNoProxyH2Conn is returned by proxyH2Tunnel when there is no HTTP/2
+// connection to the proxy to open the tunnel on.
+var errNoProxyH2Conn = errors.New("net/http: no HTTP/2 connection to proxy")
+
+// proxyH2Tunnel opens a tunnel to the target of cm as a CONNECT
+// request on an HTTP/2 connection to its proxy. If c is non-nil, it is
+// a new connection to the proxy that negotiated HTTP/2; it's added to
+// the pool of such connections, or closed if the pool already has one
+// that can take the tunnel. If c is nil and the pool has no usable
+// connection, or cm isn't a tunnel through an "https" proxy with
+// ProxyHTTP2 set, proxyH2Tunnel returns errNoProxyH2Conn.
+func (t *Transport) proxyH2Tunnel(ctx context.Context, cm connectMethod, c TLSConn) (net.Conn, error) {
+	if c == nil && (!t.ProxyHTTP2 || cm.proxyURL == nil || cm.proxyURL.Scheme != "https" || cm.targetScheme != "https") {
+		return nil, errNoProxyH2Conn
+	}
+	t.proxyH2Once.Do(func() {
+		pool := new(http2clientConnPool)
+		t.proxyH2 = &http2Transport{
+			ConnPool:           http2noDialClientConnPool{pool},
+			DisableCompression: true,
+			t1:                 t,
+		}
+		pool.t = t.proxyH2
+	})
+	pool := t.proxyH2.ConnPool.(http2noDialClientConnPool)
+	key := cm.addr()
+	if c != nil {
+		used, err := pool.addConnIfNeeded(key, t.proxyH2, c)
+		if err != nil || !used {
+			c.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hdr, err := t.proxyConnectHeader(ctx, cm)
+	if err != nil {
+		return nil, err
+	}
+	// The stream outlives ctx, which is only for the dial, so it
+	// gets its own context, canceled when the tunnel is closed.
+	streamCtx, cancel := context.WithCancel(context.Background())
+	out := newTunnelPipe()
+	req := (&Request{
+		Method:        "CONNECT",
+		URL:           &url.URL{Host: cm.targetAddr},
+		Host:          cm.targetAddr,
+		Header:        hdr,
+		Body:          out,
+		ContentLength: -1,
+	}).WithContext(streamCtx)
+	cc, err := pool.GetClientConn(req, key)
+	if err != nil {
+		cancel()
+		if err == http2ErrNoCachedConn {
+			err = errNoProxyH2Conn
+		}
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	canceled := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+			canceled <- true
+		case <-stop:
+			canceled <- false
+		}
+	}()
+	resp, err := cc.RoundTrip(req)
+	if err == nil && resp.StatusCode != 200 {
+		err = newProxyConnectError(resp)
+	}
+	close(stop)
+	if <-canceled {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return newH2TunnelConn(resp.Body, out, cancel, cc.tconn.LocalAddr(), cc.tconn.RemoteAddr()), nil
+}
+
+// h2TunnelConn is a CONNECT tunnel carried by an HTTP/2 stream to a
+// proxy. A blocked stream read or write can't be interrupted, so the
+// tunnel goes through buffers, and deadlines only interrupt waiting
+// on those: the stream is left open, and Reads and Writes work again
+// once the deadline is extended or cleared.
+type h2TunnelConn struct {
+	body   io.ReadCloser      // data from the target, copied into in
+	in     *tunnelPipe        // data from the target
+	out    *tunnelPipe        // data to the target; the request body
+	cancel context.CancelFunc // resets the stream
+	local  net.Addr
+	remote net.Addr
+
+	readDeadline  tunnelDeadline
+	writeDeadline tunnelDeadline
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newH2TunnelConn(body io.ReadCloser, out *tunnelPipe, cancel context.CancelFunc, local, remote net.Addr) *h2TunnelConn {
+	c := &h2TunnelConn{
+		body:          body,
+		in:            newTunnelPipe(),
+		out:           out,
+		cancel:        cancel,
+		local:         local,
+		remote:        remote,
+		readDeadline:  makeTunnelDeadline(),
+		writeDeadline: makeTunnelDeadline(),
+		closed:        make(chan struct{}),
+	}
+	go c.copyBody()
+	return c
+}
+
+// copyBody copies the response body into c.in until either fails.
+func (c *h2TunnelConn) copyBody() {
+	buf := make([]byte, tunnelPipeSize)
+	for {
+		n, err := c.body.Read(buf)
+		if n > 0 {
+			if _, err := c.in.write(buf[:n], nil); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			c.in.closeWrite(err)
+			return
+		}
+	}
+}
+
+func (c *h2TunnelConn) Read(p []byte) (int, error) {
+	n, err := c.in.read(p, c.readDeadline.wait())
+	if err != nil && isClosedChan(c.closed) {
+		err = net.ErrClosed
+	}
+	return n, err
+}
+
+func (c *h2TunnelConn) Write(p []byte) (int, error) {
+	n, err := c.out.write(p, c.writeDeadline.wait())
+	if err != nil && isClosedChan(c.closed) {
+		err = net.ErrClosed
+	}
+	return n, err
+}
+
+func (c *h2TunnelConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.readDeadline.set(time.Time{})
+		c.writeDeadline.set(time.Time{})
+		c.out.closeWrite(io.EOF)
+		c.in.closeRead(net.ErrClosed)
+		c.body.Close()
+		c.cancel()
+	})
+	return nil
+}
+
+func (c *h2TunnelConn) LocalAddr() net.Addr  { return c.local }
+func (c *h2TunnelConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *h2TunnelConn) SetDeadline(t time.Time) error {
+	if isClosedChan(c.closed) {
+		return net.ErrClosed
+	}
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *h2TunnelConn) SetReadDeadline(t time.Time) error {
+	if isClosedChan(c.closed) {
+		return net.ErrClosed
+	}
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *h2TunnelConn) SetWriteDeadline(t time.Time) error {
+	if isClosedChan(c.closed) {
+		return net.ErrClosed
+	}
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// tunnelPipeSize is the most data a tunnelPipe buffers.
+const tunnelPipeSize = 32 << 10
+
+// A tunnelPipe is a buffered pipe whose reads and writes wait until a
+// deadline at most. Its Read and Close methods are the reading end
+// without a deadline, for use as a request body.
+type tunnelPipe struct {
+	mu     sync.Mutex
+	buf    []byte
+	rerr   error         // returned by reads once buf is drained
+	werr   error         // returned by writes
+	change chan struct{} // closed and replaced when the above change
+}
+
+func newTunnelPipe() *tunnelPipe {
+	return &tunnelPipe{change: make(chan struct{})}
+}
+
+// requires p.mu be held
+func (p *tunnelPipe) changedLocked() {
+	close(p.change)
+	p.change = make(chan struct{})
+}
+
+// read reads buffered data into b, waiting for some until deadline is
+// closed. A nil deadline waits indefinitely.
+func (p *tunnelPipe) read(b []byte, deadline <-chan struct{}) (int, error) {
+	if isClosedChan(deadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	for {
+		p.mu.Lock()
+		if len(p.buf) > 0 {
+			n := copy(b, p.buf)
+			p.buf = p.buf[n:]
+			p.changedLocked()
+			p.mu.Unlock()
+			return n, nil
+		}
+		if err := p.rerr; err != nil {
+			p.mu.Unlock()
+			return 0, err
+		}
+		change := p.change
+		p.mu.Unlock()
+		select {
+		case <-change:
+		case <-deadline:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// write buffers b, waiting for room until deadline is closed. A nil
+// deadline waits indefinitely.
+func (p *tunnelPipe) write(b []byte, deadline <-chan struct{}) (n int, err error) {
+	if isClosedChan(deadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	for {
+		p.mu.Lock()
+		if err := p.werr; err != nil {
+			p.mu.Unlock()
+			return n, err
+		}
+		if len(b) == 0 {
+			p.mu.Unlock()
+			return n, nil
+		}
+		if room := tunnelPipeSize - len(p.buf); room > 0 {
+			if room > len(b) {
+				room = len(b)
+			}
+			p.buf = append(p.buf, b[:room]...)
+			b = b[room:]
+			n += room
+			p.changedLocked()
+			p.mu.Unlock()
+			continue
+		}
+		change := p.change
+		p.mu.Unlock()
+		select {
+		case <-change:
+		case <-deadline:
+			return n, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// closeWrite makes reads return err once the buffered data is read,
+// and later writes fail.
+func (p *tunnelPipe) closeWrite(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rerr == nil {
+		p.rerr = err
+	}
+	if p.werr == nil {
+		p.werr = io.ErrClosedPipe
+	}
+	p.changedLocked()
+}
+
+// closeRead drops the buffered data and makes writes return err and
+// later reads fail.
+func (p *tunnelPipe) closeRead(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = nil
+	if p.werr == nil {
+		p.werr = err
+	}
+	if p.rerr == nil {
+		p.rerr = io.ErrClosedPipe
+	}
+	p.changedLocked()
+}
+
+func (p *tunnelPipe) Read(b []byte) (int, error) { return p.read(b, nil) }
+
+func (p *tunnelPipe) Close() error {
+	p.closeRead(io.ErrClosedPipe)
+	return nil
+}
+
+// tunnelDeadline is a deadline for a tunnelPipe wait, as for the
+// net.Pipe implementation.
+type tunnelDeadline struct {
+	mu     sync.Mutex // guards timer and cancel
+	timer  *time.Timer
+	cancel chan struct{} // must be non-nil
+}
+
+func makeTunnelDeadline() tunnelDeadline {
+	return tunnelDeadline{cancel: make(chan struct{})}
+}
+
+// set sets the point in time when the deadline will time out. A
+// timeout event is signaled by closing the channel returned by wait.
+// Once a timeout has occurred, the deadline can be refreshed by
+// specifying a t value in the future. A zero t disables the deadline.
+func (d *tunnelDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait for the timer callback to finish and close cancel
+	}
+	d.timer = nil
+
+	// Time is zero, then there is no deadline.
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	// Time in the future, setup a timer to cancel in the future.
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		d.timer = time.AfterFunc(dur, func() {
+			close(d.cancel)
+		})
+		return
+	}
+
+	// Time in the past, so close immediately.
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline is exceeded.
+func (d *tunnelDeadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -5,9 +5,14 @@
 package http
 
 import (
+	"context"
+	"io"
+	"net"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TODO(mattn):
@@ -48,3 +53,134 @@ func ResetProxyEnv() {
 	}
 	ResetCachedEnvironment()
 }
+
+func TestSOCKS4ConnectRejected(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+	go func() {
+		// VN, CD, DSTPORT, DSTIP, "u" and NUL.
+		io.ReadFull(s, make([]byte, 10))
+		s.Write([]byte{0, 0x5b, 0, 0, 0, 0, 0, 0})
+	}()
+	err := socks4Connect(context.Background(), c, "127.0.0.1:80", "u", false)
+	if err == nil || !strings.Contains(err.Error(), "request rejected or failed") {
+		t.Fatalf("socks4Connect error = %v; want rejection", err)
+	}
+}
+
+func TestSOCKS4ConnectNeedsIPv4(t *testing.T) {
+	for _, addr := range []string{"[::1]:80", "example.com:80"} {
+		c, s := net.Pipe()
+		err := socks4Connect(context.Background(), c, addr, "", false)
+		if err == nil {
+			t.Errorf("socks4Connect(%q) succeeded; want error", addr)
+		}
+		c.Close()
+		s.Close()
+	}
+}
+
+func newTestH2TunnelConn() (*h2TunnelConn, *io.PipeWriter, *tunnelPipe, <-chan struct{}) {
+	bodyR, bodyW := io.Pipe()
+	out := newTunnelPipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	return newH2TunnelConn(bodyR, out, cancel, nil, nil), bodyW, out, ctx.Done()
+}
+
+func TestH2TunnelConnReadDeadline(t *testing.T) {
+	c, bodyW, _, reset := newTestH2TunnelConn()
+	defer c.Close()
+
+	// A deadline that is removed again has no effect.
+	c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	c.SetReadDeadline(time.Time{})
+	go bodyW.Write([]byte("hi"))
+	time.Sleep(20 * time.Millisecond)
+	buf := make([]byte, 2)
+	if n, err := c.Read(buf); err != nil || string(buf[:n]) != "hi" {
+		t.Fatalf("Read = %q, %v; want %q", buf[:n], err, "hi")
+	}
+
+	c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := c.Read(buf); !os.IsTimeout(err) {
+		t.Fatalf("Read error = %v; want timeout", err)
+	}
+
+	// A deadline in the past interrupts a blocked Read.
+	errc := make(chan error, 1)
+	c.SetReadDeadline(time.Time{})
+	go func() {
+		_, err := c.Read(buf)
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.SetReadDeadline(time.Now())
+	if err := <-errc; !os.IsTimeout(err) {
+		t.Fatalf("interrupted Read error = %v; want timeout", err)
+	}
+
+	// The stream stays open and works again once the deadline is
+	// cleared.
+	select {
+	case <-reset:
+		t.Fatal("stream reset after the read deadline")
+	default:
+	}
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatalf("SetReadDeadline after a timeout: %v", err)
+	}
+	go bodyW.Write([]byte("ok"))
+	if n, err := c.Read(buf); err != nil || string(buf[:n]) != "ok" {
+		t.Fatalf("Read after clearing the deadline = %q, %v; want %q", buf[:n], err, "ok")
+	}
+}
+
+func TestH2TunnelConnWriteDeadline(t *testing.T) {
+	c, _, out, reset := newTestH2TunnelConn()
+	defer c.Close()
+
+	// Nothing reads the request body, so the Write blocks once the
+	// buffer is full, until the deadline.
+	c.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	n, err := c.Write(make([]byte, tunnelPipeSize+1))
+	if !os.IsTimeout(err) {
+		t.Fatalf("Write error = %v; want timeout", err)
+	}
+	if n != tunnelPipeSize {
+		t.Errorf("Write = %d; want %d", n, tunnelPipeSize)
+	}
+	select {
+	case <-reset:
+		t.Fatal("stream reset after the write deadline")
+	default:
+	}
+
+	c.SetWriteDeadline(time.Time{})
+	go io.Copy(io.Discard, out)
+	if _, err := c.Write([]byte("x")); err != nil {
+		t.Errorf("Write after clearing the deadline: %v", err)
+	}
+}
+
+func TestH2TunnelConnClose(t *testing.T) {
+	c, _, out, reset := newTestH2TunnelConn()
+	c.Write([]byte("x"))
+	c.Close()
+	select {
+	case <-reset:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not reset by Close")
+	}
+	if b, err := io.ReadAll(out); err != nil || string(b) != "x" {
+		t.Errorf("request body = %q, %v; want %q", b, err, "x")
+	}
+	if _, err := c.Read(make([]byte, 1)); err != net.ErrClosed {
+		t.Errorf("Read after Close error = %v; want %v", err, net.ErrClosed)
+	}
+	if _, err := c.Write([]byte("x")); err != net.ErrClosed {
+		t.Errorf("Write after Close error = %v; want %v", err, net.ErrClosed)
+	}
+	if err := c.SetDeadline(time.Time{}); err != net.ErrClosed {
+		t.Errorf("SetDeadline after Close error = %v; want %v", err, net.ErrClosed)
+	}
+}
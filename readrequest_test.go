@@ -62,6 +62,17 @@ var reqTests = []reqTest{
 				"Content-Length":   {"7"},
 				"User-Agent":       {"Fake"},
 			},
+			RawHeaders: []RawHeader{
+				{"Host", "www.techcrunch.com"},
+				{"User-Agent", "Fake"},
+				{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+				{"Accept-Language", "en-us,en;q=0.5"},
+				{"Accept-Encoding", "gzip,deflate"},
+				{"Accept-Charset", "ISO-8859-1,utf-8;q=0.7,*;q=0.7"},
+				{"Keep-Alive", "300"},
+				{"Content-Length", "7"},
+				{"Proxy-Connection", "keep-alive"},
+			},
 			Close:         false,
 			ContentLength: 7,
 			Host:          "www.techcrunch.com",
@@ -84,10 +95,13 @@ var reqTests = []reqTest{
 			URL: &url.URL{
 				Path: "/",
 			},
-			Proto:         "HTTP/1.1",
-			ProtoMajor:    1,
-			ProtoMinor:    1,
-			Header:        Header{},
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     Header{},
+			RawHeaders: []RawHeader{
+				{"Host", "foo.com"},
+			},
 			Close:         false,
 			ContentLength: 0,
 			Host:          "foo.com",
@@ -110,10 +124,13 @@ var reqTests = []reqTest{
 			URL: &url.URL{
 				Path: "//user@host/is/actually/a/path/",
 			},
-			Proto:         "HTTP/1.1",
-			ProtoMajor:    1,
-			ProtoMinor:    1,
-			Header:        Header{},
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     Header{},
+			RawHeaders: []RawHeader{
+				{"Host", "test"},
+			},
 			Close:         false,
 			ContentLength: 0,
 			Host:          "test",
@@ -165,9 +182,13 @@ var reqTests = []reqTest{
 			ProtoMajor:       1,
 			ProtoMinor:       1,
 			Header:           Header{},
-			ContentLength:    -1,
-			Host:             "foo.com",
-			RequestURI:       "/",
+			RawHeaders: []RawHeader{
+				{"Host", "foo.com"},
+				{"Transfer-Encoding", "chunked"},
+			},
+			ContentLength: -1,
+			Host:          "foo.com",
+			RequestURI:    "/",
 		},
 
 		"foobar",
@@ -197,9 +218,14 @@ var reqTests = []reqTest{
 			ProtoMajor:       1,
 			ProtoMinor:       1,
 			Header:           Header{},
-			ContentLength:    -1,
-			Host:             "foo.com",
-			RequestURI:       "/",
+			RawHeaders: []RawHeader{
+				{"Host", "foo.com"},
+				{"Transfer-Encoding", "chunked"},
+				{"Content-Length", "9999"},
+			},
+			ContentLength: -1,
+			Host:          "foo.com",
+			RequestURI:    "/",
 		},
 
 		"foobar",
@@ -293,6 +319,9 @@ var reqTests = []reqTest{
 			Header: Header{
 				"Server": []string{"foo"},
 			},
+			RawHeaders: []RawHeader{
+				{"Server", "foo"},
+			},
 			Close:         false,
 			ContentLength: 0,
 			RequestURI:    "*",
@@ -317,6 +346,9 @@ var reqTests = []reqTest{
 			Header: Header{
 				"Server": []string{"foo"},
 			},
+			RawHeaders: []RawHeader{
+				{"Server", "foo"},
+			},
 			Close:         false,
 			ContentLength: 0,
 			RequestURI:    "*",
@@ -341,6 +373,10 @@ var reqTests = []reqTest{
 				// keep this:
 				"Connection": []string{"close"},
 			},
+			RawHeaders: []RawHeader{
+				{"Host", "issue8261.com"},
+				{"Connection", "close"},
+			},
 			Host:       "issue8261.com",
 			Proto:      "HTTP/1.1",
 			ProtoMajor: 1,
@@ -367,6 +403,11 @@ var reqTests = []reqTest{
 				"Connection":     []string{"close"},
 				"Content-Length": []string{"0"},
 			},
+			RawHeaders: []RawHeader{
+				{"Host", "issue8261.com"},
+				{"Connection", "close"},
+				{"Content-Length", "0"},
+			},
 			Host:       "issue8261.com",
 			Proto:      "HTTP/1.1",
 			ProtoMajor: 1,
@@ -461,6 +502,18 @@ Content-Length: 5`)},
 	{"leading_tab_in_header", reqBytes(`HEAD / HTTP/1.1
 \tHost: foo
 Content-Length: 5`)},
+
+	// Header lines textproto.ReadMIMEHeader rejects.
+	{"empty_header_name", reqBytes(`GET / HTTP/1.1
+Host: foo
+: b`)},
+	{"header_without_colon", reqBytes(`GET / HTTP/1.1
+Host: foo
+no colon`)},
+	{"invalid_header_name", reqBytes(`GET / HTTP/1.1
+Host: foo
+X(1): b`)},
+	{"control_byte_in_header_value", []byte("GET / HTTP/1.1\r\nHost: foo\r\nX: a\x00b\r\n\r\n")},
 }
 
 func TestReadRequest_Bad(t *testing.T) {
@@ -472,3 +525,42 @@ func TestReadRequest_Bad(t *testing.T) {
 		}
 	}
 }
+
+func TestReadRequestRawHeaders(t *testing.T) {
+	req, err := ReadRequest(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n" +
+		"host: foo.com\r\n" +
+		"X-NewRelic-ID: 1\r\n" +
+		"Cookie: a=1\r\n" +
+		"X-Folded: a\r\n" +
+		"\tb\r\n" +
+		"cookie: b=2\r\n" +
+		"\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RawHeader{
+		{"host", "foo.com"},
+		{"X-NewRelic-ID", "1"},
+		{"Cookie", "a=1"},
+		{"X-Folded", "a b"},
+		{"cookie", "b=2"},
+	}
+	if !reflect.DeepEqual(req.RawHeaders, want) {
+		t.Errorf("RawHeaders = %q; want %q", req.RawHeaders, want)
+	}
+	if got := req.Header["Cookie"]; !reflect.DeepEqual(got, []string{"a=1", "b=2"}) {
+		t.Errorf("Cookie header = %q", got)
+	}
+	if got := req.Header.Get("X-Folded"); got != "a b" {
+		t.Errorf("X-Folded header = %q; want %q", got, "a b")
+	}
+
+	// A line without a colon is an error, not skipped.
+	_, err = ReadRequest(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n" +
+		"Host: foo.com\r\n" +
+		"no colon\r\n" +
+		"\r\n")))
+	if err == nil || !strings.Contains(err.Error(), "malformed MIME header") {
+		t.Errorf("ReadRequest with a line without a colon: err = %v; want malformed MIME header", err)
+	}
+}
@@ -0,0 +1,241 @@
+package http
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// DefaultRedirectHeaders is the Client's default RedirectHeaders. It
+// sets Referer to the URL of the previous request, unless that would
+// send an https URL to an http one.
+func DefaultRedirectHeaders(req *Request, via []*Request) {
+	if ref := refererForURL(via[len(via)-1].URL, req.URL); ref != "" {
+		setOrderedHeader(req.Header, "Referer", ref)
+	}
+}
+
+// BrowserRedirectHeaders is a Client RedirectHeaders that rewrites
+// headers as browsers do when following redirects, by the rules of the
+// Fetch standard:
+//
+//   - Referer stays that of the initial request, if any, cut down to
+//     its origin for another origin and dropped for https to http, as
+//     under the default strict-origin-when-cross-origin policy.
+//   - When a 301, 302 or 303 turns the request into a GET, the headers
+//     describing the body, like Content-Type and Content-Length, and
+//     Origin are dropped.
+//   - Otherwise Origin becomes "null" once a redirect goes to another
+//     origin from a URL whose origin is not the request's Origin.
+//   - Sec-Fetch-Site, unless "none", grows to the least related of the
+//     sites the redirects went through. Sites are told apart by the
+//     PublicSuffixList of the request's CookieSite; without one, any
+//     two different hosts are cross-site.
+func BrowserRedirectHeaders(req *Request, via []*Request) {
+	ireq := via[0]
+	h := req.Header
+
+	if ref := getHeaderFold(ireq.Header, "Referer"); ref != "" {
+		if ref = browserReferer(ref, req.URL); ref != "" {
+			setOrderedHeader(h, "Referer", ref)
+		} else {
+			delHeaderFold(h, "Referer")
+		}
+	} else {
+		delHeaderFold(h, "Referer")
+	}
+
+	urls := make([]*url.URL, 0, len(via)+1)
+	for _, r := range via {
+		urls = append(urls, r.URL)
+	}
+	urls = append(urls, req.URL)
+
+	if req.Method == "GET" && ireq.Method != "GET" && ireq.Method != "HEAD" {
+		for _, name := range requestBodyHeaders {
+			delHeaderFold(h, name)
+		}
+		delHeaderFold(h, "Origin")
+	} else if origin := getHeaderFold(h, "Origin"); origin != "" && origin != "null" {
+		for i := 1; i < len(urls); i++ {
+			o, prev := webOrigin(urls[i]), webOrigin(urls[i-1])
+			if o != prev && prev != origin {
+				setHeaderFold(h, "Origin", "null")
+				break
+			}
+		}
+	}
+
+	if site := getHeaderFold(ireq.Header, "Sec-Fetch-Site"); site != "" && site != "none" {
+		from := urls[0]
+		cs, _ := CookieSiteFromContext(req.Context())
+		if cs.Initiator != nil {
+			from, site = cs.Initiator, "same-origin"
+		}
+		for _, u := range urls {
+			site = lessRelatedSite(site, fetchSite(from, u, cs.PublicSuffixList))
+		}
+		setHeaderFold(h, "Sec-Fetch-Site", site)
+	}
+}
+
+// requestBodyHeaders are the request-body-header names of the Fetch
+// standard, plus Content-Length, dropped along with the body.
+var requestBodyHeaders = []string{
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Location",
+	"Content-Type",
+	"Content-Length",
+}
+
+// browserReferer returns ref as sent to u under the referrer policy
+// strict-origin-when-cross-origin.
+func browserReferer(ref string, u *url.URL) string {
+	r, err := url.Parse(ref)
+	if err != nil || r.Scheme == "" {
+		return ""
+	}
+	if r.Scheme == "https" && u.Scheme != "https" {
+		return ""
+	}
+	if webOrigin(r) == webOrigin(u) {
+		return ref
+	}
+	return webOrigin(r) + "/"
+}
+
+// webOrigin returns the serialized origin of u, like
+// "https://example.com:8443".
+func webOrigin(u *url.URL) string {
+	host := u.Hostname()
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != portMap[u.Scheme] {
+		host += ":" + port
+	}
+	return strings.ToLower(u.Scheme + "://" + host)
+}
+
+// fetchSite returns the Sec-Fetch-Site value for a request to u made
+// from a document at from, with sites determined by list.
+func fetchSite(from, u *url.URL, list PublicSuffixList) string {
+	switch {
+	case webOrigin(from) == webOrigin(u):
+		return "same-origin"
+	case from.Scheme == u.Scheme && siteOfHost(from.Hostname(), list) == siteOfHost(u.Hostname(), list):
+		return "same-site"
+	}
+	return "cross-site"
+}
+
+// siteOfHost returns the registrable domain of host by list, like
+// "example.co.uk" for "www.example.co.uk". Without a list, or for IP
+// addresses and public suffixes, it returns host itself.
+func siteOfHost(host string, list PublicSuffixList) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if list == nil || net.ParseIP(host) != nil {
+		return host
+	}
+	ps := list.PublicSuffix(host)
+	if !strings.HasSuffix(host, "."+ps) {
+		return host
+	}
+	rest := host[:len(host)-len(ps)-1]
+	return rest[strings.LastIndex(rest, ".")+1:] + "." + ps
+}
+
+var fetchSiteRank = map[string]int{"same-origin": 0, "same-site": 1, "cross-site": 2}
+
+// lessRelatedSite returns whichever of the Sec-Fetch-Site values a
+// and b is the less related.
+func lessRelatedSite(a, b string) string {
+	if fetchSiteRank[b] > fetchSiteRank[a] {
+		return b
+	}
+	return a
+}
+
+// headerKeyFold returns the key of h that is name in any case,
+// preferring the canonical spelling, and reports whether there is one.
+func headerKeyFold(h Header, name string) (string, bool) {
+	name = CanonicalHeaderKey(name)
+	if _, ok := h[name]; ok {
+		return name, true
+	}
+	for k := range h {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return name, false
+}
+
+func getHeaderFold(h Header, name string) string {
+	if k, ok := headerKeyFold(h, name); ok && len(h[k]) > 0 {
+		return h[k][0]
+	}
+	return ""
+}
+
+// setHeaderFold sets the header name in h to value, keeping the case
+// of a key already there and dropping any others spelled differently.
+func setHeaderFold(h Header, name, value string) {
+	k, _ := headerKeyFold(h, name)
+	delHeaderFold(h, name)
+	h[k] = []string{value}
+}
+
+func delHeaderFold(h Header, name string) {
+	for k := range h {
+		if strings.EqualFold(k, name) {
+			delete(h, k)
+		}
+	}
+}
+
+// refererFollowers are the headers browsers send after Referer.
+var refererFollowers = []string{"accept-encoding", "accept-language", "cookie", "priority"}
+
+// setOrderedHeader is setHeaderFold for a header the Client adds
+// itself. If h has a HeaderOrderKey that doesn't list name, name is
+// inserted where browsers send it: for Referer, before the first of
+// refererFollowers, and otherwise at the end. It is spelled in
+// lowercase if most of the names already listed are, and in canonical
+// case otherwise.
+func setOrderedHeader(h Header, name, value string) {
+	setHeaderFold(h, name, value)
+	order, ok := h[HeaderOrderKey]
+	if !ok {
+		return
+	}
+	i := len(order)
+	for j, listed := range order {
+		if strings.EqualFold(listed, name) {
+			return
+		}
+		if i == len(order) && strings.EqualFold(name, "Referer") {
+			for _, f := range refererFollowers {
+				if strings.EqualFold(listed, f) {
+					i = j
+				}
+			}
+		}
+	}
+	lower := 0
+	for _, listed := range order {
+		if listed == strings.ToLower(listed) {
+			lower++
+		}
+	}
+	if 2*lower > len(order) {
+		name = strings.ToLower(name)
+	}
+	// Copy the order: it is shared with the initial request.
+	newOrder := make([]string, 0, len(order)+1)
+	newOrder = append(newOrder, order[:i]...)
+	newOrder = append(newOrder, name)
+	newOrder = append(newOrder, order[i:]...)
+	h[HeaderOrderKey] = newOrder
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lastLabelPSL treats the last label of a domain as its public suffix,
+// and "co.uk" as one too.
+type lastLabelPSL struct{}
+
+func (lastLabelPSL) PublicSuffix(d string) string {
+	if d == "co.uk" || strings.HasSuffix(d, ".co.uk") {
+		return "co.uk"
+	}
+	return d[strings.LastIndex(d, ".")+1:]
+}
+
+func TestFetchSite(t *testing.T) {
+	tests := []struct {
+		from, to string
+		list     PublicSuffixList
+		want     string
+	}{
+		{"https://example.com/a", "https://example.com/b", nil, "same-origin"},
+		{"https://example.com:443/", "https://example.com/", nil, "same-origin"},
+		{"https://example.com/", "https://example.com:8443/", nil, "same-site"},
+		{"https://example.com/", "http://example.com/", nil, "cross-site"},
+		{"https://www.example.com/", "https://api.example.com/", nil, "cross-site"},
+		{"https://www.example.com/", "https://api.example.com/", lastLabelPSL{}, "same-site"},
+		{"https://a.example.co.uk/", "https://b.example.co.uk/", lastLabelPSL{}, "same-site"},
+		{"https://example.co.uk/", "https://other.co.uk/", lastLabelPSL{}, "cross-site"},
+		{"https://127.0.0.1/", "https://127.0.0.2/", lastLabelPSL{}, "cross-site"},
+	}
+	for _, tt := range tests {
+		from, _ := url.Parse(tt.from)
+		to, _ := url.Parse(tt.to)
+		if got := fetchSite(from, to, tt.list); got != tt.want {
+			t.Errorf("fetchSite(%q, %q, %v) = %q; want %q", tt.from, tt.to, tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestSetOrderedHeaderCase(t *testing.T) {
+	tests := []struct {
+		order, want []string
+	}{
+		{
+			[]string{"user-agent", "accept", "accept-encoding"},
+			[]string{"user-agent", "accept", "referer", "accept-encoding"},
+		},
+		{
+			// One canonical name first doesn't make the rest so.
+			[]string{"Host", "user-agent", "accept", "cookie"},
+			[]string{"Host", "user-agent", "accept", "referer", "cookie"},
+		},
+		{
+			[]string{"User-Agent", "Accept", "accept-encoding"},
+			[]string{"User-Agent", "Accept", "Referer", "accept-encoding"},
+		},
+	}
+	for _, tt := range tests {
+		h := Header{HeaderOrderKey: tt.order}
+		setOrderedHeader(h, "Referer", "https://example.com/")
+		if got := h[HeaderOrderKey]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("order %q: got %q; want %q", tt.order, got, tt.want)
+		}
+	}
+}
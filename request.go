@@ -165,6 +165,24 @@ type Request struct {
 	// for the Request.Write method.
 	Header Header
 
+	// PreserveHeaderCase makes HTTP/1.1 requests write the header
+	// names listed in Header[HeaderOrderKey] exactly as spelled
+	// there, rather than as the keys of Header. This keeps names
+	// such as "X-NewRelic-ID" intact even though Header.Set stores
+	// them as "X-Newrelic-Id". Other names are written as their
+	// keys in Header. HTTP/2 requests always use lowercase names.
+	//
+	// For server requests, this field is not used.
+	PreserveHeaderCase bool
+
+	// RawHeaders are the header fields of a server request as
+	// received, in order, with their names spelled as sent and with
+	// repeated fields kept. For HTTP/2 requests they start with the
+	// pseudo-header fields. Trailers are not included.
+	//
+	// For client requests, this field is ignored.
+	RawHeaders []RawHeader
+
 	// Body is the request's body.
 	//
 	// For client requests, a nil body means the request has no
@@ -388,6 +406,11 @@ func (r *Request) Clone(ctx context.Context) *Request {
 		copy(s2, s)
 		r2.TransferEncoding = s2
 	}
+	if s := r.RawHeaders; s != nil {
+		s2 := make([]RawHeader, len(s))
+		copy(s2, s)
+		r2.RawHeaders = s2
+	}
 	r2.Form = cloneURLValues(r.Form)
 	r2.PostForm = cloneURLValues(r.PostForm)
 	r2.MultipartForm = cloneMultipartForm(r.MultipartForm)
@@ -632,7 +655,7 @@ func (r *Request) write(w io.Writer, usingProxy bool, extraHeaders Header, waitF
 		return err
 	}
 
-	err = r.Header.write(w, trace)
+	err = r.Header.writeSubset(w, nil, trace, r.PreserveHeaderCase)
 	if err != nil {
 		return err
 	}
@@ -1056,11 +1079,12 @@ func readRequest(b *bufio.Reader, deleteHostHeader bool) (req *Request, err erro
 	}
 
 	// Subsequent lines: Key: value.
-	mimeHeader, err := tp.ReadMIMEHeader()
+	mimeHeader, rawHeaders, err := readMIMEHeaderRaw(tp)
 	if err != nil {
 		return nil, err
 	}
 	req.Header = Header(mimeHeader)
+	req.RawHeaders = rawHeaders
 
 	// RFC 7230, section 5.3: Must treat
 	//	GET /index.html HTTP/1.1
@@ -770,6 +770,8 @@ func TestStarRequest(t *testing.T) {
 	// but we don't care about it)
 	req.Header = nil
 	back.Header = nil
+	req.RawHeaders = nil
+	back.RawHeaders = nil
 	if !reflect.DeepEqual(req, back) {
 		t.Errorf("Original request doesn't match Request read back.")
 		t.Logf("Original: %#v", req)
@@ -50,6 +50,19 @@ type Response struct {
 	// Keys in the map are canonicalized (see CanonicalHeaderKey).
 	Header Header
 
+	// RawHeaders are the header fields of the response as received,
+	// in order, with their names spelled as sent and with repeated
+	// fields kept. For HTTP/2 responses they start with the
+	// ":status" pseudo-header field. Trailers are not included.
+	RawHeaders []RawHeader
+
+	// ReplayRawHeaders makes Write send the headers in the order of
+	// RawHeaders, with their names spelled as received, unless
+	// Header has a HeaderOrderKey entry. It costs a copy of Header
+	// on each Write, so it is off by default; httputil.DumpResponse
+	// sets it while dumping.
+	ReplayRawHeaders bool
+
 	// Body represents the response body.
 	//
 	// The response body is streamed on demand as the Body field
@@ -188,7 +201,7 @@ func ReadResponse(r *bufio.Reader, req *Request) (*Response, error) {
 	}
 
 	// Parse the response headers.
-	mimeHeader, err := tp.ReadMIMEHeader()
+	mimeHeader, rawHeaders, err := readMIMEHeaderRaw(tp)
 	if err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
@@ -196,6 +209,7 @@ func ReadResponse(r *bufio.Reader, req *Request) (*Response, error) {
 		return nil, err
 	}
 	resp.Header = Header(mimeHeader)
+	resp.RawHeaders = rawHeaders
 
 	fixPragmaCacheControl(resp.Header)
 
@@ -240,6 +254,7 @@ func (r *Response) ProtoAtLeast(major, minor int) bool {
 //  Body
 //  ContentLength
 //  Header, Values for non-canonical keys will have unpredictable behavior
+//  RawHeaders, if ReplayRawHeaders is set
 //
 // The Response Body is closed after it is sent.
 func (r *Response) Write(w io.Writer) error {
@@ -299,13 +314,17 @@ func (r *Response) Write(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	err = tw.writeHeader(w, nil)
-	if err != nil {
-		return err
+	if _, ok := r.Header[HeaderOrderKey]; !ok && r.ReplayRawHeaders && r.RawHeaders != nil {
+		// Replay the headers as received, with the framing headers
+		// computed above in their original place.
+		err = r.writeReceivedHeader(w, tw)
+	} else {
+		err = tw.writeHeader(w, nil)
+		if err == nil {
+			// Rest of header
+			err = r.Header.WriteSubset(w, respExcludeHeader)
+		}
 	}
-
-	// Rest of header
-	err = r.Header.WriteSubset(w, respExcludeHeader)
 	if err != nil {
 		return err
 	}
@@ -334,6 +353,28 @@ func (r *Response) Write(w io.Writer) error {
 	return nil
 }
 
+// writeReceivedHeader writes r's headers in the order of
+// r.RawHeaders, spelling their names as received. The framing
+// headers are taken from tw rather than from r.Header.
+func (r *Response) writeReceivedHeader(w io.Writer, tw *transferWriter) error {
+	h := r.Header.Clone()
+	if h == nil {
+		h = make(Header)
+	}
+	for k := range respExcludeHeader {
+		delete(h, k)
+	}
+	if err := tw.addHeaders(&h, nil); err != nil {
+		return err
+	}
+	order := make([]string, len(r.RawHeaders))
+	for i, rh := range r.RawHeaders {
+		order[i] = rh.Name
+	}
+	h[HeaderOrderKey] = order
+	return h.writeSubset(w, nil, nil, true)
+}
+
 func (r *Response) closeBody() {
 	if r.Body != nil {
 		r.Body.Close()
@@ -53,6 +53,9 @@ var respTests = []respTest{
 			Header: Header{
 				"Connection": {"close"}, // TODO(rsc): Delete?
 			},
+			RawHeaders: []RawHeader{
+				{"Connection", "close"},
+			},
 			Close:         true,
 			ContentLength: -1,
 		},
@@ -122,6 +125,10 @@ var respTests = []respTest{
 				"Connection":     {"close"},
 				"Content-Length": {"10"},
 			},
+			RawHeaders: []RawHeader{
+				{"Content-Length", "10"},
+				{"Connection", "close"},
+			},
 			Close:         true,
 			ContentLength: 10,
 		},
@@ -142,13 +149,16 @@ var respTests = []respTest{
 			"\r\n",
 
 		Response{
-			Status:           "200 OK",
-			StatusCode:       200,
-			Proto:            "HTTP/1.1",
-			ProtoMajor:       1,
-			ProtoMinor:       1,
-			Request:          dummyReq("GET"),
-			Header:           Header{},
+			Status:     "200 OK",
+			StatusCode: 200,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Request:    dummyReq("GET"),
+			Header:     Header{},
+			RawHeaders: []RawHeader{
+				{"Transfer-Encoding", "chunked"},
+			},
 			Close:            false,
 			ContentLength:    -1,
 			TransferEncoding: []string{"chunked"},
@@ -178,6 +188,11 @@ var respTests = []respTest{
 				"Content-Length": {"10"},
 				"Trailer":        []string{"Content-MD5, Content-Sources"},
 			},
+			RawHeaders: []RawHeader{
+				{"Trailer", "Content-MD5, Content-Sources"},
+				{"Content-Length", "10"},
+				{"Connection", "close"},
+			},
 			Close:         true,
 			ContentLength: 10,
 		},
@@ -197,13 +212,17 @@ var respTests = []respTest{
 			"\r\n",
 
 		Response{
-			Status:           "200 OK",
-			StatusCode:       200,
-			Proto:            "HTTP/1.1",
-			ProtoMajor:       1,
-			ProtoMinor:       1,
-			Request:          dummyReq("GET"),
-			Header:           Header{},
+			Status:     "200 OK",
+			StatusCode: 200,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Request:    dummyReq("GET"),
+			Header:     Header{},
+			RawHeaders: []RawHeader{
+				{"Transfer-Encoding", "chunked"},
+				{"Content-Length", "10"},
+			},
 			Close:            false,
 			ContentLength:    -1,
 			TransferEncoding: []string{"chunked"},
@@ -219,13 +238,16 @@ var respTests = []respTest{
 			"\r\n",
 
 		Response{
-			Status:           "200 OK",
-			StatusCode:       200,
-			Proto:            "HTTP/1.1",
-			ProtoMajor:       1,
-			ProtoMinor:       1,
-			Request:          dummyReq("HEAD"),
-			Header:           Header{},
+			Status:     "200 OK",
+			StatusCode: 200,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Request:    dummyReq("HEAD"),
+			Header:     Header{},
+			RawHeaders: []RawHeader{
+				{"Transfer-Encoding", "chunked"},
+			},
 			TransferEncoding: []string{"chunked"},
 			Close:            false,
 			ContentLength:    -1,
@@ -241,13 +263,16 @@ var respTests = []respTest{
 			"\r\n",
 
 		Response{
-			Status:           "200 OK",
-			StatusCode:       200,
-			Proto:            "HTTP/1.0",
-			ProtoMajor:       1,
-			ProtoMinor:       0,
-			Request:          dummyReq("HEAD"),
-			Header:           Header{"Content-Length": {"256"}},
+			Status:     "200 OK",
+			StatusCode: 200,
+			Proto:      "HTTP/1.0",
+			ProtoMajor: 1,
+			ProtoMinor: 0,
+			Request:    dummyReq("HEAD"),
+			Header:     Header{"Content-Length": {"256"}},
+			RawHeaders: []RawHeader{
+				{"Content-Length", "256"},
+			},
 			TransferEncoding: nil,
 			Close:            true,
 			ContentLength:    256,
@@ -263,13 +288,16 @@ var respTests = []respTest{
 			"\r\n",
 
 		Response{
-			Status:           "200 OK",
-			StatusCode:       200,
-			Proto:            "HTTP/1.1",
-			ProtoMajor:       1,
-			ProtoMinor:       1,
-			Request:          dummyReq("HEAD"),
-			Header:           Header{"Content-Length": {"256"}},
+			Status:     "200 OK",
+			StatusCode: 200,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Request:    dummyReq("HEAD"),
+			Header:     Header{"Content-Length": {"256"}},
+			RawHeaders: []RawHeader{
+				{"Content-Length", "256"},
+			},
 			TransferEncoding: nil,
 			Close:            false,
 			ContentLength:    256,
@@ -315,6 +343,9 @@ var respTests = []respTest{
 			Header: Header{
 				"Content-Length": {"0"},
 			},
+			RawHeaders: []RawHeader{
+				{"Content-Length", "0"},
+			},
 			Close:         false,
 			ContentLength: 0,
 		},
@@ -377,6 +408,10 @@ some body`,
 			Header: Header{
 				"Content-Type": []string{"multipart/byteranges; boundary=18a75608c8f47cef"},
 			},
+			RawHeaders: []RawHeader{
+				{"Connection", "close"},
+				{"Content-Type", "multipart/byteranges; boundary=18a75608c8f47cef"},
+			},
 			Close:         true,
 			ContentLength: -1,
 		},
@@ -400,6 +435,9 @@ some body`,
 			Header: Header{
 				"Connection": {"close"}, // TODO(rsc): Delete?
 			},
+			RawHeaders: []RawHeader{
+				{"Connection", "close"},
+			},
 			Close:         true,
 			ContentLength: -1,
 		},
@@ -429,6 +467,12 @@ some body`,
 				"Content-Type":   []string{"text/plain; charset=utf-8"},
 				"Content-Range":  []string{"bytes 0-5/1862"},
 			},
+			RawHeaders: []RawHeader{
+				{"Content-Type", "text/plain; charset=utf-8"},
+				{"Accept-Ranges", "bytes"},
+				{"Content-Range", "bytes 0-5/1862"},
+				{"Content-Length", "6"},
+			},
 			ContentLength: 6,
 		},
 
@@ -452,6 +496,10 @@ some body`,
 			Header: Header{
 				"Content-Length": {"256"},
 			},
+			RawHeaders: []RawHeader{
+				{"Content-Length", "256"},
+				{"Connection", "keep-alive, close"},
+			},
 			TransferEncoding: nil,
 			Close:            true,
 			ContentLength:    256,
@@ -478,6 +526,11 @@ some body`,
 			Header: Header{
 				"Content-Length": {"256"},
 			},
+			RawHeaders: []RawHeader{
+				{"Content-Length", "256"},
+				{"Connection", "keep-alive"},
+				{"Connection", "close"},
+			},
 			TransferEncoding: nil,
 			Close:            true,
 			ContentLength:    256,
@@ -495,13 +548,16 @@ some body`,
 			"Body here\n",
 
 		Response{
-			Status:        "200 OK",
-			StatusCode:    200,
-			Proto:         "HTTP/1.0",
-			ProtoMajor:    1,
-			ProtoMinor:    0,
-			Request:       dummyReq("GET"),
-			Header:        Header{},
+			Status:     "200 OK",
+			StatusCode: 200,
+			Proto:      "HTTP/1.0",
+			ProtoMajor: 1,
+			ProtoMinor: 0,
+			Request:    dummyReq("GET"),
+			Header:     Header{},
+			RawHeaders: []RawHeader{
+				{"Transfer-Encoding", "bogus"},
+			},
 			Close:         true,
 			ContentLength: -1,
 		},
@@ -528,6 +584,10 @@ some body`,
 			Header: Header{
 				"Content-Length": {"10"},
 			},
+			RawHeaders: []RawHeader{
+				{"Transfer-Encoding", "bogus"},
+				{"Content-Length", "10"},
+			},
 			Close:         true,
 			ContentLength: 10,
 		},
@@ -555,6 +615,12 @@ some body`,
 				"Connection":       {"keep-alive"},
 				"Keep-Alive":       {"timeout=7200"},
 			},
+			RawHeaders: []RawHeader{
+				{"Content-Encoding", "gzip"},
+				{"Content-Length", "23"},
+				{"Connection", "keep-alive"},
+				{"Keep-Alive", "timeout=7200"},
+			},
 			Close:         false,
 			ContentLength: 23,
 		},
@@ -578,6 +644,10 @@ some body`,
 				"Content-Type":     {"text/html"},
 				"Www-Authenticate": {`Basic realm=""`},
 			},
+			RawHeaders: []RawHeader{
+				{"Content-type", "text/html"},
+				{"WWW-Authenticate", "Basic realm=\"\""},
+			},
 			Close:         true,
 			ContentLength: -1,
 		},
@@ -931,6 +1001,12 @@ func TestReadResponseErrors(t *testing.T) {
 		// golang.org/issue/22464
 		{"leading space in header", "HTTP/1.1 200 OK\r\n Content-type: text/html\r\nFoo: bar\r\n\r\n", "malformed MIME"},
 		{"leading tab in header", "HTTP/1.1 200 OK\r\n\tContent-type: text/html\r\nFoo: bar\r\n\r\n", "malformed MIME"},
+
+		// Header lines textproto.ReadMIMEHeader rejects.
+		{"empty header name", "HTTP/1.1 200 OK\r\n: b\r\nC: d\r\n\r\n", "malformed MIME header line"},
+		{"header without colon", "HTTP/1.1 200 OK\r\nFoo: bar\r\nno colon\r\n\r\n", "malformed MIME header line"},
+		{"invalid header name", "HTTP/1.1 200 OK\r\nX(1): b\r\n\r\n", "malformed MIME header line"},
+		{"control byte in header value", "HTTP/1.1 200 OK\r\nX: a\x00b\r\n\r\n", "malformed MIME header line"},
 	}
 
 	for i, tt := range tests {
@@ -1011,3 +1087,58 @@ func TestResponseWritesOnlySingleConnectionClose(t *testing.T) {
 		t.Errorf("Found %d %q header", count, connectionCloseHeader)
 	}
 }
+
+func TestResponseWriteReceivedHeaderOrder(t *testing.T) {
+	const raw = "HTTP/1.1 200 OK\r\n" +
+		"server: cdn\r\n" +
+		"Set-Cookie: a=1\r\n" +
+		"Content-Length: 5\r\n" +
+		"X-Cache: HIT\r\n" +
+		"set-cookie: b=2\r\n" +
+		"\r\n" +
+		"Hello"
+	res, err := ReadResponse(bufio.NewReader(strings.NewReader(raw)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RawHeader{
+		{"server", "cdn"},
+		{"Set-Cookie", "a=1"},
+		{"Content-Length", "5"},
+		{"X-Cache", "HIT"},
+		{"set-cookie", "b=2"},
+	}
+	if !reflect.DeepEqual(res.RawHeaders, want) {
+		t.Errorf("RawHeaders = %q; want %q", res.RawHeaders, want)
+	}
+
+	// Without ReplayRawHeaders, Header is written as usual.
+	var buf bytes.Buffer
+	if err := res.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const sorted = "HTTP/1.1 200 OK\r\n" +
+		"Content-Length: 5\r\n" +
+		"Server: cdn\r\n" +
+		"Set-Cookie: a=1\r\n" +
+		"Set-Cookie: b=2\r\n" +
+		"X-Cache: HIT\r\n" +
+		"\r\n" +
+		"Hello"
+	if got := buf.String(); got != sorted {
+		t.Errorf("Write:\n got: %q\nwant: %q", got, sorted)
+	}
+
+	res, err = ReadResponse(bufio.NewReader(strings.NewReader(raw)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.ReplayRawHeaders = true
+	buf.Reset()
+	if err := res.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != raw {
+		t.Errorf("Write with ReplayRawHeaders:\n got: %q\nwant: %q", got, raw)
+	}
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+)
+
+const (
+	socks4Version      = 0x04
+	socks4CmdConnect   = 0x01
+	socks4ReplyGranted = 0x5a
+)
+
+// socks4Replies holds the meaning of SOCKS4 failure codes.
+var socks4Replies = map[byte]string{
+	0x5b: "request rejected or failed",
+	0x5c: "request rejected: proxy cannot reach client identd",
+	0x5d: "request rejected: client identd reports a different user ID",
+}
+
+// socks4Connect asks the SOCKS4 proxy at the other end of c to connect
+// to address. SOCKS4 only takes IPv4 addresses; if remoteDNS is set,
+// address may have a host name, which the proxy resolves (SOCKS4a).
+// userID is sent as the user ID, the protocol's only credential.
+//
+// The returned error may be a net.OpError, as from socksDialer.
+func socks4Connect(ctx context.Context, c net.Conn, address, userID string, remoteDNS bool) error {
+	op := "socks4 connect"
+	if remoteDNS {
+		op = "socks4a connect"
+	}
+	err := socks4Handshake(ctx, c, address, userID, remoteDNS)
+	if err != nil {
+		d := socksNewDialer("tcp", c.RemoteAddr().String())
+		proxy, dst, _ := d.pathAddrs(address)
+		return &net.OpError{Op: op, Net: "tcp", Source: proxy, Addr: dst, Err: err}
+	}
+	return nil
+}
+
+func socks4Handshake(ctx context.Context, c net.Conn, address, userID string, remoteDNS bool) (ctxErr error) {
+	host, port, err := sockssplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	var ip4, name []byte
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 = ip.To4(); ip4 == nil {
+			return errors.New("IPv6 addresses are not supported by SOCKS4")
+		}
+	} else if remoteDNS {
+		// SOCKS4a: an invalid IP address 0.0.0.x means the host
+		// name follows the user ID.
+		ip4 = []byte{0, 0, 0, 1}
+		name = append([]byte(host), 0)
+	} else {
+		return errors.New("SOCKS4 requires an IP address")
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && !deadline.IsZero() {
+		c.SetDeadline(deadline)
+		defer c.SetDeadline(socksnoDeadline)
+	}
+	if ctx != context.Background() {
+		errCh := make(chan error, 1)
+		done := make(chan struct{})
+		defer func() {
+			close(done)
+			if ctxErr == nil {
+				ctxErr = <-errCh
+			}
+		}()
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.SetDeadline(socksaLongTimeAgo)
+				errCh <- ctx.Err()
+			case <-done:
+				errCh <- nil
+			}
+		}()
+	}
+
+	b := make([]byte, 0, 9+len(userID)+len(name))
+	b = append(b, socks4Version, socks4CmdConnect, byte(port>>8), byte(port))
+	b = append(b, ip4...)
+	b = append(b, userID...)
+	b = append(b, 0)
+	b = append(b, name...)
+	if _, ctxErr = c.Write(b); ctxErr != nil {
+		return
+	}
+
+	b = b[:8]
+	if _, ctxErr = io.ReadFull(c, b); ctxErr != nil {
+		return
+	}
+	if b[0] != 0 {
+		return errors.New("unexpected reply version " + strconv.Itoa(int(b[0])))
+	}
+	if b[1] != socks4ReplyGranted {
+		if msg, ok := socks4Replies[b[1]]; ok {
+			return errors.New(msg)
+		}
+		return errors.New("unknown code: " + strconv.Itoa(int(b[1])))
+	}
+	return nil
+}
@@ -118,8 +118,14 @@ type Transport struct {
 	// request is aborted with the provided error.
 	//
 	// The proxy type is determined by the URL scheme. "http",
-	// "https", and "socks5" are supported. If the scheme is empty,
-	// "http" is assumed.
+	// "https", "socks4", "socks4a", "socks5" and "socks5h" are
+	// supported. If the scheme is empty, "http" is assumed.
+	//
+	// With "socks4" and "socks5", target host names are resolved
+	// locally and the proxy is sent an IP address; with "socks4a"
+	// and "socks5h", the proxy resolves them. The URL's username and
+	// password are used for SOCKS5 authentication, and its username
+	// as the SOCKS4 user ID.
 	//
 	// If Proxy is nil or returns a nil *URL, no proxy is used.
 	Proxy func(*Request) (*url.URL, error)
@@ -172,6 +178,14 @@ type Transport struct {
 	// If non-nil, HTTP/2 support may not be enabled by default.
 	TLSClientConfig *tls.Config
 
+	// TLSClient optionally specifies a function that starts a client
+	// TLS session on conn, such as a TLS implementation that controls
+	// the ClientHello. It is used for HTTPS connections made without
+	// DialTLSContext or DialTLS, including those through proxies.
+	// config is a copy of TLSClientConfig with ServerName set.
+	// If nil, tls.Client is used.
+	TLSClient func(conn net.Conn, config *tls.Config) TLSConn
+
 	// TLSHandshakeTimeout specifies the maximum amount of time waiting to
 	// wait for a TLS handshake. Zero means no timeout.
 	TLSHandshakeTimeout time.Duration
@@ -240,11 +254,22 @@ type Transport struct {
 	// must return a RoundTripper that then handles the request.
 	// If TLSNextProto is not nil, HTTP/2 support is not enabled
 	// automatically.
-	TLSNextProto map[string]func(authority string, c *tls.Conn) RoundTripper
+	//
+	// The connection is a *tls.Conn, unless TLSClient or the TLS
+	// dialer returned another TLSConn.
+	TLSNextProto map[string]func(authority string, c TLSConn) RoundTripper
 
 	// ProxyConnectHeader optionally specifies headers to send to
 	// proxies during CONNECT requests.
 	// To set the header dynamically, see GetProxyConnectHeader.
+	//
+	// HeaderOrderKey and PHeaderOrderKey order the CONNECT request's
+	// headers and pseudo-headers, as for other requests. Over
+	// HTTP/1.1, the names listed under HeaderOrderKey are written as
+	// spelled there, as with Request.PreserveHeaderCase.
+	//
+	// A proxy answering with a status other than 200 makes the
+	// request fail with a *ProxyConnectError.
 	ProxyConnectHeader Header
 
 	// GetProxyConnectHeader optionally specifies a func to return
@@ -253,9 +278,20 @@ type Transport struct {
 	// If it returns an error, the Transport's RoundTrip fails with
 	// that error. It can return (nil, nil) to not add headers.
 	// If GetProxyConnectHeader is non-nil, ProxyConnectHeader is
-	// ignored.
+	// ignored. The returned Header is used as ProxyConnectHeader
+	// would be, including its HeaderOrderKey and PHeaderOrderKey.
 	GetProxyConnectHeader func(ctx context.Context, proxyURL *url.URL, target string) (Header, error)
 
+	// ProxyHTTP2, if true, offers HTTP/2 to "https" proxies when
+	// opening tunnels to https targets. If the proxy negotiates it,
+	// CONNECT requests are sent as HTTP/2 streams, and tunnels to
+	// any number of targets share one connection to the proxy.
+	// Proxies that don't negotiate HTTP/2 get HTTP/1.1 CONNECT
+	// requests, as when ProxyHTTP2 is false. Tunnel deadlines work
+	// as on any net.Conn: an expired one fails the pending Read or
+	// Write, and the tunnel stays usable.
+	ProxyHTTP2 bool
+
 	// MaxResponseHeaderBytes specifies a limit on how many
 	// response bytes are allowed in the server's response
 	// header.
@@ -279,12 +315,30 @@ type Transport struct {
 	H2transport        h2Transport // non-nil if http2 wired up
 	tlsNextProtoWasNil bool        // whether TLSNextProto was nil when the Once fired
 
+	proxyH2Once sync.Once
+	proxyH2     *http2Transport // carries HTTP/2 CONNECT tunnels; see ProxyHTTP2
+
 	// ForceAttemptHTTP2 controls whether HTTP/2 is enabled when a non-zero
-	// Dial, DialTLS, or DialContext func or TLSClientConfig is provided.
+	// Dial or DialContext func or TLSClientConfig is provided.
 	// By default, use of any those fields conservatively disables HTTP/2.
 	// To use a custom dialer or TLS config and still attempt HTTP/2
 	// upgrades, set this to true.
+	//
+	// Custom TLS dialers (DialTLSContext and DialTLS) and TLSClient
+	// don't disable HTTP/2, even along with the fields above:
+	// connections they return are used for HTTP/2 if their
+	// negotiated ALPN protocol is "h2", and for HTTP/1.1 otherwise.
+	// TLSClientConfig is then left as is, so it offers HTTP/2 only if
+	// its NextProtos include "h2".
 	ForceAttemptHTTP2 bool
+
+	// ClientProfile optionally specifies how HTTP/2 connections
+	// present themselves: the initial SETTINGS frame, the
+	// connection-level WINDOW_UPDATE and the default pseudo-header
+	// and header orders. See ProfileChrome131 and friends for
+	// built-in profiles.
+	// If nil, the HTTP/2 Transport's own defaults are used.
+	ClientProfile *ClientProfile
 }
 
 // A cancelKey is the Key of the reqCanceler map.
@@ -317,6 +371,7 @@ func (t *Transport) Clone() *Transport {
 		Dial:                   t.Dial,
 		DialTLS:                t.DialTLS,
 		DialTLSContext:         t.DialTLSContext,
+		TLSClient:              t.TLSClient,
 		TLSHandshakeTimeout:    t.TLSHandshakeTimeout,
 		DisableKeepAlives:      t.DisableKeepAlives,
 		DisableCompression:     t.DisableCompression,
@@ -328,16 +383,18 @@ func (t *Transport) Clone() *Transport {
 		ExpectContinueTimeout:  t.ExpectContinueTimeout,
 		ProxyConnectHeader:     t.ProxyConnectHeader.Clone(),
 		GetProxyConnectHeader:  t.GetProxyConnectHeader,
+		ProxyHTTP2:             t.ProxyHTTP2,
 		MaxResponseHeaderBytes: t.MaxResponseHeaderBytes,
 		ForceAttemptHTTP2:      t.ForceAttemptHTTP2,
 		WriteBufferSize:        t.WriteBufferSize,
 		ReadBufferSize:         t.ReadBufferSize,
+		ClientProfile:          t.ClientProfile,
 	}
 	if t.TLSClientConfig != nil {
 		t2.TLSClientConfig = t.TLSClientConfig.Clone()
 	}
 	if !t.tlsNextProtoWasNil {
-		npm := map[string]func(authority string, c *tls.Conn) RoundTripper{}
+		npm := map[string]func(authority string, c TLSConn) RoundTripper{}
 		for k, v := range t.TLSNextProto {
 			npm[k] = v
 		}
@@ -388,21 +445,30 @@ func (t *Transport) onceSetNextProtoDefaults() {
 		// Transport.
 		return
 	}
-	if !t.ForceAttemptHTTP2 && (t.TLSClientConfig != nil || t.Dial != nil || t.DialContext != nil || t.hasCustomTLSDialer()) {
+	setNextProtos := true
+	if !t.ForceAttemptHTTP2 && (t.TLSClientConfig != nil || t.Dial != nil || t.DialContext != nil) {
 		// Be conservative and don't automatically enable
 		// http2 if they've specified a custom TLS config or
 		// custom dialers. Let them opt-in themselves via
 		// http2.ConfigureTransport so we don't surprise them
 		// by modifying their tls.Config. Issue 14275.
 		// However, if ForceAttemptHTTP2 is true, it overrides the above checks.
-		return
+		//
+		// Custom TLS dialers and TLSClient negotiate their own
+		// protocol, and dialConn picks HTTP/1.1 or HTTP/2 by its
+		// outcome, so HTTP/2 is still configured for them, but
+		// without touching their tls.Config.
+		if !t.hasCustomTLSDialer() && t.TLSClient == nil {
+			return
+		}
+		setNextProtos = false
 	}
 	if omitBundledHTTP2 {
 		return
 	}
 
 	if t.H2transport == nil {
-		t2, err := http2configureTransports(t)
+		t2, err := http2configureTransportsALPN(t, setNextProtos)
 		if err != nil {
 			log.Printf("error enabling Transport HTTP/2 support: %v", err)
 			return
@@ -770,6 +836,9 @@ func (t *Transport) CloseIdleConnections() {
 	if t2 := t.H2transport; t2 != nil {
 		t2.CloseIdleConnections()
 	}
+	if t2 := t.proxyH2; t2 != nil {
+		t2.CloseIdleConnections()
+	}
 }
 
 // CancelRequest cancels an in-flight request by closing its connection.
@@ -838,12 +907,7 @@ func (cm *connectMethod) proxyAuth() string {
 	if cm.proxyURL == nil {
 		return ""
 	}
-	if u := cm.proxyURL.User; u != nil {
-		username := u.Username()
-		password, _ := u.Password()
-		return "Basic " + basicAuth(username, password)
-	}
-	return ""
+	return proxyAuthorization(cm.proxyURL)
 }
 
 // error Values for debugging and testing, not seen by users.
@@ -1501,10 +1565,26 @@ func (t *Transport) decConnsPerHost(key connectMethodKey) {
 	}
 }
 
+// A TLSConn is a client TLS connection. *tls.Conn implements it, and
+// other TLS implementations can implement it to be used by Transport,
+// TLSNextProto and the HTTP/2 transport.
+type TLSConn interface {
+	net.Conn
+
+	// Handshake runs the client handshake unless it has already
+	// run, in which case it returns its result again.
+	Handshake() error
+
+	// ConnectionState returns the state of the connection after
+	// the handshake, including the negotiated protocol. It is
+	// used to set Response.TLS.
+	ConnectionState() tls.ConnectionState
+}
+
 // Add TLS to a persistent connection, i.e. negotiate a TLS session. If pconn is already a TLS
 // tunnel, this function establishes a nested TLS session inside the encrypted channel.
 // The remote endpoint's name may be overridden by TLSClientConfig.ServerName.
-func (pconn *persistConn) addTLS(name string, trace *httptrace.ClientTrace) error {
+func (pconn *persistConn) addTLS(name string, nextProtos []string, trace *httptrace.ClientTrace) error {
 	// Initiate TLS and check remote host name against certificate.
 	cfg := cloneTLSConfig(pconn.t.TLSClientConfig)
 	if cfg.ServerName == "" {
@@ -1513,8 +1593,16 @@ func (pconn *persistConn) addTLS(name string, trace *httptrace.ClientTrace) erro
 	if pconn.cacheKey.onlyH1 {
 		cfg.NextProtos = nil
 	}
+	if nextProtos != nil {
+		cfg.NextProtos = nextProtos
+	}
 	plainConn := pconn.conn
-	tlsConn := tls.Client(plainConn, cfg)
+	var tlsConn TLSConn
+	if pconn.t.TLSClient != nil {
+		tlsConn = pconn.t.TLSClient(plainConn, cfg)
+	} else {
+		tlsConn = tls.Client(plainConn, cfg)
+	}
 	errc := make(chan error, 2)
 	var timer *time.Timer // for canceling TLS handshake
 	if d := pconn.t.TLSHandshakeTimeout; d != 0 {
@@ -1570,13 +1658,14 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 		}
 		return err
 	}
+	tunneled := false // whether pconn.conn is an HTTP/2 CONNECT tunnel
 	if cm.scheme() == "https" && t.hasCustomTLSDialer() {
 		var err error
 		pconn.conn, err = t.customDialTLS(ctx, "tcp", cm.addr())
 		if err != nil {
 			return nil, wrapErr(err)
 		}
-		if tc, ok := pconn.conn.(*tls.Conn); ok {
+		if tc, ok := pconn.conn.(TLSConn); ok {
 			// Handshake here, in case DialTLS didn't. TLSNextProto below
 			// depends on it for knowing the connection state.
 			if trace != nil && trace.TLSHandshakeStart != nil {
@@ -1595,6 +1684,15 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 			}
 			pconn.tlsState = &cs
 		}
+	} else if conn, err := t.proxyH2Tunnel(ctx, cm, nil); err != errNoProxyH2Conn {
+		// A shared HTTP/2 connection to the proxy carries the
+		// tunnel. As with HTTP/1.1 CONNECT requests, errors are
+		// returned as is.
+		if err != nil {
+			return nil, err
+		}
+		pconn.conn = conn
+		tunneled = true
 	} else {
 		conn, err := t.dial(ctx, "tcp", cm.addr())
 		if err != nil {
@@ -1606,32 +1704,28 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 			if firstTLSHost, _, err = net.SplitHostPort(cm.addr()); err != nil {
 				return nil, wrapErr(err)
 			}
-			if err = pconn.addTLS(firstTLSHost, trace); err != nil {
+			if err = pconn.addTLS(firstTLSHost, t.proxyNextProtos(cm), trace); err != nil {
 				return nil, wrapErr(err)
 			}
 		}
+		if cm.proxyURL != nil && cm.targetScheme == "https" && pconn.tlsState != nil && pconn.tlsState.NegotiatedProtocol == "h2" {
+			tlsConn := pconn.conn.(TLSConn)
+			pconn.tlsState = nil
+			if pconn.conn, err = t.proxyH2Tunnel(ctx, cm, tlsConn); err != nil {
+				return nil, err
+			}
+			tunneled = true
+		}
 	}
 
 	// Proxy setup.
 	switch {
 	case cm.proxyURL == nil:
 		// Do nothing. Not using a proxy.
-	case cm.proxyURL.Scheme == "socks5":
-		conn := pconn.conn
-		d := socksNewDialer("tcp", conn.RemoteAddr().String())
-		if u := cm.proxyURL.User; u != nil {
-			auth := &socksUsernamePassword{
-				Username: u.Username(),
-			}
-			auth.Password, _ = u.Password()
-			d.AuthMethods = []socksAuthMethod{
-				socksAuthMethodNotRequired,
-				socksAuthMethodUsernamePassword,
-			}
-			d.Authenticate = auth.Authenticate
-		}
-		if _, err := d.DialWithConn(ctx, conn, "tcp", cm.targetAddr); err != nil {
-			conn.Close()
+	case tunneled:
+		// The CONNECT request was sent as an HTTP/2 stream.
+	case isSOCKSScheme(cm.proxyURL.Scheme):
+		if err := socksConnect(ctx, pconn.conn, cm.proxyURL, cm.targetAddr); err != nil {
 			return nil, err
 		}
 	case cm.targetScheme == "http":
@@ -1643,91 +1737,35 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 		}
 	case cm.targetScheme == "https":
 		conn := pconn.conn
-		var hdr Header
-		if t.GetProxyConnectHeader != nil {
-			var err error
-			hdr, err = t.GetProxyConnectHeader(ctx, cm.proxyURL, cm.targetAddr)
-			if err != nil {
-				conn.Close()
-				return nil, err
-			}
-		} else {
-			hdr = t.ProxyConnectHeader
-		}
-		if hdr == nil {
-			hdr = make(Header)
-		}
-		if pa := cm.proxyAuth(); pa != "" {
-			hdr = hdr.Clone()
-			hdr.Set("Proxy-Authorization", pa)
-		}
-		connectReq := &Request{
-			Method: "CONNECT",
-			URL:    &url.URL{Opaque: cm.targetAddr},
-			Host:   cm.targetAddr,
-			Header: hdr,
-		}
-
-		// If there's no done channel (no deadline or cancellation
-		// from the caller possible), at least set some (long)
-		// timeout here. This will make sure we don't block forever
-		// and leak a goroutine if the connection stops replying
-		// after the TCP connect.
-		connectCtx := ctx
-		if ctx.Done() == nil {
-			newCtx, cancel := context.WithTimeout(ctx, 1*time.Minute)
-			defer cancel()
-			connectCtx = newCtx
-		}
-
-		didReadResponse := make(chan struct{}) // closed after CONNECT write+read is done or fails
-		var (
-			resp *Response
-			err  error // write or read error
-		)
-		// Write the CONNECT request & read the response.
-		go func() {
-			defer close(didReadResponse)
-			err = connectReq.Write(conn)
-			if err != nil {
-				return
-			}
-			// Okay to use and discard buffered reader here, because
-			// TLS server will not speak until spoken to.
-			br := bufio.NewReader(conn)
-			resp, err = ReadResponse(br, connectReq)
-		}()
-		select {
-		case <-connectCtx.Done():
-			conn.Close()
-			<-didReadResponse
-			return nil, connectCtx.Err()
-		case <-didReadResponse:
-			// resp or err now set
-		}
+		hdr, err := t.proxyConnectHeader(ctx, cm)
 		if err != nil {
 			conn.Close()
 			return nil, err
 		}
-		if resp.StatusCode != 200 {
-			f := strings.SplitN(resp.Status, " ", 2)
-			conn.Close()
-			if len(f) < 2 {
-				return nil, errors.New("unknown status code")
-			}
-			return nil, errors.New(f[1])
+		if err := httpConnect(ctx, conn, cm.targetAddr, hdr); err != nil {
+			return nil, err
 		}
 	}
 
 	if cm.proxyURL != nil && cm.targetScheme == "https" {
-		if err := pconn.addTLS(cm.tlsHost(), trace); err != nil {
+		if err := pconn.addTLS(cm.tlsHost(), nil, trace); err != nil {
 			return nil, err
 		}
 	}
 
-	if s := pconn.tlsState; s != nil && s.NegotiatedProtocolIsMutual && s.NegotiatedProtocol != "" {
-		if next, ok := t.TLSNextProto[s.NegotiatedProtocol]; ok {
-			alt := next(cm.targetAddr, pconn.conn.(*tls.Conn))
+	// ALPN only lets servers select a protocol the client offered,
+	// so NegotiatedProtocol is trusted even when a custom TLSConn
+	// doesn't set NegotiatedProtocolIsMutual.
+	if s := pconn.tlsState; s != nil && s.NegotiatedProtocol != "" {
+		next, ok := t.TLSNextProto[s.NegotiatedProtocol]
+		if !ok && s.NegotiatedProtocol == "h2" {
+			// Speaking HTTP/1.1 on this connection would fail
+			// in confusing ways.
+			pconn.conn.Close()
+			return nil, errors.New("net/http: server negotiated HTTP/2, which is disabled on this Transport")
+		}
+		if ok {
+			alt := next(cm.targetAddr, pconn.conn.(TLSConn))
 			if e, ok := alt.(erringRoundTripper); ok {
 				// pconn.conn was closed by next (http2configureTransports.upgradeFn).
 				return nil, e.RoundTripErr()
@@ -1816,7 +1854,7 @@ func (cm *connectMethod) key() connectMethodKey {
 	}
 }
 
-// scheme returns the first hop scheme: http, https, or socks5
+// scheme returns the first hop scheme: http, https, or a SOCKS scheme
 func (cm *connectMethod) scheme() string {
 	if cm.proxyURL != nil {
 		return cm.proxyURL.Scheme
@@ -2864,9 +2902,12 @@ func (pc *persistConn) closeLocked(err error) {
 }
 
 var portMap = map[string]string{
-	"http":   "80",
-	"https":  "443",
-	"socks5": "1080",
+	"http":    "80",
+	"https":   "443",
+	"socks4":  "1080",
+	"socks4a": "1080",
+	"socks5":  "1080",
+	"socks5h": "1080",
 }
 
 // canonicalAddr returns url.Host but always with a ":port" suffix
@@ -1330,6 +1330,177 @@ func TestSOCKS5Proxy(t *testing.T) {
 	}
 }
 
+// socksRequest is a CONNECT request received by a socksProxy.
+type socksRequest struct {
+	version  byte
+	host     string // IP address or host name, as sent
+	port     int
+	user     string // SOCKS4 user ID or SOCKS5 username
+	password string
+}
+
+// socksProxy is an in-process SOCKS4, SOCKS4a and SOCKS5 proxy. It
+// connects every request to target, whatever address was asked for.
+type socksProxy struct {
+	l        net.Listener
+	target   string
+	password string // if set, SOCKS5 clients must authenticate
+	reqs     chan socksRequest
+}
+
+func newSOCKSProxy(t *testing.T, target string) *socksProxy {
+	p := &socksProxy{l: newLocalListener(t), target: target, reqs: make(chan socksRequest, 10)}
+	go func() {
+		for {
+			c, err := p.l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(t, c)
+		}
+	}()
+	return p
+}
+
+func (p *socksProxy) serve(t *testing.T, c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	var req socksRequest
+	var err error
+	if req.version, err = br.ReadByte(); err != nil {
+		t.Errorf("socks proxy read: %v", err)
+		return
+	}
+	readN := func(n int) []byte {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			t.Errorf("socks proxy read: %v", err)
+			return nil
+		}
+		return b
+	}
+	readString := func() string {
+		s, err := br.ReadString(0)
+		if err != nil {
+			t.Errorf("socks proxy read: %v", err)
+		}
+		return strings.TrimSuffix(s, "\x00")
+	}
+	switch req.version {
+	case 4:
+		b := readN(7)
+		if b == nil {
+			return
+		}
+		req.port = int(binary.BigEndian.Uint16(b[1:3]))
+		req.host = net.IP(b[3:7]).String()
+		req.user = readString()
+		if b[3] == 0 && b[4] == 0 && b[5] == 0 && b[6] != 0 {
+			req.host = readString()
+		}
+		c.Write([]byte{0, 90, 0, 0, 0, 0, 0, 0})
+	case 5:
+		b := readN(1)
+		if b == nil {
+			return
+		}
+		methods := readN(int(b[0]))
+		if p.password != "" {
+			if !bytes.Contains(methods, []byte{2}) {
+				c.Write([]byte{5, 0xff})
+				return
+			}
+			c.Write([]byte{5, 2})
+			b := readN(2)
+			req.user = string(readN(int(b[1])))
+			req.password = string(readN(int(readN(1)[0])))
+			if req.password != p.password {
+				c.Write([]byte{1, 1})
+				return
+			}
+			c.Write([]byte{1, 0})
+		} else {
+			c.Write([]byte{5, 0})
+		}
+		b = readN(4)
+		switch b[3] {
+		case 1:
+			req.host = net.IP(readN(4)).String()
+		case 3:
+			req.host = string(readN(int(readN(1)[0])))
+		case 4:
+			req.host = net.IP(readN(16)).String()
+		}
+		req.port = int(binary.BigEndian.Uint16(readN(2)))
+		c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	default:
+		t.Errorf("socks proxy: unknown version %d", req.version)
+		return
+	}
+	p.reqs <- req
+
+	target, err := net.Dial("tcp", p.target)
+	if err != nil {
+		t.Errorf("socks proxy dial: %v", err)
+		return
+	}
+	defer target.Close()
+	go io.Copy(target, br)
+	io.Copy(c, target)
+}
+
+func TestSOCKSProxySchemes(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	tests := []struct {
+		scheme   string
+		user     *url.Userinfo
+		password string // required by the proxy
+		want     socksRequest
+	}{
+		{"socks4", url.User("alice"), "", socksRequest{version: 4, host: "127.0.0.1", user: "alice"}},
+		{"socks4a", nil, "", socksRequest{version: 4, host: "localhost"}},
+		{"socks5", nil, "", socksRequest{version: 5, host: "127.0.0.1"}},
+		{"socks5h", url.UserPassword("bob", "secret"), "secret", socksRequest{version: 5, host: "localhost", user: "bob", password: "secret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scheme, func(t *testing.T) {
+			p := newSOCKSProxy(t, ts.Listener.Addr().String())
+			defer p.l.Close()
+			p.password = tt.password
+			pu := &url.URL{Scheme: tt.scheme, Host: p.l.Addr().String(), User: tt.user}
+			c := &Client{Transport: &Transport{Proxy: ProxyURL(pu)}}
+			defer c.CloseIdleConnections()
+
+			// socks4 and socks5 resolve localhost locally; it
+			// must come out as an IPv4 address for the SOCKS4 case.
+			res, err := c.Get("http://localhost:" + port + "/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			if string(body) != "ok" {
+				t.Errorf("body = %q; want %q", body, "ok")
+			}
+
+			got := <-p.reqs
+			tt.want.port, _ = strconv.Atoi(port)
+			if tt.scheme == "socks5" && got.host == "::1" {
+				tt.want.host = "::1"
+			}
+			if got != tt.want {
+				t.Errorf("proxy got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestTransportProxy(t *testing.T) {
 	defer afterTest(t)
 	testCases := []struct{ httpsSite, httpsProxy bool }{
@@ -1462,6 +1633,130 @@ func TestTransportProxy(t *testing.T) {
 	}
 }
 
+func TestTransportProxyHTTP2(t *testing.T) {
+	defer afterTest(t)
+	for _, proxyH2 := range []bool{true, false} {
+		t.Run(fmt.Sprintf("proxyH2=%v", proxyH2), func(t *testing.T) {
+			var sites []*httptest.Server
+			for i := 0; i < 2; i++ {
+				body := fmt.Sprintf("site%d", i)
+				ts := httptest.NewTLSServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+					io.WriteString(w, body)
+				}))
+				defer ts.Close()
+				sites = append(sites, ts)
+			}
+
+			var mu sync.Mutex
+			var proxyConns int
+			var connects []*Request
+			proxy := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+				if r.Method != "CONNECT" {
+					w.WriteHeader(StatusMethodNotAllowed)
+					return
+				}
+				mu.Lock()
+				connects = append(connects, r)
+				mu.Unlock()
+				target, err := net.Dial("tcp", r.Host)
+				if err != nil {
+					w.WriteHeader(StatusBadGateway)
+					return
+				}
+				defer target.Close()
+				if r.ProtoMajor == 1 {
+					c, brw, err := w.(Hijacker).Hijack()
+					if err != nil {
+						t.Errorf("Hijack: %v", err)
+						return
+					}
+					defer c.Close()
+					io.WriteString(c, "HTTP/1.1 200 OK\r\n\r\n")
+					go io.Copy(target, brw)
+					io.Copy(c, target)
+					return
+				}
+				w.WriteHeader(StatusOK)
+				w.(Flusher).Flush()
+				go func() {
+					io.Copy(target, r.Body)
+					target.Close()
+				}()
+				buf := make([]byte, 4096)
+				for {
+					n, err := target.Read(buf)
+					if n > 0 {
+						w.Write(buf[:n])
+						w.(Flusher).Flush()
+					}
+					if err != nil {
+						return
+					}
+				}
+			}))
+			proxy.EnableHTTP2 = proxyH2
+			proxy.Config.ConnState = func(c net.Conn, state ConnState) {
+				if state == StateNew {
+					mu.Lock()
+					proxyConns++
+					mu.Unlock()
+				}
+			}
+			proxy.StartTLS()
+			defer proxy.Close()
+
+			pu, _ := url.Parse(proxy.URL)
+			pu.User = url.UserPassword("user", "pass")
+			tr := &Transport{
+				Proxy:              ProxyURL(pu),
+				ProxyHTTP2:         true,
+				ProxyConnectHeader: Header{"X-Test": {"1"}},
+				TLSClientConfig:    &tls.Config{InsecureSkipVerify: true},
+			}
+			defer tr.CloseIdleConnections()
+			c := &Client{Transport: tr}
+			for i, ts := range sites {
+				res, err := c.Get(ts.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+				if want := fmt.Sprintf("site%d", i); string(body) != want {
+					t.Errorf("body = %q; want %q", body, want)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			wantConns, wantProto := 2, 1
+			if proxyH2 {
+				wantConns, wantProto = 1, 2
+			}
+			if proxyConns != wantConns {
+				t.Errorf("proxy connections = %d; want %d", proxyConns, wantConns)
+			}
+			if len(connects) != 2 {
+				t.Fatalf("got %d CONNECT requests; want 2", len(connects))
+			}
+			for i, r := range connects {
+				if r.ProtoMajor != wantProto {
+					t.Errorf("CONNECT %d over HTTP/%d; want HTTP/%d", i, r.ProtoMajor, wantProto)
+				}
+				if want := sites[i].Listener.Addr().String(); r.Host != want {
+					t.Errorf("CONNECT %d to %q; want %q", i, r.Host, want)
+				}
+				if got, want := r.Header.Get("Proxy-Authorization"), "Basic dXNlcjpwYXNz"; got != want {
+					t.Errorf("CONNECT %d Proxy-Authorization = %q; want %q", i, got, want)
+				}
+				if got := r.Header.Get("X-Test"); got != "1" {
+					t.Errorf("CONNECT %d X-Test = %q; want %q", i, got, "1")
+				}
+			}
+		})
+	}
+}
+
 // Issue 28012: verify that the Transport closes its TCP connection to http proxies
 // when they're slow to reply to HTTPS CONNECT responses.
 func TestTransportProxyHTTPSConnectLeak(t *testing.T) {
@@ -4207,7 +4502,7 @@ func TestTransportAutomaticHTTP2_DefaultTransport(t *testing.T) {
 
 func TestTransportAutomaticHTTP2_TLSNextProto(t *testing.T) {
 	testTransportAutoHTTP(t, &Transport{
-		TLSNextProto: make(map[string]func(string, *tls.Conn) RoundTripper),
+		TLSNextProto: make(map[string]func(string, TLSConn) RoundTripper),
 	}, false)
 }
 
@@ -4242,7 +4537,7 @@ func TestTransportAutomaticHTTP2_DialTLS(t *testing.T) {
 		DialTLS: func(network, addr string) (net.Conn, error) {
 			panic("unused")
 		},
-	}, false)
+	}, true)
 }
 
 func testTransportAutoHTTP(t *testing.T, tr *Transport, wantH2 bool) {
@@ -4334,8 +4629,8 @@ func TestNoCrashReturningTransportAltConn(t *testing.T) {
 
 	tr := &Transport{
 		DisableKeepAlives: true,
-		TLSNextProto: map[string]func(string, *tls.Conn) RoundTripper{
-			"foo": func(authority string, c *tls.Conn) RoundTripper {
+		TLSNextProto: map[string]func(string, TLSConn) RoundTripper{
+			"foo": func(authority string, c TLSConn) RoundTripper {
 				madeRoundTripper <- true
 				return funcRoundTripper(func() {
 					t.Error("foo RoundTripper should not be called")
@@ -5223,6 +5518,121 @@ func TestTransportProxyGetConnectHeader(t *testing.T) {
 	}
 }
 
+func TestTransportProxyConnectHeaderOrder(t *testing.T) {
+	defer afterTest(t)
+	l := newLocalListener(t)
+	defer l.Close()
+	reqs := make(chan string, 2)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			br := bufio.NewReader(c)
+			var b strings.Builder
+			for {
+				line, err := br.ReadString('\n')
+				b.WriteString(line)
+				if err != nil || line == "\r\n" {
+					break
+				}
+			}
+			reqs <- b.String()
+			io.WriteString(c, "HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\n\r\n")
+			c.Close()
+		}
+	}()
+
+	hdr := Header{
+		"X-B":          {"b"},
+		"x-a":          {"a"},
+		HeaderOrderKey: {"x-a", "user-agent", "Proxy-Authorization", "host", "X-B"},
+	}
+	tr := &Transport{
+		Proxy: func(r *Request) (*url.URL, error) {
+			u := &url.URL{Scheme: "http", Host: l.Addr().String()}
+			if r.URL.Host == "a.tld" {
+				u.User = url.UserPassword("user", "pass")
+			}
+			return u, nil
+		},
+		ProxyConnectHeader: hdr,
+	}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	want := []string{
+		"CONNECT a.tld:443 HTTP/1.1\r\n" +
+			"x-a: a\r\n" +
+			"user-agent: Go-http-client/1.1\r\n" +
+			"Proxy-Authorization: Basic dXNlcjpwYXNz\r\n" +
+			"host: a.tld:443\r\n" +
+			"X-B: b\r\n\r\n",
+		"CONNECT b.tld:443 HTTP/1.1\r\n" +
+			"x-a: a\r\n" +
+			"user-agent: Go-http-client/1.1\r\n" +
+			"host: b.tld:443\r\n" +
+			"X-B: b\r\n\r\n",
+	}
+	for i, host := range []string{"a.tld", "b.tld"} {
+		if _, err := c.Get("https://" + host + "/"); err == nil {
+			t.Fatalf("Get %s succeeded; want error", host)
+		}
+		if got := <-reqs; got != want[i] {
+			t.Errorf("CONNECT request:\n%q\nwant:\n%q", got, want[i])
+		}
+	}
+	if len(hdr) != 3 {
+		t.Errorf("ProxyConnectHeader changed to %v", hdr)
+	}
+}
+
+func TestTransportProxyConnectError(t *testing.T) {
+	defer afterTest(t)
+	for _, proxyH2 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("proxyH2=%v", proxyH2), func(t *testing.T) {
+			proxy := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+				if r.Method != "CONNECT" {
+					t.Errorf("method = %q; want CONNECT", r.Method)
+				}
+				w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+				w.WriteHeader(StatusProxyAuthRequired)
+				w.Write(bytes.Repeat([]byte("x"), 10<<10))
+			}))
+			proxy.EnableHTTP2 = proxyH2
+			proxy.StartTLS()
+			defer proxy.Close()
+
+			pu, _ := url.Parse(proxy.URL)
+			tr := &Transport{
+				Proxy:           ProxyURL(pu),
+				ProxyHTTP2:      true,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+			defer tr.CloseIdleConnections()
+			c := &Client{Transport: tr}
+			_, err := c.Get("https://golang.fake.tld/")
+			var pce *ProxyConnectError
+			if !errors.As(err, &pce) {
+				t.Fatalf("Get error = %v; want a *ProxyConnectError", err)
+			}
+			if pce.StatusCode != StatusProxyAuthRequired {
+				t.Errorf("StatusCode = %d; want %d", pce.StatusCode, StatusProxyAuthRequired)
+			}
+			if got, want := pce.Error(), "Proxy Authentication Required"; got != want {
+				t.Errorf("Error() = %q; want %q", got, want)
+			}
+			if got, want := pce.Header.Get("Proxy-Authenticate"), `Basic realm="proxy"`; got != want {
+				t.Errorf("Proxy-Authenticate = %q; want %q", got, want)
+			}
+			if len(pce.Body) != 4<<10 || pce.Body[0] != 'x' {
+				t.Errorf("len(Body) = %d; want %d", len(pce.Body), 4<<10)
+			}
+		})
+	}
+}
+
 var errFakeRoundTrip = errors.New("fake roundtrip")
 
 type funcRoundTripper func()
@@ -5892,13 +6302,16 @@ func TestTransportClone(t *testing.T) {
 		ExpectContinueTimeout:  time.Second,
 		ProxyConnectHeader:     Header{},
 		GetProxyConnectHeader:  func(context.Context, *url.URL, string) (Header, error) { return nil, nil },
+		ProxyHTTP2:             true,
 		MaxResponseHeaderBytes: 1,
 		ForceAttemptHTTP2:      true,
-		TLSNextProto: map[string]func(authority string, c *tls.Conn) RoundTripper{
-			"foo": func(authority string, c *tls.Conn) RoundTripper { panic("") },
+		TLSClient:              func(net.Conn, *tls.Config) TLSConn { return nil },
+		TLSNextProto: map[string]func(authority string, c TLSConn) RoundTripper{
+			"foo": func(authority string, c TLSConn) RoundTripper { panic("") },
 		},
 		ReadBufferSize:  1,
 		WriteBufferSize: 1,
+		ClientProfile:   ProfileChrome131,
 	}
 	tr2 := tr.Clone()
 	rv := reflect.ValueOf(tr2).Elem()
@@ -6484,3 +6897,160 @@ func TestCancelRequestWhenSharingConnection(t *testing.T) {
 	cancel()
 	wg.Wait()
 }
+
+// customTLSConn is a TLSConn that isn't a *tls.Conn, like those of
+// alternate TLS implementations.
+type customTLSConn struct {
+	*tls.Conn
+}
+
+func TestTransportCustomTLSConn(t *testing.T) {
+	var handshakes int32
+	newConn := func(conn net.Conn, cfg *tls.Config) TLSConn {
+		atomic.AddInt32(&handshakes, 1)
+		return customTLSConn{tls.Client(conn, cfg)}
+	}
+	tests := []struct {
+		name string
+		opt  func(*Transport)
+	}{
+		{"TLSClient", func(tr *Transport) {
+			tr.TLSClient = newConn
+		}},
+		{"DialTLSContext", func(tr *Transport) {
+			tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := net.Dial(network, addr)
+				if err != nil {
+					return nil, err
+				}
+				cfg := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}}
+				return newConn(conn, cfg), nil
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&handshakes, 0)
+			cst := newClientServerTest(t, h2Mode, HandlerFunc(func(w ResponseWriter, r *Request) {}), tt.opt)
+			defer cst.close()
+
+			res, err := cst.c.Get(cst.ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.ProtoMajor != 2 {
+				t.Errorf("got %s response; want HTTP/2.0", res.Proto)
+			}
+			if res.TLS == nil || res.TLS.NegotiatedProtocol != "h2" {
+				t.Errorf("Response.TLS = %+v; want negotiated h2", res.TLS)
+			}
+			if n := atomic.LoadInt32(&handshakes); n != 1 {
+				t.Errorf("custom TLS connections = %d; want 1", n)
+			}
+		})
+	}
+}
+
+func TestTransportCustomTLSDialerALPN(t *testing.T) {
+	CondSkipHTTP2(t)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	dialTLS := func(nextProtos []string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return tls.Dial(network, addr, &tls.Config{InsecureSkipVerify: true, NextProtos: nextProtos})
+		}
+	}
+	tests := []struct {
+		nextProtos []string
+		wantProto  int
+	}{
+		{[]string{"h2", "http/1.1"}, 2},
+		{[]string{"http/1.1", "h2"}, 2}, // the server's preference wins
+		{[]string{"http/1.1"}, 1},
+		{nil, 1},
+	}
+	for _, tt := range tests {
+		tr := &Transport{DialTLSContext: dialTLS(tt.nextProtos)}
+		res, err := (&Client{Transport: tr}).Get(ts.URL)
+		if err != nil {
+			t.Errorf("ALPN %q: %v", tt.nextProtos, err)
+			continue
+		}
+		res.Body.Close()
+		tr.CloseIdleConnections()
+		if res.ProtoMajor != tt.wantProto {
+			t.Errorf("ALPN %q: got %s response; want HTTP/%d", tt.nextProtos, res.Proto, tt.wantProto)
+		}
+	}
+
+	// TLSClientConfig or DialContext, which otherwise leave HTTP/2
+	// off, don't keep a custom dialer's h2 connections from being
+	// used, and the config isn't modified.
+	cfg := &tls.Config{NextProtos: []string{"http/1.1"}}
+	var d net.Dialer
+	tr := &Transport{
+		DialTLSContext:  dialTLS([]string{"h2", "http/1.1"}),
+		TLSClientConfig: cfg,
+		DialContext:     d.DialContext,
+	}
+	res, err := (&Client{Transport: tr}).Get(ts.URL)
+	if err != nil {
+		t.Fatalf("with TLSClientConfig: %v", err)
+	}
+	res.Body.Close()
+	tr.CloseIdleConnections()
+	if res.ProtoMajor != 2 {
+		t.Errorf("with TLSClientConfig: got %s response; want HTTP/2.0", res.Proto)
+	}
+	if want := []string{"http/1.1"}; !reflect.DeepEqual(cfg.NextProtos, want) {
+		t.Errorf("TLSClientConfig.NextProtos = %q; want %q", cfg.NextProtos, want)
+	}
+
+	// With HTTP/2 disabled, an h2 connection is an error rather than
+	// HTTP/1.1 spoken to an HTTP/2 server.
+	tr = &Transport{
+		DialTLSContext: dialTLS([]string{"h2"}),
+		TLSNextProto:   map[string]func(string, TLSConn) RoundTripper{},
+	}
+	_, err = (&Client{Transport: tr}).Get(ts.URL)
+	if err == nil || !strings.Contains(err.Error(), "negotiated HTTP/2") {
+		t.Errorf("h2 with HTTP/2 disabled: err = %v; want negotiated HTTP/2 error", err)
+	}
+}
+
+func TestTransportTLSClientNextProtosOrder(t *testing.T) {
+	CondSkipHTTP2(t)
+	ts := httptest.NewUnstartedServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	offered := make(chan []string, 1)
+	tr := &Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"http/1.1", "h2"},
+		},
+		ForceAttemptHTTP2: true,
+		TLSClient: func(conn net.Conn, cfg *tls.Config) TLSConn {
+			offered <- cfg.NextProtos
+			return tls.Client(conn, cfg)
+		},
+	}
+	defer tr.CloseIdleConnections()
+	res, err := (&Client{Transport: tr}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got, want := <-offered, []string{"http/1.1", "h2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("offered ALPN = %q; want %q", got, want)
+	}
+	if res.ProtoMajor != 2 {
+		t.Errorf("got %s response; want HTTP/2.0", res.Proto)
+	}
+}